@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/uuid"
+)
+
+// parseAlertOffset parses a relative alert such as "-15m", "-1h30m" or
+// "-2d". Negative offsets are before the event starts or the reminder is
+// due. time.ParseDuration has no unit for days, so "d" is handled here.
+func parseAlertOffset(value string) (time.Duration, error) {
+    s := strings.TrimSpace(value)
+    neg := strings.HasPrefix(s, "-")
+    if neg || strings.HasPrefix(s, "+") {
+        s = s[1:]
+    }
+    // Only the whole offset has a sign; strconv and time.ParseDuration
+    // would accept one on each part.
+    startsWithDigit := func(s string) bool { return s != "" && s[0] >= '0' && s[0] <= '9' }
+    if !startsWithDigit(s) {
+        return 0, fmt.Errorf("cannot parse %q", value)
+    }
+
+    var days time.Duration
+    if i := strings.IndexByte(s, 'd'); i >= 0 {
+        n, err := strconv.Atoi(s[:i])
+        if err != nil {
+            return 0, fmt.Errorf("cannot parse %q", value)
+        }
+        days = time.Duration(n) * 24 * time.Hour
+        s = s[i+1:]
+    }
+    var rest time.Duration
+    if s != "" {
+        if !startsWithDigit(s) {
+            return 0, fmt.Errorf("cannot parse %q", value)
+        }
+        var err error
+        rest, err = time.ParseDuration(s)
+        if err != nil || rest < 0 {
+            return 0, fmt.Errorf("cannot parse %q", value)
+        }
+    }
+
+    d := days + rest
+    if neg {
+        d = -d
+    }
+    return d, nil
+}
+
+// formatICalDuration formats d as an RFC 5545 DURATION, e.g. "-PT15M" or
+// "-P1D". go-ical's SetDuration always uses seconds, which some clients
+// display poorly.
+func formatICalDuration(d time.Duration) string {
+    s := ""
+    if d < 0 {
+        s = "-"
+        d = -d
+    }
+    s += "P"
+    if days := d / (24 * time.Hour); days > 0 {
+        s += fmt.Sprintf("%dD", days)
+        d -= days * 24 * time.Hour
+    }
+    if d == 0 {
+        if s == "P" || s == "-P" {
+            s += "T0S"
+        }
+        return s
+    }
+    s += "T"
+    if h := d / time.Hour; h > 0 {
+        s += fmt.Sprintf("%dH", h)
+        d -= h * time.Hour
+    }
+    if m := d / time.Minute; m > 0 {
+        s += fmt.Sprintf("%dM", m)
+        d -= m * time.Minute
+    }
+    if sec := d / time.Second; sec > 0 {
+        s += fmt.Sprintf("%dS", sec)
+    }
+    return s
+}
+
+// isRelativeAlert reports whether alert is an offset (see parseAlertOffset)
+// rather than a point in time.
+func isRelativeAlert(alert string) bool {
+    _, err := parseAlertOffset(alert)
+    return err == nil
+}
+
+// newAlarm builds a DISPLAY VALARM for alert, which is either a relative
+// offset (see parseAlertOffset) or a time in any form parseTimeArg accepts.
+// Relative alerts are relative to the end of the component if relatedToEnd
+// is set, which is how reminders without a start date are alerted before
+// they're due.
+func newAlarm(alert, description string, relatedToEnd bool) (*ical.Component, error) {
+    trigger := ical.NewProp(ical.PropTrigger)
+    if offset, err := parseAlertOffset(alert); err == nil {
+        trigger.Value = formatICalDuration(offset)
+        if relatedToEnd {
+            trigger.Params.Set(ical.ParamRelated, "END")
+        }
+    } else {
+        t, _, err := parseTimeArg(alert, nil)
+        if err != nil {
+            return nil, fmt.Errorf("%v, or a relative offset like -15m, -1h or -1d", err)
+        }
+        trigger.SetDateTime(t.UTC())
+    }
+
+    alarm := ical.NewComponent(ical.CompAlarm)
+    alarm.Props.SetText(ical.PropUID, uuid.NewString())
+    alarm.Props.SetText(ical.PropAction, "DISPLAY")
+    alarm.Props.SetText(ical.PropDescription, description)
+    alarm.Props.Set(trigger)
+    return alarm, nil
+}
+
+// addAlarms adds a VALARM to comp for each of alerts.
+func addAlarms(comp *ical.Component, alerts []string, relatedToEnd bool) error {
+    description, _ := comp.Props.Text(ical.PropSummary)
+    if description == "" {
+        description = "Reminder"
+    }
+    for _, alert := range alerts {
+        alarm, err := newAlarm(alert, description, relatedToEnd)
+        if err != nil {
+            return err
+        }
+        comp.Children = append(comp.Children, alarm)
+    }
+    return nil
+}
+
+// describeAlarms returns a human-readable description of each VALARM of
+// comp, such as "15m before start" or "at 2024-05-01T09:00:00Z".
+func describeAlarms(comp *ical.Component) []string {
+    var alerts []string
+    for _, child := range comp.Children {
+        if child.Name != ical.CompAlarm {
+            continue
+        }
+        trigger := child.Props.Get(ical.PropTrigger)
+        if trigger == nil {
+            continue
+        }
+        if trigger.ValueType() == ical.ValueDateTime {
+            if t, err := trigger.DateTime(nil); err == nil {
+                alerts = append(alerts, "at "+t.Format(time.RFC3339))
+            }
+            continue
+        }
+
+        d, err := trigger.Duration()
+        if err != nil {
+            continue
+        }
+        anchor := "start"
+        if strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") {
+            anchor = "end"
+            if comp.Name == ical.CompToDo {
+                anchor = "due"
+            }
+        }
+        switch {
+        case d < 0:
+            alerts = append(alerts, fmt.Sprintf("%s before %s", formatOffset(-d), anchor))
+        case d > 0:
+            alerts = append(alerts, fmt.Sprintf("%s after %s", formatOffset(d), anchor))
+        default:
+            alerts = append(alerts, "at "+anchor)
+        }
+    }
+    return alerts
+}
+
+// formatOffset formats a positive offset the way alerts are written, e.g.
+// "1d", "1h30m" or "15m".
+func formatOffset(d time.Duration) string {
+    s := ""
+    if days := d / (24 * time.Hour); days > 0 {
+        s += fmt.Sprintf("%dd", days)
+        d -= days * 24 * time.Hour
+    }
+    if h := d / time.Hour; h > 0 {
+        s += fmt.Sprintf("%dh", h)
+        d -= h * time.Hour
+    }
+    if m := d / time.Minute; m > 0 {
+        s += fmt.Sprintf("%dm", m)
+        d -= m * time.Minute
+    }
+    if sec := d / time.Second; sec > 0 || s == "" {
+        s += fmt.Sprintf("%ds", sec)
+    }
+    return s
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+func TestAlertOffsetRoundTrip(t *testing.T) {
+    tests := []struct {
+        alert    string
+        offset   time.Duration
+        duration string
+        describe string
+    }{
+        {"15m", 15 * time.Minute, "PT15M", "15m after start"},
+        {"-15m", -15 * time.Minute, "-PT15M", "15m before start"},
+        {"+15m", 15 * time.Minute, "PT15M", "15m after start"},
+        {" -15m ", -15 * time.Minute, "-PT15M", "15m before start"},
+        {"1h30m", 90 * time.Minute, "PT1H30M", "1h30m after start"},
+        {"-1h30m", -90 * time.Minute, "-PT1H30M", "1h30m before start"},
+        {"-90m", -90 * time.Minute, "-PT1H30M", "1h30m before start"},
+        {"2d", 48 * time.Hour, "P2D", "2d after start"},
+        {"-2d", -48 * time.Hour, "-P2D", "2d before start"},
+        {"-1d2h", -26 * time.Hour, "-P1DT2H", "1d2h before start"},
+        {"-26h", -26 * time.Hour, "-P1DT2H", "1d2h before start"},
+        {"-1d30s", -(24*time.Hour + 30*time.Second), "-P1DT30S", "1d30s before start"},
+        {"-45s", -45 * time.Second, "-PT45S", "45s before start"},
+        {"0m", 0, "PT0S", "at start"},
+        {"-0m", 0, "PT0S", "at start"},
+        {"0d", 0, "PT0S", "at start"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.alert, func(t *testing.T) {
+            offset, err := parseAlertOffset(tt.alert)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if offset != tt.offset {
+                t.Errorf("offset = %v, want %v", offset, tt.offset)
+            }
+            if !isRelativeAlert(tt.alert) {
+                t.Error("not a relative alert")
+            }
+            duration := formatICalDuration(offset)
+            if duration != tt.duration {
+                t.Errorf("duration = %q, want %q", duration, tt.duration)
+            }
+
+            // The DURATION reads back as the same offset, and is described
+            // the way it was written.
+            event := ical.NewComponent(ical.CompEvent)
+            if err := addAlarms(event, []string{tt.alert}, false); err != nil {
+                t.Fatal(err)
+            }
+            trigger := event.Children[0].Props.Get(ical.PropTrigger)
+            if trigger.Value != tt.duration {
+                t.Errorf("TRIGGER = %q, want %q", trigger.Value, tt.duration)
+            }
+            if d, err := trigger.Duration(); err != nil || d != tt.offset {
+                t.Errorf("TRIGGER reads back as %v (%v), want %v", d, err, tt.offset)
+            }
+            if got := describeAlarms(event); len(got) != 1 || got[0] != tt.describe {
+                t.Errorf("described as %q, want %q", got, tt.describe)
+            }
+        })
+    }
+}
+
+func TestParseAlertOffsetErrors(t *testing.T) {
+    // Alerts that aren't offsets are times; these are neither.
+    for _, alert := range []string{"", " ", "-", "+", "--15m", "+-15m", "15", "d", "xd", "-1.5d", "1h2d", "1d-2h", "1d+2h", "-+1d", ".5h", "soon"} {
+        if d, err := parseAlertOffset(alert); err == nil {
+            t.Errorf("parseAlertOffset(%q) = %v, want an error", alert, d)
+        }
+    }
+    // Times are not offsets.
+    for _, alert := range []string{"2025-07-01T10:00:00Z", "2025-07-01", "tomorrow 9am", "friday", "3pm", "now"} {
+        if isRelativeAlert(alert) {
+            t.Errorf("%q is taken as a relative alert", alert)
+        }
+    }
+}
+
+func TestFormatICalDuration(t *testing.T) {
+    tests := []struct {
+        d    time.Duration
+        want string
+    }{
+        {0, "PT0S"},
+        {time.Second, "PT1S"},
+        {90 * time.Second, "PT1M30S"},
+        {-time.Hour, "-PT1H"},
+        {24 * time.Hour, "P1D"},
+        {-7 * 24 * time.Hour, "-P7D"},
+        {25*time.Hour + time.Minute + time.Second, "P1DT1H1M1S"},
+        // Sub-second parts are dropped.
+        {1500 * time.Millisecond, "PT1S"},
+    }
+    for _, tt := range tests {
+        if got := formatICalDuration(tt.d); got != tt.want {
+            t.Errorf("formatICalDuration(%v) = %q, want %q", tt.d, got, tt.want)
+        }
+    }
+}
+
+func TestNewAlarm(t *testing.T) {
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+
+    tests := []struct {
+        alert        string
+        relatedToEnd bool
+        // trigger is the TRIGGER line as encoded.
+        trigger  string
+        describe string
+    }{
+        {"-15m", false, "TRIGGER:-PT15M", "15m before start"},
+        {"-15m", true, "TRIGGER;RELATED=END:-PT15M", "15m before due"},
+        {"0m", true, "TRIGGER;RELATED=END:PT0S", "at due"},
+        {"2025-07-01T10:00:00Z", false, "TRIGGER;VALUE=DATE-TIME:20250701T100000Z", "at 2025-07-01T10:00:00Z"},
+        // Times without an offset are read in ICLOUD_MCP_TIMEZONE and
+        // stored in UTC, regardless of relatedToEnd.
+        {"2025-07-01 09:00", true, "TRIGGER;VALUE=DATE-TIME:20250701T070000Z", "at 2025-07-01T07:00:00Z"},
+        {"2025-01-15T09:00", false, "TRIGGER;VALUE=DATE-TIME:20250115T080000Z", "at 2025-01-15T08:00:00Z"},
+        {"2025-07-01", false, "TRIGGER;VALUE=DATE-TIME:20250630T220000Z", "at 2025-06-30T22:00:00Z"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.alert, func(t *testing.T) {
+            alarm, err := newAlarm(tt.alert, "Call Bob", tt.relatedToEnd)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if action, _ := alarm.Props.Text(ical.PropAction); action != "DISPLAY" {
+                t.Errorf("ACTION = %q", action)
+            }
+            if desc, _ := alarm.Props.Text(ical.PropDescription); desc != "Call Bob" {
+                t.Errorf("DESCRIPTION = %q", desc)
+            }
+            if uid, _ := alarm.Props.Text(ical.PropUID); uid == "" {
+                t.Error("no UID")
+            }
+
+            todo := ical.NewComponent(ical.CompToDo)
+            todo.Children = append(todo.Children, alarm)
+            cal := ical.NewCalendar()
+            cal.Props.SetText(ical.PropVersion, "2.0")
+            cal.Props.SetText(ical.PropProductID, "-//Test//EN")
+            todo.Props.SetText(ical.PropUID, "todo")
+            todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+            cal.Children = append(cal.Children, todo)
+            var buf strings.Builder
+            if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+                t.Fatal(err)
+            }
+            if !strings.Contains(buf.String(), "\r\n"+tt.trigger+"\r\n") {
+                t.Errorf("encoded alarm doesn't contain %q:\n%s", tt.trigger, buf.String())
+            }
+
+            // The alarm survives a round trip through the encoding.
+            decoded, err := ical.NewDecoder(strings.NewReader(buf.String())).Decode()
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := describeAlarms(decoded.Children[0]); len(got) != 1 || got[0] != tt.describe {
+                t.Errorf("described as %q, want %q", got, tt.describe)
+            }
+        })
+    }
+}
+
+func TestNewAlarmErrors(t *testing.T) {
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+    for _, alert := range []string{"", "soon", "-15", "2025-13-01"} {
+        _, err := newAlarm(alert, "Call Bob", false)
+        if err == nil || !strings.Contains(err.Error(), "relative offset like -15m") {
+            t.Errorf("newAlarm(%q) error = %v", alert, err)
+        }
+    }
+
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Mars/Olympus")
+    if _, err := newAlarm("2025-07-01 09:00", "Call Bob", false); err == nil {
+        t.Error("no error with an invalid ICLOUD_MCP_TIMEZONE")
+    }
+    // Relative alerts don't need the timezone.
+    if _, err := newAlarm("-15m", "Call Bob", false); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestDescribeAlarms(t *testing.T) {
+    event := ical.NewComponent(ical.CompEvent)
+    event.Props.SetText(ical.PropSummary, "Standup")
+    if err := addAlarms(event, []string{"-15m", "-1d", "2025-07-01T10:00:00Z"}, false); err != nil {
+        t.Fatal(err)
+    }
+    if err := addAlarms(event, []string{"-5m"}, true); err != nil {
+        t.Fatal(err)
+    }
+    // Alarms with other or missing triggers are ignored.
+    broken := ical.NewComponent(ical.CompAlarm)
+    broken.Props.SetText(ical.PropAction, "DISPLAY")
+    event.Children = append(event.Children, broken)
+
+    want := []string{"15m before start", "1d before start", "at 2025-07-01T10:00:00Z", "5m before end"}
+    if got := describeAlarms(event); strings.Join(got, "; ") != strings.Join(want, "; ") {
+        t.Errorf("alarms = %q, want %q", got, want)
+    }
+    for _, alarm := range event.Children[:4] {
+        if desc, _ := alarm.Props.Text(ical.PropDescription); desc != "Standup" {
+            t.Errorf("DESCRIPTION = %q, want the summary", desc)
+        }
+    }
+
+    if err := addAlarms(ical.NewComponent(ical.CompToDo), []string{"-15m", "sometime"}, true); err == nil {
+        t.Error("addAlarms accepted an invalid alert")
+    }
+}
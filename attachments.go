@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultMaxAttachmentSize is the largest attachment get_attachment returns
+// or saves unless ICLOUD_MCP_MAX_ATTACHMENT_SIZE says otherwise.
+const defaultMaxAttachmentSize = 10 << 20
+
+// maxAttachmentSize returns the configured attachment size limit in bytes.
+func maxAttachmentSize() (int64, error) {
+    value := strings.TrimSpace(os.Getenv("ICLOUD_MCP_MAX_ATTACHMENT_SIZE"))
+    if value == "" {
+        return defaultMaxAttachmentSize, nil
+    }
+    n, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || n <= 0 {
+        return 0, fmt.Errorf("invalid ICLOUD_MCP_MAX_ATTACHMENT_SIZE %q: use a number of bytes", value)
+    }
+    return n, nil
+}
+
+// downloadDir returns the directory get_attachment saves attachments to.
+func downloadDir() (string, error) {
+    dir := os.Getenv("ICLOUD_MCP_DOWNLOAD_DIR")
+    if dir == "" {
+        return "", fmt.Errorf("ICLOUD_MCP_DOWNLOAD_DIR is not set; set it to save attachments")
+    }
+    return dir, nil
+}
+
+// fetchBodyStructure returns the BODYSTRUCTURE of the message with the given
+// UID in the selected mailbox.
+func fetchBodyStructure(c *client.Client, mailbox string, uid uint32) (*imap.BodyStructure, error) {
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uid)
+
+    messages := make(chan *imap.Message, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchBodyStructure}, messages)
+    }()
+
+    var bs *imap.BodyStructure
+    for msg := range messages {
+        bs = msg.BodyStructure
+    }
+    if err := <-done; err != nil {
+        return nil, fmt.Errorf("Failed to fetch message structure: %v", err)
+    }
+    if bs == nil {
+        return nil, fmt.Errorf("No message with UID %d in mailbox '%s'", uid, mailbox)
+    }
+    return bs, nil
+}
+
+// findPart returns the leaf part of bs with the given section path and its
+// parsed path, or nil.
+func findPart(bs *imap.BodyStructure, section string) (*imap.BodyStructure, []int) {
+    var found *imap.BodyStructure
+    var foundPath []int
+    bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+        if found != nil {
+            return false
+        }
+        if partName(path) == section && !strings.EqualFold(part.MIMEType, "multipart") {
+            found, foundPath = part, path
+            return false
+        }
+        return true
+    })
+    return found, foundPath
+}
+
+// decodedSize estimates the decoded size of a part from its encoded size,
+// erring on the low side so that only parts surely over the limit are
+// refused before they are downloaded.
+func decodedSize(part *imap.BodyStructure) int64 {
+    size := int64(part.Size)
+    if !strings.EqualFold(part.Encoding, "base64") {
+        return size
+    }
+    // Base64 lines hold 76 characters and end in CRLF.
+    size -= 2 * (size/78 + 1)
+    if size < 0 {
+        return 0
+    }
+    return size * 3 / 4
+}
+
+// attachmentURL returns the RFC 5092 IMAP URL of a message part, which
+// identifies an attachment returned as an embedded resource.
+func attachmentURL(mailbox string, uidValidity, uid uint32, section string) string {
+    u := url.URL{
+        Scheme: "imap",
+        Host:   imapAddr(),
+        Path:   fmt.Sprintf("/%s;UIDVALIDITY=%d/;UID=%d/;SECTION=%s", mailbox, uidValidity, uid, section),
+    }
+    if email, err := getEnv("ICLOUD_EMAIL"); err == nil {
+        u.User = url.User(email)
+    }
+    return u.String()
+}
+
+// commonExtensions overrides mime.ExtensionsByType, which returns the
+// extensions of a type in alphabetical order (".asc" for text/plain).
+var commonExtensions = map[string]string{
+    "text/plain":     ".txt",
+    "text/html":      ".html",
+    "text/calendar":  ".ics",
+    "image/jpeg":     ".jpg",
+    "message/rfc822": ".eml",
+}
+
+// attachmentFilename returns a safe file name for an attachment: its own
+// name without any directory, or a name made up from the UID and part.
+func attachmentFilename(att attachmentInfo, uid uint32) string {
+    name := filepath.Base(strings.ReplaceAll(att.Filename, "\\", "/"))
+    if name != "." && name != ".." && name != "/" && strings.TrimSpace(name) != "" {
+        return name
+    }
+    name = fmt.Sprintf("message-%d-part-%s", uid, att.Part)
+    if ext, ok := commonExtensions[att.MIMEType]; ok {
+        return name + ext
+    }
+    if exts, _ := mime.ExtensionsByType(att.MIMEType); len(exts) > 0 {
+        name += exts[0]
+    }
+    return name
+}
+
+// saveAttachment writes data to name in dir without replacing existing
+// files: "report.pdf" becomes "report (1).pdf" if it's taken.
+func saveAttachment(dir, name string, data []byte) (string, error) {
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return "", err
+    }
+    ext := filepath.Ext(name)
+    base := strings.TrimSuffix(name, ext)
+    for i := 0; ; i++ {
+        p := filepath.Join(dir, name)
+        if i > 0 {
+            p = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+        }
+        f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+        if errors.Is(err, os.ErrExist) {
+            continue
+        } else if err != nil {
+            return "", err
+        }
+        if _, err := f.Write(data); err != nil {
+            f.Close()
+            os.Remove(p)
+            return "", err
+        }
+        return p, f.Close()
+    }
+}
+
+type listAttachmentsOutput struct {
+    Mailbox     string           `json:"mailbox"`
+    UIDValidity uint32           `json:"uid_validity"`
+    UID         uint32           `json:"uid"`
+    Attachments []attachmentInfo `json:"attachments"`
+}
+
+// runListAttachments lists the attachments of a message from its
+// BODYSTRUCTURE, without downloading the message.
+func runListAttachments(mailbox string, uid, uidValidity uint32) (*mcp.CallToolResult, any, error) {
+    if mailbox == "" {
+        mailbox = "INBOX"
+    }
+    if uid == 0 {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "uid is required"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    c, err := dialIMAP()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    defer c.Logout()
+
+    mailbox, mbox, err := selectMailbox(c, mailbox, uidValidity)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    bs, err := fetchBodyStructure(c, mailbox, uid)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    out := listAttachmentsOutput{
+        Mailbox:     mailbox,
+        UIDValidity: mbox.UidValidity,
+        UID:         uid,
+        Attachments: messageAttachments(bs),
+    }
+    if len(out.Attachments) == 0 {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Message %d has no attachments.", uid)}},
+        }, out, nil
+    }
+    result := fmt.Sprintf("Attachments of message %d in %s (UIDVALIDITY %d):\n", uid, mailbox, mbox.UidValidity)
+    for _, att := range out.Attachments {
+        name := att.Filename
+        if name == "" {
+            name = "(unnamed)"
+        }
+        result += fmt.Sprintf("Part %s: %s (%s, %d bytes)\n", att.Part, name, att.MIMEType, att.Size)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// runGetAttachment fetches one part of a message and decodes its transfer
+// encoding. The part is returned as an embedded resource, or with save
+// written to the download directory. Parts larger than the configured
+// limit are refused, before downloading them where the BODYSTRUCTURE size
+// already tells.
+func runGetAttachment(mailbox string, uid, uidValidity uint32, section string, save bool) (*mcp.CallToolResult, any, error) {
+    if mailbox == "" {
+        mailbox = "INBOX"
+    }
+    if uid == 0 || section == "" {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "uid and part are required"}},
+            IsError: true,
+        }, nil, nil
+    }
+    limit, err := maxAttachmentSize()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    var dir string
+    if save {
+        if dir, err = downloadDir(); err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+    }
+
+    c, err := dialIMAP()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    defer c.Logout()
+
+    mailbox, mbox, err := selectMailbox(c, mailbox, uidValidity)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    bs, err := fetchBodyStructure(c, mailbox, uid)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    part, path := findPart(bs, section)
+    if part == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Message %d has no part %s; use list_attachments to see its parts", uid, section)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    filename, _ := part.Filename()
+    att := attachmentInfo{
+        Part:     section,
+        Filename: filename,
+        MIMEType: strings.ToLower(part.MIMEType + "/" + part.MIMESubType),
+        Size:     part.Size,
+    }
+    estimate := decodedSize(part)
+    if estimate > limit {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Part %s is about %d bytes, more than the limit of %d bytes (ICLOUD_MCP_MAX_ATTACHMENT_SIZE)", section, estimate, limit)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uid)
+    bodySection := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: path}, Peek: true}
+
+    messages := make(chan *imap.Message, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, []imap.FetchItem{bodySection.FetchItem()}, messages)
+    }()
+
+    var data []byte
+    var readErr error
+    for msg := range messages {
+        r := msg.GetBody(bodySection)
+        if r == nil {
+            continue
+        }
+        var h message.Header
+        h.Set("Content-Transfer-Encoding", part.Encoding)
+        entity, err := message.New(h, r)
+        if err != nil && !message.IsUnknownEncoding(err) {
+            readErr = err
+            continue
+        }
+        data, readErr = ioutil.ReadAll(io.LimitReader(entity.Body, limit+1))
+    }
+    if err := <-done; err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to fetch part %s: %v", section, err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if readErr != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to decode part %s: %v", section, readErr)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if data == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("The server returned no data for part %s", section)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if int64(len(data)) > limit {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Part %s is more than the limit of %d bytes (ICLOUD_MCP_MAX_ATTACHMENT_SIZE)", section, limit)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    name := attachmentFilename(att, uid)
+    if save {
+        p, err := saveAttachment(dir, name, data)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to save %s: %v", name, err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Saved part %s of message %d (%s, %d bytes) to %s.", section, uid, att.MIMEType, len(data), p)}},
+        }, nil, nil
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{
+            &mcp.TextContent{Text: fmt.Sprintf("Part %s of message %d: %s (%s, %d bytes).", section, uid, name, att.MIMEType, len(data))},
+            &mcp.EmbeddedResource{Resource: &mcp.ResourceContents{
+                URI:      attachmentURL(mailbox, mbox.UidValidity, uid, section),
+                MIMEType: att.MIMEType,
+                Blob:     data,
+            }},
+        },
+    }, nil, nil
+}
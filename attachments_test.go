@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// attachmentResource returns the single embedded resource of res.
+func attachmentResource(t *testing.T, res *mcp.CallToolResult) *mcp.ResourceContents {
+    t.Helper()
+    resultText(t, res, false)
+    var found *mcp.ResourceContents
+    for _, c := range res.Content {
+        if r, ok := c.(*mcp.EmbeddedResource); ok {
+            if found != nil {
+                t.Fatal("more than one resource in the result")
+            }
+            found = r.Resource
+        }
+    }
+    if found == nil {
+        t.Fatal("no resource in the result")
+    }
+    return found
+}
+
+func TestListAttachments(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    res, out, err := runListAttachments("", attachmentUID, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    list := out.(listAttachmentsOutput)
+    var parts []string
+    for _, att := range list.Attachments {
+        parts = append(parts, att.Part)
+    }
+    if got := strings.Join(parts, ","); got != "2,3,4" {
+        t.Errorf("parts = %s, want 2,3,4", got)
+    }
+    if list.UID != attachmentUID || list.Mailbox != "INBOX" || list.UIDValidity == 0 {
+        t.Errorf("output = %+v", list)
+    }
+    if !strings.Contains(text, "Part 3: (unnamed) (image/png, 12 bytes)") {
+        t.Errorf("result doesn't list the unnamed image:\n%s", text)
+    }
+
+    // The message startIMAP's INBOX starts with has none.
+    res, out, err = runListAttachments("", 6, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if atts := out.(listAttachmentsOutput).Attachments; len(atts) != 0 {
+        t.Errorf("attachments = %+v, want none", atts)
+    }
+}
+
+func TestGetAttachment(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    tests := []struct {
+        part     string
+        mimeType string
+        data     string
+        name     string
+    }{
+        {"2", "application/pdf", "%PDF-1.4\n%äüöß\n", "report.pdf"},
+        {"3", "image/png", "\x89PNG\r\n\x1a\n", "message-7-part-3.png"},
+        {"4", "text/plain", "some notes", "notes.txt"},
+        {"1.2", "text/html", "<p>Hello there</p>", "message-7-part-1.2.html"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.part, func(t *testing.T) {
+            res, _, err := runGetAttachment("", attachmentUID, 0, tt.part, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            r := attachmentResource(t, res)
+            if string(r.Blob) != tt.data {
+                t.Errorf("data = %q, want %q", r.Blob, tt.data)
+            }
+            if r.MIMEType != tt.mimeType {
+                t.Errorf("MIME type = %q, want %q", r.MIMEType, tt.mimeType)
+            }
+            if !strings.HasPrefix(r.URI, "imap://me%40example.com@") || !strings.HasSuffix(r.URI, fmt.Sprintf("/INBOX;UIDVALIDITY=1/;UID=7/;SECTION=%s", tt.part)) {
+                t.Errorf("URI = %q", r.URI)
+            }
+            if text := resultText(t, res, false); !strings.Contains(text, tt.name) {
+                t.Errorf("result doesn't name %s: %s", tt.name, text)
+            }
+        })
+    }
+}
+
+func TestSaveAttachment(t *testing.T) {
+    startIMAP(t, attachmentMail)
+    dir := t.TempDir()
+    t.Setenv("ICLOUD_MCP_DOWNLOAD_DIR", dir)
+
+    // Saving a part twice keeps both copies.
+    for _, want := range []string{"report.pdf", "report (1).pdf"} {
+        res, _, err := runGetAttachment("", attachmentUID, 0, "2", true)
+        if err != nil {
+            t.Fatal(err)
+        }
+        text := resultText(t, res, false)
+        p := filepath.Join(dir, want)
+        if !strings.Contains(text, p) {
+            t.Errorf("result doesn't mention %s: %s", p, text)
+        }
+        for _, c := range res.Content {
+            if _, ok := c.(*mcp.EmbeddedResource); ok {
+                t.Error("saved attachment is also returned as a resource")
+            }
+        }
+
+        data, err := os.ReadFile(p)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(data, []byte("%PDF-1.4\n%äüöß\n")) {
+            t.Errorf("%s = %q", want, data)
+        }
+        fi, err := os.Stat(p)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if mode := fi.Mode().Perm(); mode != 0o600 {
+            t.Errorf("%s has mode %v, want 0600", want, mode)
+        }
+    }
+}
+
+func TestGetAttachmentErrors(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    tests := []struct {
+        name string
+        env  map[string]string
+        uid  uint32
+        part string
+        save bool
+        want string
+    }{
+        {"unknown part", nil, attachmentUID, "9", false, "Message 7 has no part 9"},
+        {"multipart part", nil, attachmentUID, "1", false, "Message 7 has no part 1"},
+        {"no such message", nil, 99, "2", false, "No message with UID 99"},
+        {"no download dir", map[string]string{"ICLOUD_MCP_DOWNLOAD_DIR": ""}, attachmentUID, "2", true, "ICLOUD_MCP_DOWNLOAD_DIR is not set"},
+        {"too large", map[string]string{"ICLOUD_MCP_MAX_ATTACHMENT_SIZE": "5"}, attachmentUID, "2", false, "more than the limit of 5 bytes"},
+        {"invalid limit", map[string]string{"ICLOUD_MCP_MAX_ATTACHMENT_SIZE": "x"}, attachmentUID, "2", false, "invalid ICLOUD_MCP_MAX_ATTACHMENT_SIZE"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for k, v := range tt.env {
+                t.Setenv(k, v)
+            }
+            res, _, err := runGetAttachment("", tt.uid, 0, tt.part, tt.save)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+
+    // The limit applies to the decoded size: 8 bytes of PNG fit in 8.
+    t.Setenv("ICLOUD_MCP_MAX_ATTACHMENT_SIZE", "8")
+    res, _, err := runGetAttachment("", attachmentUID, 0, "3", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    attachmentResource(t, res)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultCacheTTL is how long a cached collection is served without asking
+// the server whether it changed. By default every listing revalidates the
+// cache, so changes made on other devices show up at once; only new or
+// changed objects are downloaded.
+const defaultCacheTTL = 0
+
+// multiGetBatch limits the number of objects fetched per calendar-multiget,
+// since servers cap the size of a single REPORT.
+const multiGetBatch = 100
+
+// cacheTTL returns the configured cache TTL from ICLOUD_MCP_CACHE_TTL. A
+// TTL of 0 revalidates on every call; "off" disables the cache.
+func cacheTTL() (ttl time.Duration, enabled bool, err error) {
+    value := strings.TrimSpace(os.Getenv("ICLOUD_MCP_CACHE_TTL"))
+    switch value {
+    case "":
+        return defaultCacheTTL, true, nil
+    case "off":
+        return 0, false, nil
+    }
+    ttl, err = time.ParseDuration(value)
+    if err != nil || ttl < 0 {
+        return 0, false, fmt.Errorf("invalid ICLOUD_MCP_CACHE_TTL %q: use a duration like 5m, 0 or off", value)
+    }
+    return ttl, true, nil
+}
+
+// objectCache is the on-disk copy of a collection: every member's
+// iCalendar data keyed by path, with the ETag it was fetched at.
+type objectCache struct {
+    Collection  string                  `json:"collection"`
+    ValidatedAt time.Time               `json:"validated_at"`
+    Objects     map[string]cachedObject `json:"objects"`
+}
+
+type cachedObject struct {
+    ETag string `json:"etag"`
+    Data string `json:"data"`
+}
+
+// cacheDir returns the directory cached collections are stored in.
+func cacheDir() (string, error) {
+    dir, err := stateDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(dir, "cache"), nil
+}
+
+// cachePath returns the cache file of the client's collection.
+func (c *calDAVClient) cachePath() (string, error) {
+    account, err := getEnv("ICLOUD_EMAIL")
+    if err != nil {
+        return "", err
+    }
+    return stateFile("cache", account, c.collectionURL())
+}
+
+func loadObjectCache(p, collection string) (*objectCache, error) {
+    cache := &objectCache{Collection: collection, Objects: make(map[string]cachedObject)}
+    data, err := os.ReadFile(p)
+    if errors.Is(err, os.ErrNotExist) {
+        return cache, nil
+    } else if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, cache); err != nil {
+        log.Printf("Ignoring corrupt cache %s: %v", p, err)
+        return &objectCache{Collection: collection, Objects: make(map[string]cachedObject)}, nil
+    }
+    if cache.Objects == nil {
+        cache.Objects = make(map[string]cachedObject)
+    }
+    return cache, nil
+}
+
+// cachedObjects returns every object of the collection. Within the TTL the
+// cache is served as is; after that the members' ETags are listed and only
+// new or changed objects are fetched, with calendar-multiget.
+func (c *calDAVClient) cachedObjects(ctx context.Context, ttl time.Duration) ([]caldav.CalendarObject, error) {
+    p, err := c.cachePath()
+    if err != nil {
+        return nil, err
+    }
+    cache, err := loadObjectCache(p, c.collectionURL())
+    if err != nil {
+        return nil, err
+    }
+
+    if time.Since(cache.ValidatedAt) >= ttl {
+        if err := c.revalidateCache(ctx, cache); err != nil {
+            return nil, err
+        }
+        if err := writeStateFile(p, cache); err != nil {
+            log.Printf("Failed to write cache %s: %v", p, err)
+        }
+    }
+
+    objs := make([]caldav.CalendarObject, 0, len(cache.Objects))
+    for objPath, cached := range cache.Objects {
+        cal, err := ical.NewDecoder(strings.NewReader(cached.Data)).Decode()
+        if err != nil {
+            log.Printf("Skipping cached %s: %v", objPath, err)
+            continue
+        }
+        objs = append(objs, caldav.CalendarObject{Path: objPath, ETag: cached.ETag, Data: cal})
+    }
+    sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+    return objs, nil
+}
+
+// revalidateCache brings cache up to date with the server.
+func (c *calDAVClient) revalidateCache(ctx context.Context, cache *objectCache) error {
+    etags, err := c.memberETags(ctx)
+    if err != nil {
+        return err
+    }
+
+    var changed []string
+    for objPath, etag := range etags {
+        if cached, ok := cache.Objects[objPath]; !ok || cached.ETag != etag {
+            changed = append(changed, objPath)
+        }
+    }
+    for objPath := range cache.Objects {
+        if _, ok := etags[objPath]; !ok {
+            delete(cache.Objects, objPath)
+        }
+    }
+
+    for len(changed) > 0 {
+        batch := changed
+        if len(batch) > multiGetBatch {
+            batch = batch[:multiGetBatch]
+        }
+        changed = changed[len(batch):]
+
+        objs, err := c.MultiGetCalendar(ctx, c.collectionPath(), &caldav.CalendarMultiGet{
+            Paths:       batch,
+            CompRequest: caldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+        })
+        if err != nil {
+            return fmt.Errorf("calendar-multiget failed: %v", err)
+        }
+        for _, obj := range objs {
+            if obj.Data == nil {
+                continue
+            }
+            var buf bytes.Buffer
+            if err := ical.NewEncoder(&buf).Encode(obj.Data); err != nil {
+                log.Printf("Not caching %s: %v", obj.Path, err)
+                continue
+            }
+            // Keep the ETag in the form the listing reports it in, which is
+            // what the next revalidation compares against; go-webdav's
+            // multiget strips the quotes.
+            etag := etags[obj.Path]
+            if etag == "" {
+                etag = obj.ETag
+            }
+            cache.Objects[obj.Path] = cachedObject{ETag: etag, Data: buf.String()}
+        }
+    }
+
+    cache.ValidatedAt = time.Now()
+    return nil
+}
+
+// invalidateCache marks the cached collection as stale after a write, so
+// the next read revalidates it. The ETags keep unchanged objects from
+// being fetched again.
+func (c *calDAVClient) invalidateCache() {
+    p, err := c.cachePath()
+    if err != nil {
+        return
+    }
+    cache, err := loadObjectCache(p, c.collectionURL())
+    if err != nil || cache.ValidatedAt.IsZero() {
+        return
+    }
+    cache.ValidatedAt = time.Time{}
+    if err := writeStateFile(p, cache); err != nil {
+        log.Printf("Failed to invalidate cache %s: %v", p, err)
+    }
+}
+
+// runClearCache removes every cached collection.
+func runClearCache(ctx context.Context) (*mcp.CallToolResult, any, error) {
+    dir, err := cacheDir()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    entries, err := os.ReadDir(dir)
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to read cache: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if err := os.RemoveAll(dir); err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to clear cache: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Cleared %d cached calendar(s).", len(entries))}},
+    }, nil, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// testEvent returns an iCalendar event on 1 July 2025.
+func testEvent(uid, summary string) string {
+    return "BEGIN:VCALENDAR\r\n" +
+        "VERSION:2.0\r\n" +
+        "PRODID:-//Example//Test//EN\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "UID:" + uid + "\r\n" +
+        "DTSTAMP:20250601T000000Z\r\n" +
+        "DTSTART:20250701T090000Z\r\n" +
+        "DTEND:20250701T100000Z\r\n" +
+        "SUMMARY:" + summary + "\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"
+}
+
+// listSummaries lists the events on 1 July 2025 and returns their sorted
+// summaries.
+func listSummaries(t *testing.T) []string {
+    t.Helper()
+    res, out, err := runListCalendarEvents(context.Background(), "", "2025-07-01", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    summaries := []string{}
+    for _, event := range out.(listCalendarEventsOutput).Events {
+        summaries = append(summaries, event.Summary)
+    }
+    sort.Strings(summaries)
+    return summaries
+}
+
+func wantSummaries(t *testing.T, got []string, want ...string) {
+    t.Helper()
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("events = %v, want %v", got, want)
+    }
+}
+
+func TestCacheRevalidatesByDefault(t *testing.T) {
+    var log requestLog
+    b := startCalDAVHandler(t, log.wrap)
+    b.store(t, "/user/calendars/work/a.ics", testEvent("a", "Alpha"))
+    b.store(t, "/user/calendars/work/b.ics", testEvent("b", "Beta"))
+
+    wantSummaries(t, listSummaries(t), "Alpha", "Beta")
+    if n := log.count("REPORT calendar-multiget /user/calendars/work/"); n != 1 {
+        t.Errorf("%d calendar-multiget(s) on the first listing, want 1", n)
+    }
+
+    // Nothing changed: the ETags are listed, but nothing is fetched.
+    log.reset()
+    wantSummaries(t, listSummaries(t), "Alpha", "Beta")
+    if n := log.count("PROPFIND /user/calendars/work/"); n != 1 {
+        t.Errorf("%d PROPFIND(s), want 1", n)
+    }
+    if n := log.count("REPORT calendar-multiget /user/calendars/work/"); n != 0 {
+        t.Errorf("%d calendar-multiget(s) without changes, want 0", n)
+    }
+
+    // Changes made by other clients show up on the next listing.
+    b.store(t, "/user/calendars/work/a.ics", testEvent("a", "Alpha 2"))
+    b.store(t, "/user/calendars/work/c.ics", testEvent("c", "Gamma"))
+    if err := b.DeleteCalendarObject(context.Background(), "/user/calendars/work/b.ics"); err != nil {
+        t.Fatal(err)
+    }
+    wantSummaries(t, listSummaries(t), "Alpha 2", "Gamma")
+}
+
+func TestCacheTTL(t *testing.T) {
+    var log requestLog
+    b := startCalDAVHandler(t, log.wrap)
+    t.Setenv("ICLOUD_MCP_CACHE_TTL", "1h")
+    b.store(t, "/user/calendars/work/a.ics", testEvent("a", "Alpha"))
+    wantSummaries(t, listSummaries(t), "Alpha")
+
+    // Within the TTL the cache is served without asking the server.
+    log.reset()
+    b.store(t, "/user/calendars/work/b.ics", testEvent("b", "Beta"))
+    wantSummaries(t, listSummaries(t), "Alpha")
+    if n := log.count("PROPFIND /user/calendars/work/"); n != 0 {
+        t.Errorf("%d PROPFIND(s) within the TTL, want 0", n)
+    }
+
+    // A write through this server invalidates the cache.
+    createEvent(t, newEventRequest{Summary: "Gamma", StartTime: "2025-07-01T11:00:00Z", EndTime: "2025-07-01T12:00:00Z"})
+    wantSummaries(t, listSummaries(t), "Alpha", "Beta", "Gamma")
+
+    // clear_cache forgets everything, so the next listing fetches it all.
+    res, _, err := runClearCache(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    log.reset()
+    wantSummaries(t, listSummaries(t), "Alpha", "Beta", "Gamma")
+    if n := log.count("REPORT calendar-multiget /user/calendars/work/"); n != 1 {
+        t.Errorf("%d calendar-multiget(s) after clear_cache, want 1", n)
+    }
+}
+
+func TestCacheMultiGetBatches(t *testing.T) {
+    var log requestLog
+    b := startCalDAVHandler(t, log.wrap)
+    n := 2*multiGetBatch + 1
+    for i := 0; i < n; i++ {
+        uid := fmt.Sprintf("event-%03d", i)
+        b.store(t, "/user/calendars/work/"+uid+".ics", testEvent(uid, uid))
+    }
+
+    if got := len(listSummaries(t)); got != n {
+        t.Errorf("%d events listed, want %d", got, n)
+    }
+    if got := log.count("REPORT calendar-multiget /user/calendars/work/"); got != 3 {
+        t.Errorf("%d calendar-multiget(s), want 3", got)
+    }
+}
+
+func TestCacheOff(t *testing.T) {
+    var log requestLog
+    b := startCalDAVHandler(t, log.wrap)
+    t.Setenv("ICLOUD_MCP_CACHE_TTL", "off")
+    b.store(t, "/user/calendars/work/a.ics", testEvent("a", "Alpha"))
+
+    wantSummaries(t, listSummaries(t), "Alpha")
+    if n := log.count("REPORT calendar-multiget /user/calendars/work/"); n != 0 {
+        t.Errorf("%d calendar-multiget(s) with the cache off, want 0", n)
+    }
+    if n := log.count("REPORT calendar-query /user/calendars/work"); n != 1 {
+        t.Errorf("%d calendar-query(s) with the cache off, want 1", n)
+    }
+}
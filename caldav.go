@@ -2,11 +2,19 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+    "net/url"
     "time"
     "bytes"
+    "encoding/xml"
     "os"
     "context"
+    "errors"
+    "io"
+    "path"
+    "strconv"
+    "strings"
 
 	"github.com/emersion/go-webdav/caldav"
     "github.com/emersion/go-webdav"
@@ -27,7 +35,98 @@ func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error
     return t.Base.RoundTrip(req)
 }
 
-func getCalDAVClient(urlEnv string) (*caldav.Client, error) {
+// calDAVClient wraps caldav.Client with the raw HTTP access we need for
+// conditional requests, which go-webdav's client does not expose.
+type calDAVClient struct {
+    *caldav.Client
+    httpClient *http.Client
+    endpoint   *url.URL
+}
+
+// calDAVStatusError is returned when the server answers a raw CalDAV request
+// with a non-2xx status.
+type calDAVStatusError struct {
+    Method     string
+    Path       string
+    StatusCode int
+    Status     string
+    // Precondition is the first precondition or postcondition the server
+    // reported in a DAV:error body (RFC 4918 section 16), if any.
+    Precondition xml.Name
+}
+
+func (e *calDAVStatusError) Error() string {
+    if e.Precondition.Local != "" {
+        return fmt.Sprintf("%s %s: %s (%s)", e.Method, e.Path, e.Status, e.Precondition.Local)
+    }
+    return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+// davPrecondition returns the first condition in a DAV:error response body,
+// such as DAV:supported-report, or the zero Name if there is none.
+func davPrecondition(r io.Reader) xml.Name {
+    var body struct {
+        XMLName    xml.Name
+        Conditions []struct {
+            XMLName xml.Name
+        } `xml:",any"`
+    }
+    if err := xml.NewDecoder(io.LimitReader(r, 64<<10)).Decode(&body); err != nil {
+        return xml.Name{}
+    }
+    if body.XMLName != (xml.Name{Space: "DAV:", Local: "error"}) || len(body.Conditions) == 0 {
+        return xml.Name{}
+    }
+    return body.Conditions[0].XMLName
+}
+
+// isConflict reports whether err is a 409 or 412 response, i.e. the object
+// already exists or was changed by someone else.
+func isConflict(err error) bool {
+    var statusErr *calDAVStatusError
+    if !errors.As(err, &statusErr) {
+        return false
+    }
+    return statusErr.StatusCode == http.StatusConflict || statusErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// calDAVObjectOutput is the structured result of a tool that wrote a
+// calendar object.
+type calDAVObjectOutput struct {
+    UID             string   `json:"uid"`
+    Path            string   `json:"path"`
+    ETag            string   `json:"etag,omitempty"`
+    InvitationsSent []string `json:"invitations_sent,omitempty"`
+}
+
+// calDAVErrorOutput is returned as structured content alongside IsError so
+// agents can tell a conflict apart from other failures.
+type calDAVErrorOutput struct {
+    Error      string `json:"error"`
+    Conflict   bool   `json:"conflict"`
+    StatusCode int    `json:"status_code,omitempty"`
+    Path       string `json:"path,omitempty"`
+}
+
+func calDAVErrorResult(msg string, path string, err error) (*mcp.CallToolResult, any, error) {
+    out := calDAVErrorOutput{
+        Error:    err.Error(),
+        Conflict: isConflict(err),
+        Path:     path,
+    }
+    var statusErr *calDAVStatusError
+    if errors.As(err, &statusErr) {
+        out.StatusCode = statusErr.StatusCode
+    }
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%s: %v", msg, err)}},
+        IsError: true,
+    }, out, nil
+}
+
+// newCalDAVClient returns a client authenticated with the iCloud credentials
+// whose requests are relative to endpoint.
+func newCalDAVClient(endpoint string) (*calDAVClient, error) {
     email, err := getEnv("ICLOUD_EMAIL")
     if err != nil {
         return nil, err
@@ -45,234 +144,1547 @@ func getCalDAVClient(urlEnv string) (*caldav.Client, error) {
         },
     }
 
-    url := os.Getenv(urlEnv)
-    if url == "" {
-        url = "https://caldav.icloud.com/"
+    client, err := caldav.NewClient(webdav.HTTPClient(httpClient), endpoint)
+    if err != nil {
+        return nil, err
+    }
+    u, err := url.Parse(endpoint)
+    if err != nil {
+        return nil, err
     }
+    return &calDAVClient{Client: client, httpClient: httpClient, endpoint: u}, nil
+}
 
-    client, err := caldav.NewClient(webdav.HTTPClient(httpClient), url)
+// withCollection returns a client sharing c's credentials whose requests are
+// relative to the collection at p.
+func (c *calDAVClient) withCollection(p string) (*calDAVClient, error) {
+    u := c.endpoint.ResolveReference(&url.URL{Path: p})
+    client, err := caldav.NewClient(webdav.HTTPClient(c.httpClient), u.String())
     if err != nil {
         return nil, err
     }
-    return client, nil
+    return &calDAVClient{Client: client, httpClient: c.httpClient, endpoint: u}, nil
 }
 
-func runCreateCalendarEvent(summary, startTime string, durationMinutes int) (*mcp.CallToolResult, any, error) {
-    start, err := time.Parse(time.RFC3339, startTime)
+// getCalDAVClient returns a client for the collection to operate on. If
+// calendar is set it names a discovered collection by display name or path.
+// Otherwise the collection configured in urlEnv is used, falling back to the
+// first discovered calendar supporting compType (ical.CompEvent or
+// ical.CompToDo).
+func getCalDAVClient(ctx context.Context, urlEnv, compType, calendar string) (*calDAVClient, error) {
+    if calendar == "" {
+        if endpoint := os.Getenv(urlEnv); endpoint != "" {
+            return newCalDAVClient(endpoint)
+        }
+    }
+
+    base, err := newCalDAVClient(calDAVBaseURL())
     if err != nil {
-        return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid start time format: %v", err)}},
-            IsError: true,
-        }, nil, nil
+        return nil, err
+    }
+    calendars, err := discoverCalendars(ctx, base)
+    if err != nil {
+        return nil, fmt.Errorf("calendar discovery failed: %v (set %s to skip discovery)", err, urlEnv)
     }
 
-    end := start.Add(time.Duration(durationMinutes) * time.Minute)
-    uid := uuid.NewString()
+    if calendar != "" {
+        cal, err := findCalendar(calendars, calendar)
+        if err != nil {
+            return nil, err
+        }
+        if !supportsComponent(*cal, compType) {
+            return nil, fmt.Errorf("calendar %q does not support %s components", cal.Name, compType)
+        }
+        return base.withCollection(cal.Path)
+    }
 
-    // Create VEVENT
-    event := ical.NewEvent()
-    event.Props.SetText(ical.PropSummary, summary)
-    event.Props.SetDateTime(ical.PropDateTimeStart, start)
-    event.Props.SetDateTime(ical.PropDateTimeEnd, end)
-    event.Props.SetText(ical.PropUID, uid)
+    for _, cal := range calendars {
+        if supportsComponent(cal, compType) {
+            return base.withCollection(cal.Path)
+        }
+    }
+    return nil, fmt.Errorf("no calendar supporting %s found (set %s to choose one)", compType, urlEnv)
+}
 
-    cal := ical.NewCalendar()
-    cal.Props.SetText(ical.PropVersion, "2.0")
-    cal.Props.SetText(ical.PropProductID, "-//Jules//iCloud MCP//EN")
-    cal.Children = append(cal.Children, event.Component)
+// collectionPath returns the path of the collection the client was
+// configured with, with a trailing slash.
+func (c *calDAVClient) collectionPath() string {
+    p := c.endpoint.Path
+    if !strings.HasSuffix(p, "/") {
+        p += "/"
+    }
+    return p
+}
+
+// collectionURL returns the absolute URL of the client's collection, which
+// identifies it in local state.
+func (c *calDAVClient) collectionURL() string {
+    return c.endpoint.ResolveReference(&url.URL{Path: c.collectionPath()}).String()
+}
+
+// objectPath returns the path of the calendar object for uid inside
+// collection.
+func objectPath(collection, uid string) string {
+    return path.Join(collection, url.PathEscape(uid)+".ics")
+}
+
+func (c *calDAVClient) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+    u := c.endpoint.ResolveReference(&url.URL{Path: p})
+    return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+func (c *calDAVClient) do(req *http.Request) (*http.Response, error) {
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode/100 != 2 {
+        defer resp.Body.Close()
+        return nil, &calDAVStatusError{
+            Method:       req.Method,
+            Path:         req.URL.Path,
+            StatusCode:   resp.StatusCode,
+            Status:       resp.Status,
+            Precondition: davPrecondition(resp.Body),
+        }
+    }
+    return resp, nil
+}
 
+// putCalendarObject uploads cal to p. If ifMatch is non-empty the write only
+// succeeds if the stored object still has that ETag; otherwise it only
+// succeeds if no object exists at p yet.
+func (c *calDAVClient) putCalendarObject(ctx context.Context, p string, cal *ical.Calendar, ifMatch string) (*caldav.CalendarObject, error) {
     var buf bytes.Buffer
-    enc := ical.NewEncoder(&buf)
-    if err := enc.Encode(cal); err != nil {
-         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to encode calendar object: %v", err)}},
-            IsError: true,
-        }, nil, nil
+    if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+        return nil, err
     }
 
-    // Tentative: If we wanted to upload, we would need to construct the path.
-    // client.PutCalendarObject(context.Background(), path, &buf, options)
-    // But without knowing the correct collection path, this often fails.
+    req, err := c.newRequest(ctx, http.MethodPut, p, &buf)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", ical.MIMEType)
+    if ifMatch != "" {
+        req.Header.Set("If-Match", quoteETag(ifMatch))
+    } else {
+        req.Header.Set("If-None-Match", "*")
+    }
 
-    return &mcp.CallToolResult{
-        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Generated iCalendar object:\n%s\n\nNote: Event generated locally. To upload, manual action or precise CalDAV URL configuration is required.", buf.String())}},
-    }, nil, nil
+    resp, err := c.do(req)
+    if err != nil {
+        return nil, err
+    }
+    resp.Body.Close()
+    c.invalidateCache()
+
+    return &caldav.CalendarObject{
+        Path: p,
+        ETag: unquoteETag(resp.Header.Get("ETag")),
+        Data: cal,
+    }, nil
 }
 
-func runListCalendarEvents(startTime, endTime string) (*mcp.CallToolResult, any, error) {
-    // Check if ICLOUD_CALDAV_URL is set before trying to connect
-    if os.Getenv("ICLOUD_CALDAV_URL") == "" {
-         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: "Please configure ICLOUD_CALDAV_URL to a specific calendar to list events."}},
-        }, nil, nil
+// deleteCalendarObject removes the object at p, but only if it still has
+// the given ETag.
+func (c *calDAVClient) deleteCalendarObject(ctx context.Context, p, etag string) error {
+    req, err := c.newRequest(ctx, http.MethodDelete, p, nil)
+    if err != nil {
+        return err
+    }
+    if etag != "" {
+        req.Header.Set("If-Match", quoteETag(etag))
     }
 
-    client, err := getCalDAVClient("ICLOUD_CALDAV_URL")
+    resp, err := c.do(req)
     if err != nil {
-        return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
-            IsError: true,
-        }, nil, nil
+        return err
     }
+    resp.Body.Close()
+    c.invalidateCache()
+    return nil
+}
 
-    // Construct query for VEVENT
-    query := &caldav.CalendarQuery{
-        CompRequest: caldav.CalendarCompRequest{
-            Name: "VCALENDAR",
-            Comps: []caldav.CalendarCompRequest{
-                {
-                    Name: "VEVENT",
-                    Props: []string{"SUMMARY", "DTSTART", "DTEND", "UID", "DESCRIPTION", "LOCATION"},
+// findCalendarObject returns the object at objPath, or, if objPath is empty,
+// the object holding the compType component with the given UID in the
+// client's collection. The returned object carries its current ETag.
+func (c *calDAVClient) findCalendarObject(ctx context.Context, compType, uid, objPath string) (*caldav.CalendarObject, error) {
+    if objPath == "" {
+        if uid == "" {
+            return nil, fmt.Errorf("either uid or path is required")
+        }
+
+        query := &caldav.CalendarQuery{
+            CompRequest: caldav.CalendarCompRequest{
+                Name: "VCALENDAR",
+                Comps: []caldav.CalendarCompRequest{
+                    {
+                        Name: compType,
+                        Props: []string{"UID"},
+                    },
                 },
             },
-        },
-        CompFilter: caldav.CompFilter{
-            Name: "VCALENDAR",
-            Comps: []caldav.CompFilter{
-                {
-                    Name: "VEVENT",
+            CompFilter: caldav.CompFilter{
+                Name: "VCALENDAR",
+                Comps: []caldav.CompFilter{
+                    {
+                        Name: compType,
+                        Props: []caldav.PropFilter{
+                            {
+                                Name: "UID",
+                                TextMatch: &caldav.TextMatch{Text: uid},
+                            },
+                        },
+                    },
                 },
             },
-        },
+        }
+        objs, err := c.QueryCalendar(ctx, "", query)
+        if err != nil {
+            return nil, err
+        }
+        // text-match is a substring match, so check for the exact UID.
+        for _, obj := range objs {
+            if objectUID(obj.Data) == uid {
+                objPath = obj.Path
+                break
+            }
+        }
+        if objPath == "" {
+            return nil, &objectNotFoundError{CompType: compType, UID: uid}
+        }
     }
 
-    // Add time range filter if possible
-    start, errS := time.Parse(time.RFC3339, startTime)
-    end, errE := time.Parse(time.RFC3339, endTime)
+    return c.GetCalendarObject(ctx, objPath)
+}
 
-    if errS == nil && errE == nil {
-         // Modify the VEVENT filter
-         query.CompFilter.Comps[0].Start = start
-         query.CompFilter.Comps[0].End = end
+// objectNotFoundError is returned by findCalendarObject when no object has
+// the requested UID.
+type objectNotFoundError struct {
+    CompType string
+    UID      string
+}
+
+func (e *objectNotFoundError) Error() string {
+    return fmt.Sprintf("no %s with UID %q found", e.CompType, e.UID)
+}
+
+// objectUID returns the UID shared by the components of cal.
+func objectUID(cal *ical.Calendar) string {
+    if cal == nil {
+        return ""
+    }
+    for _, child := range cal.Children {
+        if uid, err := child.Props.Text(ical.PropUID); err == nil && uid != "" {
+            return uid
+        }
+    }
+    return ""
+}
+
+// masterComponent returns the compType component of cal that is not a
+// RECURRENCE-ID override.
+func masterComponent(cal *ical.Calendar, compType string) *ical.Component {
+    for _, child := range cal.Children {
+        if child.Name == compType && child.Props.Get(ical.PropRecurrenceID) == nil {
+            return child
+        }
+    }
+    return nil
+}
+
+// touchComponent bumps SEQUENCE and the modification timestamps after comp
+// has been changed.
+func touchComponent(comp *ical.Component) {
+    seq := 0
+    if prop := comp.Props.Get(ical.PropSequence); prop != nil {
+        seq, _ = prop.Int()
+    }
+    sequence := ical.NewProp(ical.PropSequence)
+    sequence.Value = strconv.Itoa(seq + 1)
+    comp.Props.Set(sequence)
+
+    now := time.Now().UTC()
+    comp.Props.SetDateTime(ical.PropDateTimeStamp, now)
+    comp.Props.SetDateTime(ical.PropLastModified, now)
+}
+
+func quoteETag(etag string) string {
+    if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+        return etag
+    }
+    return strconv.Quote(etag)
+}
+
+func unquoteETag(etag string) string {
+    if s, err := strconv.Unquote(etag); err == nil {
+        return s
+    }
+    return etag
+}
+
+// newCalendar returns an empty VCALENDAR with the properties every object we
+// write needs.
+func newCalendar() *ical.Calendar {
+    cal := ical.NewCalendar()
+    cal.Props.SetText(ical.PropVersion, "2.0")
+    cal.Props.SetText(ical.PropProductID, "-//Jules//iCloud MCP//EN")
+    return cal
+}
+
+// calendarInfo describes a calendar collection for list_calendars.
+type calendarInfo struct {
+    Name           string   `json:"name"`
+    Path           string   `json:"path"`
+    Description    string   `json:"description,omitempty"`
+    Color          string   `json:"color,omitempty"`
+    Components     []string `json:"components"`
+    SupportsEvents bool     `json:"supports_events"`
+    SupportsTodos  bool     `json:"supports_todos"`
+}
+
+type listCalendarsOutput struct {
+    Calendars []calendarInfo `json:"calendars"`
+}
+
+func runListCalendars(ctx context.Context) (*mcp.CallToolResult, any, error) {
+    client, err := newCalDAVClient(calDAVBaseURL())
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
     }
 
-    objs, err := client.QueryCalendar(context.Background(), "", query)
+    calendars, err := discoverCalendars(ctx, client)
     if err != nil {
         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query events: %v. Ensure ICLOUD_CALDAV_URL points to a Calendar collection.", err)}},
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to discover calendars: %v", err)}},
             IsError: true,
         }, nil, nil
     }
 
+    out := listCalendarsOutput{Calendars: []calendarInfo{}}
     var result string
-    for _, obj := range objs {
-        result += fmt.Sprintf("Event found at: %s\n", obj.Path)
+    for _, cal := range calendars {
+        info := calendarInfo{
+            Name:           cal.Name,
+            Path:           cal.Path,
+            Description:    cal.Description,
+            Color:          calendarColor(cal.Path),
+            Components:     cal.SupportedComponentSet,
+            SupportsEvents: supportsComponent(cal, ical.CompEvent),
+            SupportsTodos:  supportsComponent(cal, ical.CompToDo),
+        }
+        if info.Components == nil {
+            info.Components = []string{}
+        }
+        out.Calendars = append(out.Calendars, info)
 
-        if obj.Data != nil {
-             for _, child := range obj.Data.Children {
-                 if child.Name == "VEVENT" {
-                     summary := child.Props.Get(ical.PropSummary)
-                     if summary != nil {
-                         result += fmt.Sprintf("  Summary: %s\n", summary.Value)
-                     }
-                     dtstart := child.Props.Get(ical.PropDateTimeStart)
-                     if dtstart != nil {
-                         result += fmt.Sprintf("  Start: %s\n", dtstart.Value)
-                     }
-                 }
-             }
+        var kinds []string
+        if info.SupportsEvents {
+            kinds = append(kinds, "events")
+        }
+        if info.SupportsTodos {
+            kinds = append(kinds, "reminders")
+        }
+        result += fmt.Sprintf("%s (%s)\n  Path: %s\n", info.Name, strings.Join(kinds, ", "), info.Path)
+        if info.Description != "" {
+            result += fmt.Sprintf("  Description: %s\n", info.Description)
+        }
+        if info.Color != "" {
+            result += fmt.Sprintf("  Color: %s\n", info.Color)
         }
     }
 
     if result == "" {
-        result = "No events found in the specified range."
+        result = "No calendars found."
     }
 
     return &mcp.CallToolResult{
         Content: []mcp.Content{&mcp.TextContent{Text: result}},
-    }, nil, nil
+    }, out, nil
 }
 
-func runCreateReminder(title, dueDate string) (*mcp.CallToolResult, any, error) {
-    // Similar to Event but VTODO
-    todo := ical.NewComponent(ical.CompToDo)
-    todo.Props.SetText(ical.PropSummary, title)
-    todo.Props.SetText(ical.PropUID, uuid.NewString())
+// newEventRequest holds the arguments of create_calendar_event.
+type newEventRequest struct {
+    Summary         string
+    StartTime       string
+    EndTime         string
+    DurationMinutes int
+    AllDay          bool
+    Timezone        string
+    Location        string
+    Description     string
+    URL             string
+    Recurrence      *recurrenceRequest
+    Attendees       []string
+    SendInvitations bool
+    Alerts          []string
+}
 
-    if dueDate != "" {
-        due, err := time.Parse(time.RFC3339, dueDate)
-        if err == nil {
-             todo.Props.SetDateTime(ical.PropDue, due)
+// parseEventTime parses a time argument (see parseTimeArg). Times without a
+// UTC offset are interpreted in loc, or the user's timezone if loc is nil.
+// The result is converted to loc, or to UTC if loc is nil.
+func parseEventTime(value string, loc *time.Location) (time.Time, error) {
+    t, _, err := parseTimeArg(value, loc)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if loc != nil {
+        return t.In(loc), nil
+    }
+    return t.UTC(), nil
+}
+
+// parseEventDate parses the date of an all-day event from a time argument
+// (see parseTimeArg). For a time rather than a date, its date in loc, or
+// the user's timezone if loc is nil, is used.
+func parseEventDate(value string, loc *time.Location) (time.Time, error) {
+    loc, err := resolveLocation(loc)
+    if err != nil {
+        return time.Time{}, err
+    }
+    t, _, err := parseTimeArg(value, loc)
+    if err != nil {
+        return time.Time{}, err
+    }
+    y, m, d := t.In(loc).Date()
+    return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+}
+
+// setEventTimes sets DTSTART and DTEND on event from req, returning the
+// VTIMEZONE the event's TZID refers to, if any.
+func setEventTimes(event *ical.Component, req newEventRequest) (*ical.Component, error) {
+    var loc *time.Location
+    if req.Timezone != "" {
+        var err error
+        loc, err = time.LoadLocation(req.Timezone)
+        if err != nil {
+            return nil, fmt.Errorf("invalid timezone %q: %v", req.Timezone, err)
         }
     }
 
-    cal := ical.NewCalendar()
-    cal.Props.SetText(ical.PropVersion, "2.0")
-    cal.Props.SetText(ical.PropProductID, "-//Jules//iCloud MCP//EN")
-    cal.Children = append(cal.Children, todo)
+    if req.AllDay {
+        start, err := parseEventDate(req.StartTime, loc)
+        if err != nil {
+            return nil, fmt.Errorf("invalid start time: %v", err)
+        }
+        // end_time is the last day of the event; DTEND is exclusive.
+        end := start.AddDate(0, 0, 1)
+        if req.EndTime != "" {
+            last, err := parseEventDate(req.EndTime, loc)
+            if err != nil {
+                return nil, fmt.Errorf("invalid end time: %v", err)
+            }
+            if last.Before(start) {
+                return nil, fmt.Errorf("end time must not be before start time")
+            }
+            end = last.AddDate(0, 0, 1)
+        }
+        event.Props.SetDate(ical.PropDateTimeStart, start)
+        event.Props.SetDate(ical.PropDateTimeEnd, end)
+        return nil, nil
+    }
 
-    var buf bytes.Buffer
-    enc := ical.NewEncoder(&buf)
-    _ = enc.Encode(cal)
+    start, err := parseEventTime(req.StartTime, loc)
+    if err != nil {
+        return nil, fmt.Errorf("invalid start time: %v", err)
+    }
+    var end time.Time
+    switch {
+    case req.EndTime != "":
+        end, err = parseEventTime(req.EndTime, loc)
+        if err != nil {
+            return nil, fmt.Errorf("invalid end time: %v", err)
+        }
+    case req.DurationMinutes > 0:
+        end = start.Add(time.Duration(req.DurationMinutes) * time.Minute)
+    default:
+        return nil, fmt.Errorf("either end_time or duration_minutes is required")
+    }
+    if end.Before(start) {
+        return nil, fmt.Errorf("end time must not be before start time")
+    }
 
-    return &mcp.CallToolResult{
-        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Generated VTODO object:\n%s\n", buf.String())}},
-    }, nil, nil
+    event.Props.SetDateTime(ical.PropDateTimeStart, start)
+    event.Props.SetDateTime(ical.PropDateTimeEnd, end)
+    if loc == nil || loc == time.UTC {
+        return nil, nil
+    }
+    // Cover a year past the event so the VTIMEZONE describes both the
+    // standard and daylight observances of the zone.
+    return newTimezone(loc, start, end.AddDate(1, 0, 0)), nil
 }
 
-func runListReminders() (*mcp.CallToolResult, any, error) {
-    // Check if separate Reminders URL is set, otherwise try default
-    if os.Getenv("ICLOUD_REMINDERS_URL") == "" && os.Getenv("ICLOUD_CALDAV_URL") == "" {
-         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: "Please configure ICLOUD_REMINDERS_URL (or ICLOUD_CALDAV_URL) to list reminders."}},
+func runCreateCalendarEvent(ctx context.Context, calendar string, req newEventRequest) (*mcp.CallToolResult, any, error) {
+    attendees, err := parseAttendees(req.Attendees)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
         }, nil, nil
     }
+    req.Attendees = attendees
+
+    uid := uuid.NewString()
+
+    // Create VEVENT
+    event := ical.NewEvent()
+    event.Props.SetText(ical.PropUID, uid)
+    event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+    event.Props.SetText(ical.PropSummary, req.Summary)
 
-    client, err := getCalDAVClient("ICLOUD_REMINDERS_URL")
+    tz, err := setEventTimes(event.Component, req)
     if err != nil {
         return &mcp.CallToolResult{
-             Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
-             IsError: true,
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid event time: %v", err)}},
+            IsError: true,
         }, nil, nil
     }
 
-    // We would Query for VTODO
-    query := &caldav.CalendarQuery{
-        CompRequest: caldav.CalendarCompRequest{
-            Name: "VCALENDAR",
-            Comps: []caldav.CalendarCompRequest{
-                {
-                    Name: "VTODO",
-                    Props: []string{"SUMMARY", "DUE", "STATUS", "UID"},
-                },
-            },
-        },
-        CompFilter: caldav.CompFilter{
-            Name: "VCALENDAR",
-            Comps: []caldav.CompFilter{
-                {
-                    Name: "VTODO",
-                },
-            },
-        },
+    if req.Recurrence != nil {
+        start, _, allDay, err := eventTimes(event.Component)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid event time: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        rule, err := buildRRule(*req.Recurrence, start, allDay)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid recurrence: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        prop := ical.NewProp(ical.PropRecurrenceRule)
+        prop.Value = rule
+        event.Props.Set(prop)
     }
 
-    // Execute query
-    objs, err := client.QueryCalendar(context.Background(), "", query)
+    if req.Location != "" {
+        event.Props.SetText(ical.PropLocation, req.Location)
+    }
+    if req.Description != "" {
+        event.Props.SetText(ical.PropDescription, req.Description)
+    }
+    if len(req.Attendees) > 0 {
+        organizer, err := getEnv("ICLOUD_EMAIL")
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        setAttendees(event.Component, organizer, req.Attendees)
+    }
+    if req.URL != "" {
+        u, err := url.Parse(req.URL)
+        if err != nil || !u.IsAbs() {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid URL %q", req.URL)}},
+                IsError: true,
+            }, nil, nil
+        }
+        event.Props.SetURI(ical.PropURL, u)
+    }
+    if err := addAlarms(event.Component, req.Alerts, false); err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid alert: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    client, err := getCalDAVClient(ctx, "ICLOUD_CALDAV_URL", ical.CompEvent, calendar)
     if err != nil {
-         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query reminders: %v. Ensure the URL points to a Reminders collection.", err)}},
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
             IsError: true,
         }, nil, nil
     }
 
-    var result string
-    for _, obj := range objs {
-        result += fmt.Sprintf("Found object at %s\n", obj.Path)
-        if obj.Data != nil {
-             for _, child := range obj.Data.Children {
-                 if child.Name == "VTODO" {
-                     summary := child.Props.Get(ical.PropSummary)
-                     if summary != nil {
-                         result += fmt.Sprintf("  Summary: %s\n", summary.Value)
-                     }
-                     status := child.Props.Get("STATUS")
-                     if status != nil {
-                         result += fmt.Sprintf("  Status: %s\n", status.Value)
-                     }
-                 }
-             }
-        }
+    cal := newCalendar()
+    if tz != nil {
+        cal.Children = append(cal.Children, tz)
+    }
+    cal.Children = append(cal.Children, event.Component)
+
+    p := objectPath(client.collectionPath(), uid)
+    obj, err := client.putCalendarObject(ctx, p, cal, "")
+    if err != nil {
+        return calDAVErrorResult("Failed to create event", p, err)
+    }
+
+    out := calDAVObjectOutput{UID: uid, Path: obj.Path, ETag: obj.ETag}
+    result := fmt.Sprintf("Event created.\n  UID: %s\n  Path: %s\n  ETag: %s\n", uid, obj.Path, obj.ETag)
+    if req.SendInvitations {
+        result += invitationStatus(cal, false, &out)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// invitationStatus sends iTIP invitations for cal and describes the outcome.
+// The event is already stored at this point, so a failure is reported but
+// doesn't fail the tool call.
+func invitationStatus(cal *ical.Calendar, update bool, out *calDAVObjectOutput) string {
+    sent, err := sendInvitations(cal, update)
+    if err != nil {
+        return fmt.Sprintf("Warning: failed to send invitations: %v\n", err)
+    }
+    if len(sent) == 0 {
+        return "No attendees to invite.\n"
+    }
+    out.InvitationsSent = sent
+    return fmt.Sprintf("Invitations sent to: %s\n", strings.Join(sent, ", "))
+}
+
+// eventOutput is a single event occurrence in the structured output of
+// list_calendar_events.
+type eventOutput struct {
+    UID         string `json:"uid"`
+    Path        string `json:"path"`
+    ETag        string `json:"etag,omitempty"`
+    Summary     string `json:"summary"`
+    Start       string `json:"start"`
+    End         string `json:"end"`
+    Timezone    string `json:"timezone,omitempty"`
+    AllDay      bool   `json:"all_day"`
+    Location    string `json:"location,omitempty"`
+    Description string `json:"description,omitempty"`
+    Status      string `json:"status,omitempty"`
+    Recurring   bool   `json:"recurring,omitempty"`
+
+    Alerts []string `json:"alerts,omitempty"`
+}
+
+type listCalendarEventsOutput struct {
+    Events []eventOutput `json:"events"`
+}
+
+// newEventOutput describes occurrence occ of an event stored in obj. Start
+// and end are RFC3339 in the event's own timezone, or dates for all-day
+// events.
+func newEventOutput(obj caldav.CalendarObject, occ eventOccurrence) eventOutput {
+    out := eventOutput{
+        UID:       objectUID(obj.Data),
+        Path:      obj.Path,
+        ETag:      obj.ETag,
+        AllDay:    occ.AllDay,
+        Recurring: occ.Recurring,
+    }
+    out.Summary, _ = occ.Event.Props.Text(ical.PropSummary)
+    out.Location, _ = occ.Event.Props.Text(ical.PropLocation)
+    out.Description, _ = occ.Event.Props.Text(ical.PropDescription)
+    out.Status, _ = occ.Event.Props.Text(ical.PropStatus)
+    out.Alerts = describeAlarms(occ.Event)
+
+    if occ.AllDay {
+        out.Start = occ.Start.Format(time.DateOnly)
+        out.End = occ.End.Format(time.DateOnly)
+        return out
+    }
+    out.Start = occ.Start.Format(time.RFC3339)
+    out.End = occ.End.Format(time.RFC3339)
+    if prop := occ.Event.Props.Get(ical.PropDateTimeStart); prop != nil {
+        if tzid := prop.Params.Get(ical.ParamTimezoneID); tzid != "" {
+            out.Timezone = tzid
+        } else if strings.HasSuffix(prop.Value, "Z") {
+            out.Timezone = "UTC"
+        }
+    }
+    return out
+}
+
+func runListCalendarEvents(ctx context.Context, calendar, startTime, endTime string) (*mcp.CallToolResult, any, error) {
+    client, err := getCalDAVClient(ctx, "ICLOUD_CALDAV_URL", ical.CompEvent, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    // Construct query for VEVENT
+    query := &caldav.CalendarQuery{
+        CompRequest: caldav.CalendarCompRequest{
+            Name: "VCALENDAR",
+            Comps: []caldav.CalendarCompRequest{
+                {
+                    Name: "VEVENT",
+                    Props: []string{"SUMMARY", "DTSTART", "DTEND", "DURATION", "UID", "DESCRIPTION", "LOCATION", "STATUS", "RRULE", "RDATE", "EXDATE", "RECURRENCE-ID"},
+                    Comps: []caldav.CalendarCompRequest{{Name: "VALARM", AllProps: true}},
+                },
+            },
+        },
+        CompFilter: caldav.CompFilter{
+            Name: "VCALENDAR",
+            Comps: []caldav.CompFilter{
+                {
+                    Name: "VEVENT",
+                },
+            },
+        },
+    }
+
+    start, end, ranged, err := parseTimeRange(startTime, endTime)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    if ranged {
+         // Modify the VEVENT filter
+         query.CompFilter.Comps[0].Start = start
+         query.CompFilter.Comps[0].End = end
+    }
+
+    // Serve from the local cache when enabled; the range is applied below
+    // by expandEvents, so the cache always holds the whole collection.
+    var objs []caldav.CalendarObject
+    ttl, cached, err := cacheTTL()
+    if err != nil {
+        log.Printf("Not using the cache: %v", err)
+    }
+    if cached {
+        objs, err = client.cachedObjects(ctx, ttl)
+        if err != nil {
+            log.Printf("Cache unavailable, querying the server: %v", err)
+            cached = false
+        }
+    }
+    if !cached {
+        objs, err = client.QueryCalendar(ctx, "", query)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query events: %v. Ensure the URL points to a Calendar collection.", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+    }
+
+    var result string
+    out := listCalendarEventsOutput{Events: []eventOutput{}}
+    for _, obj := range objs {
+        if obj.Data == nil {
+            continue
+        }
+
+        var occurrences []eventOccurrence
+        if ranged {
+            occurrences, err = expandEvents(obj.Data, start, end)
+            if err != nil {
+                log.Printf("Skipping %s: %v", obj.Path, err)
+                continue
+            }
+        } else {
+            // Without a range, recurrences can't be expanded; show the
+            // stored events as they are.
+            for _, child := range obj.Data.Children {
+                if child.Name != ical.CompEvent {
+                    continue
+                }
+                s, e, allDay, err := eventTimes(child)
+                if err != nil {
+                    log.Printf("Skipping %s: %v", obj.Path, err)
+                    continue
+                }
+                occurrences = append(occurrences, eventOccurrence{Event: child, Start: s, End: e, AllDay: allDay})
+            }
+        }
+
+        for _, occ := range occurrences {
+            event := newEventOutput(obj, occ)
+            out.Events = append(out.Events, event)
+
+            result += fmt.Sprintf("Event found at: %s\n", obj.Path)
+            if event.Summary != "" {
+                result += fmt.Sprintf("  Summary: %s\n", event.Summary)
+            }
+            if event.AllDay {
+                result += fmt.Sprintf("  Start: %s (all day)\n  End: %s\n", event.Start, event.End)
+            } else {
+                result += fmt.Sprintf("  Start: %s\n  End: %s\n", event.Start, event.End)
+            }
+            if event.Location != "" {
+                result += fmt.Sprintf("  Location: %s\n", event.Location)
+            }
+            if event.Status != "" {
+                result += fmt.Sprintf("  Status: %s\n", event.Status)
+            }
+            if event.Recurring {
+                result += "  Recurring: yes\n"
+            }
+            if len(event.Alerts) > 0 {
+                result += fmt.Sprintf("  Alerts: %s\n", strings.Join(event.Alerts, ", "))
+            }
+        }
+    }
+
+    if result == "" {
+        result = "No events found in the specified range."
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// eventUpdate holds the fields update_calendar_event changes. Nil fields
+// are left untouched.
+type eventUpdate struct {
+    Summary     *string
+    StartTime   *string
+    EndTime     *string
+    Location    *string
+    Description *string
+    Attendees   []string
+
+    SendInvitations bool
+}
+
+// allDayUpdateRequest returns the times of an all-day event after update,
+// for setEventTimes. Like in create_calendar_event, end_time is the last
+// day of the event; without it the event keeps its number of days.
+func allDayUpdateRequest(event *ical.Component, update eventUpdate) (newEventRequest, error) {
+    oldStart, oldEnd, _, err := eventTimes(event)
+    if err != nil && update.StartTime == nil {
+        return newEventRequest{}, fmt.Errorf("invalid DTSTART: %v", err)
+    }
+
+    start := oldStart
+    if update.StartTime != nil {
+        start, err = parseEventDate(*update.StartTime, nil)
+        if err != nil {
+            return newEventRequest{}, fmt.Errorf("invalid start time: %v", err)
+        }
+    }
+    req := newEventRequest{AllDay: true, StartTime: start.Format(time.DateOnly)}
+    if update.EndTime != nil {
+        req.EndTime = *update.EndTime
+    } else {
+        days := int(oldEnd.Sub(oldStart).Round(24*time.Hour) / (24 * time.Hour))
+        if days < 1 {
+            days = 1
+        }
+        req.EndTime = start.AddDate(0, 0, days-1).Format(time.DateOnly)
+    }
+    return req, nil
+}
+
+func runUpdateCalendarEvent(ctx context.Context, calendar, uid, objPath string, update eventUpdate) (*mcp.CallToolResult, any, error) {
+    attendees, err := parseAttendees(update.Attendees)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    update.Attendees = attendees
+
+    client, err := getCalDAVClient(ctx, "ICLOUD_CALDAV_URL", ical.CompEvent, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    obj, err := client.findCalendarObject(ctx, ical.CompEvent, uid, objPath)
+    if err != nil {
+        return calDAVErrorResult("Failed to fetch event", objPath, err)
+    }
+
+    event := masterComponent(obj.Data, ical.CompEvent)
+    if event == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No VEVENT found in %s", obj.Path)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    if prop := event.Props.Get(ical.PropDateTimeStart); prop != nil && prop.ValueType() == ical.ValueDate && (update.StartTime != nil || update.EndTime != nil) {
+        req, err := allDayUpdateRequest(event, update)
+        if err == nil {
+            event.Props.Del(ical.PropDuration)
+            _, err = setEventTimes(event, req)
+        }
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid event time: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+    } else if update.StartTime != nil || update.EndTime != nil {
+        oldStart, errS := event.Props.DateTime(ical.PropDateTimeStart, nil)
+        oldEnd, errE := (&ical.Event{Component: event}).DateTimeEnd(nil)
+
+        // Keep the event in the timezone it was created in.
+        var loc *time.Location
+        if errS == nil && oldStart.Location() != time.UTC {
+            loc = oldStart.Location()
+        }
+
+        start := oldStart
+        if update.StartTime != nil {
+            start, err = parseEventTime(*update.StartTime, loc)
+            if err != nil {
+                return &mcp.CallToolResult{
+                    Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid start time format: %v", err)}},
+                    IsError: true,
+                }, nil, nil
+            }
+        }
+
+        var end time.Time
+        switch {
+        case update.EndTime != nil:
+            end, err = parseEventTime(*update.EndTime, loc)
+            if err != nil {
+                return &mcp.CallToolResult{
+                    Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid end time format: %v", err)}},
+                    IsError: true,
+                }, nil, nil
+            }
+        case errS == nil && errE == nil:
+            // Moving the start keeps the event's duration.
+            end = start.Add(oldEnd.Sub(oldStart))
+        default:
+            end = start
+        }
+        if end.Before(start) {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: "End time must not be before start time"}},
+                IsError: true,
+            }, nil, nil
+        }
+
+        event.Props.Del(ical.PropDuration)
+        event.Props.SetDateTime(ical.PropDateTimeStart, start)
+        event.Props.SetDateTime(ical.PropDateTimeEnd, end)
+    }
+
+    setOrDelText(event, ical.PropSummary, update.Summary)
+    setOrDelText(event, ical.PropLocation, update.Location)
+    setOrDelText(event, ical.PropDescription, update.Description)
+
+    if update.Attendees != nil {
+        organizer, err := getEnv("ICLOUD_EMAIL")
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        setAttendees(event, organizer, update.Attendees)
+    }
+
+    touchComponent(event)
+
+    newObj, err := client.putCalendarObject(ctx, obj.Path, obj.Data, obj.ETag)
+    if err != nil {
+        if isConflict(err) {
+            return calDAVErrorResult("Event was modified elsewhere since it was fetched; fetch it again and retry", obj.Path, err)
+        }
+        return calDAVErrorResult("Failed to update event", obj.Path, err)
+    }
+
+    eventUID, _ := event.Props.Text(ical.PropUID)
+    out := calDAVObjectOutput{UID: eventUID, Path: newObj.Path, ETag: newObj.ETag}
+    result := fmt.Sprintf("Event updated.\n  UID: %s\n  Path: %s\n  ETag: %s\n", eventUID, newObj.Path, newObj.ETag)
+    if update.SendInvitations {
+        result += invitationStatus(obj.Data, true, &out)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// runDeleteCalendarObject implements delete_calendar_event and
+// delete_reminder; compType selects which of the two it operates on.
+func runDeleteCalendarObject(ctx context.Context, compType, calendar, uid, objPath string, dryRun bool) (*mcp.CallToolResult, any, error) {
+    urlEnv, kind := "ICLOUD_CALDAV_URL", "event"
+    if compType == ical.CompToDo {
+        urlEnv, kind = "ICLOUD_REMINDERS_URL", "reminder"
+    }
+
+    client, err := getCalDAVClient(ctx, urlEnv, compType, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    obj, err := client.findCalendarObject(ctx, compType, uid, objPath)
+    if err != nil {
+        return calDAVErrorResult(fmt.Sprintf("Failed to fetch %s", kind), objPath, err)
+    }
+
+    objUID := objectUID(obj.Data)
+    var summary string
+    if comp := masterComponent(obj.Data, compType); comp != nil {
+        summary, _ = comp.Props.Text(ical.PropSummary)
+    }
+    out := calDAVObjectOutput{UID: objUID, Path: obj.Path, ETag: obj.ETag}
+
+    if dryRun {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Dry run: would delete %s %q.\n  UID: %s\n  Path: %s\n  ETag: %s\n", kind, summary, objUID, obj.Path, obj.ETag)}},
+        }, out, nil
+    }
+
+    if err := client.deleteCalendarObject(ctx, obj.Path, obj.ETag); err != nil {
+        if isConflict(err) {
+            return calDAVErrorResult(fmt.Sprintf("The %s was modified elsewhere since it was fetched; fetch it again and retry", kind), obj.Path, err)
+        }
+        return calDAVErrorResult(fmt.Sprintf("Failed to delete %s", kind), obj.Path, err)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Deleted %s %q.\n  UID: %s\n  Path: %s\n", kind, summary, objUID, obj.Path)}},
+    }, out, nil
+}
+
+// setOrDelText sets the text property name on comp to *value, removing it
+// if the value is empty. A nil value leaves the property untouched.
+func setOrDelText(comp *ical.Component, name string, value *string) {
+    if value == nil {
+        return
+    }
+    if *value == "" {
+        comp.Props.Del(name)
+    } else {
+        comp.Props.SetText(name, *value)
+    }
+}
+
+// newReminderRequest holds the arguments of create_reminder.
+type newReminderRequest struct {
+    Title     string
+    DueDate   string
+    StartDate string
+    Priority  string
+    Notes     string
+    ParentUID string
+    Subtasks  []string
+    Alerts    []string
+}
+
+// parseReminderTime parses a time argument (see parseTimeArg). A date
+// without a time of day is for reminders due on a day rather than at a
+// time, and is returned as midnight UTC.
+func parseReminderTime(value string) (t time.Time, dateOnly bool, err error) {
+    t, dateOnly, err = parseTimeArg(value, nil)
+    if err != nil {
+        return time.Time{}, false, err
+    }
+    if dateOnly {
+        y, m, d := t.Date()
+        return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), true, nil
+    }
+    return t, false, nil
+}
+
+// setReminderTime sets the DUE or DTSTART property of todo from value.
+func setReminderTime(todo *ical.Component, name, value string) error {
+    t, dateOnly, err := parseReminderTime(value)
+    if err != nil {
+        return err
+    }
+    if dateOnly {
+        todo.Props.SetDate(name, t)
+    } else {
+        todo.Props.SetDateTime(name, t.UTC())
+    }
+    return nil
+}
+
+// reminderPriorities maps the priority names used by Apple Reminders to
+// iCalendar PRIORITY values.
+var reminderPriorities = map[string]int{
+    "none":   0,
+    "high":   1,
+    "medium": 5,
+    "low":    9,
+}
+
+// parsePriority parses a priority name or an iCalendar PRIORITY (0-9).
+func parsePriority(value string) (int, error) {
+    if p, ok := reminderPriorities[strings.ToLower(value)]; ok {
+        return p, nil
+    }
+    p, err := strconv.Atoi(value)
+    if err != nil || p < 0 || p > 9 {
+        return 0, fmt.Errorf("invalid priority %q: use high, medium, low, none or 0-9", value)
+    }
+    return p, nil
+}
+
+// priorityName returns the Apple Reminders name of an iCalendar PRIORITY.
+func priorityName(p int) string {
+    switch {
+    case p == 0:
+        return ""
+    case p < 5:
+        return "high"
+    case p == 5:
+        return "medium"
+    default:
+        return "low"
+    }
+}
+
+// relatedToParent returns a RELATED-TO property making a reminder a subtask
+// of the reminder with UID parentUID.
+func relatedToParent(parentUID string) *ical.Prop {
+    prop := ical.NewProp(ical.PropRelatedTo)
+    prop.Value = parentUID
+    prop.Params.Set(ical.ParamRelationshipType, "PARENT")
+    return prop
+}
+
+// parentUID returns the UID todo is a subtask of, if any. RELTYPE defaults
+// to PARENT.
+func parentUID(todo *ical.Component) string {
+    for _, prop := range todo.Props.Values(ical.PropRelatedTo) {
+        if reltype := prop.Params.Get(ical.ParamRelationshipType); reltype == "" || strings.EqualFold(reltype, "PARENT") {
+            return prop.Value
+        }
+    }
+    return ""
+}
+
+// newTodo builds the VTODO described by req.
+func newTodo(req newReminderRequest) (*ical.Component, error) {
+    todo := ical.NewComponent(ical.CompToDo)
+    todo.Props.SetText(ical.PropUID, uuid.NewString())
+    todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+    todo.Props.SetText(ical.PropSummary, req.Title)
+    todo.Props.SetText(ical.PropStatus, "NEEDS-ACTION")
+    if req.DueDate != "" {
+        if err := setReminderTime(todo, ical.PropDue, req.DueDate); err != nil {
+            return nil, fmt.Errorf("Invalid due date format: %v", err)
+        }
+    }
+    if req.StartDate != "" {
+        if err := setReminderTime(todo, ical.PropDateTimeStart, req.StartDate); err != nil {
+            return nil, fmt.Errorf("Invalid start date format: %v", err)
+        }
+    }
+    if req.Priority != "" {
+        priority, err := parsePriority(req.Priority)
+        if err != nil {
+            return nil, err
+        }
+        if priority > 0 {
+            prop := ical.NewProp(ical.PropPriority)
+            prop.Value = strconv.Itoa(priority)
+            todo.Props.Set(prop)
+        }
+    }
+    if req.Notes != "" {
+        todo.Props.SetText(ical.PropDescription, req.Notes)
+    }
+    if req.ParentUID != "" {
+        todo.Props.Set(relatedToParent(req.ParentUID))
+    }
+    if len(req.Alerts) > 0 {
+        // Relative alerts need something to be relative to: the start date
+        // if there is one, the due date otherwise.
+        hasStart := todo.Props.Get(ical.PropDateTimeStart) != nil
+        if !hasStart && todo.Props.Get(ical.PropDue) == nil {
+            for _, alert := range req.Alerts {
+                if isRelativeAlert(alert) {
+                    return nil, fmt.Errorf("Invalid alert %q: relative alerts need a due or start date", alert)
+                }
+            }
+        }
+        if err := addAlarms(todo, req.Alerts, !hasStart); err != nil {
+            return nil, fmt.Errorf("Invalid alert: %v", err)
+        }
+    }
+    return todo, nil
+}
+
+type createReminderOutput struct {
+    calDAVObjectOutput
+    Subtasks []calDAVObjectOutput `json:"subtasks,omitempty"`
+}
+
+func runCreateReminder(ctx context.Context, calendar string, req newReminderRequest) (*mcp.CallToolResult, any, error) {
+    todo, err := newTodo(req)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    client, err := getCalDAVClient(ctx, "ICLOUD_REMINDERS_URL", ical.CompToDo, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    // Apple Reminders only shows subtasks that live in the same list as
+    // their parent.
+    if req.ParentUID != "" {
+        if _, err := client.findCalendarObject(ctx, ical.CompToDo, req.ParentUID, ""); err != nil {
+            return calDAVErrorResult("Failed to find parent reminder in this list", "", err)
+        }
+    }
+
+    uid, _ := todo.Props.Text(ical.PropUID)
+    cal := newCalendar()
+    cal.Children = append(cal.Children, todo)
+
+    p := objectPath(client.collectionPath(), uid)
+    obj, err := client.putCalendarObject(ctx, p, cal, "")
+    if err != nil {
+        return calDAVErrorResult("Failed to create reminder", p, err)
+    }
+
+    out := createReminderOutput{calDAVObjectOutput: calDAVObjectOutput{UID: uid, Path: obj.Path, ETag: obj.ETag}}
+    result := fmt.Sprintf("Reminder created.\n  UID: %s\n  Path: %s\n  ETag: %s\n", uid, obj.Path, obj.ETag)
+
+    for _, title := range req.Subtasks {
+        subtask, _ := newTodo(newReminderRequest{Title: title, ParentUID: uid})
+        subUID, _ := subtask.Props.Text(ical.PropUID)
+        subCal := newCalendar()
+        subCal.Children = append(subCal.Children, subtask)
+
+        p := objectPath(client.collectionPath(), subUID)
+        subObj, err := client.putCalendarObject(ctx, p, subCal, "")
+        if err != nil {
+            result += fmt.Sprintf("Failed to create subtask %q: %v\n", title, err)
+            continue
+        }
+        out.Subtasks = append(out.Subtasks, calDAVObjectOutput{UID: subUID, Path: subObj.Path, ETag: subObj.ETag})
+        result += fmt.Sprintf("  Subtask: %s (UID %s)\n", title, subUID)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// runSetReminderCompleted marks a reminder as completed or, if completed is
+// false, as not completed again.
+func runSetReminderCompleted(ctx context.Context, calendar, uid, objPath string, completed bool) (*mcp.CallToolResult, any, error) {
+    client, err := getCalDAVClient(ctx, "ICLOUD_REMINDERS_URL", ical.CompToDo, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    obj, err := client.findCalendarObject(ctx, ical.CompToDo, uid, objPath)
+    if err != nil {
+        return calDAVErrorResult("Failed to find reminder", objPath, err)
+    }
+    todo := masterComponent(obj.Data, ical.CompToDo)
+    if todo == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No VTODO found in %s", obj.Path)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    percent := ical.NewProp(ical.PropPercentComplete)
+    if completed {
+        todo.Props.SetText(ical.PropStatus, "COMPLETED")
+        todo.Props.SetDateTime(ical.PropCompleted, time.Now().UTC())
+        percent.Value = "100"
+    } else {
+        todo.Props.SetText(ical.PropStatus, "NEEDS-ACTION")
+        todo.Props.Del(ical.PropCompleted)
+        percent.Value = "0"
+    }
+    todo.Props.Set(percent)
+    touchComponent(todo)
+
+    newObj, err := client.putCalendarObject(ctx, obj.Path, obj.Data, obj.ETag)
+    if err != nil {
+        if isConflict(err) {
+            return calDAVErrorResult("The reminder was modified on the server since it was fetched; list it again and retry", obj.Path, err)
+        }
+        return calDAVErrorResult("Failed to update reminder", obj.Path, err)
+    }
+
+    todoUID, _ := todo.Props.Text(ical.PropUID)
+    status := "completed"
+    if !completed {
+        status = "reopened"
+    }
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Reminder %s.\n  UID: %s\n  Path: %s\n  ETag: %s\n", status, todoUID, newObj.Path, newObj.ETag)}},
+    }, calDAVObjectOutput{UID: todoUID, Path: newObj.Path, ETag: newObj.ETag}, nil
+}
+
+// reminderOutput is a reminder in the structured output of list_reminders.
+type reminderOutput struct {
+    UID       string `json:"uid"`
+    Path      string `json:"path"`
+    ETag      string `json:"etag,omitempty"`
+    Summary   string `json:"summary"`
+    Status    string `json:"status,omitempty"`
+    Completed bool   `json:"completed"`
+    Overdue   bool   `json:"overdue,omitempty"`
+    Due       string `json:"due,omitempty"`
+    Start     string `json:"start,omitempty"`
+    Priority  string `json:"priority,omitempty"`
+    Notes     string `json:"notes,omitempty"`
+    ParentUID string   `json:"parent_uid,omitempty"`
+    Alerts    []string `json:"alerts,omitempty"`
+
+    Subtasks []reminderOutput `json:"subtasks,omitempty"`
+}
+
+type listRemindersOutput struct {
+    Reminders []reminderOutput `json:"reminders"`
+}
+
+// reminderFilters are the values of the filter argument of list_reminders.
+var reminderFilters = []string{"all", "incomplete", "completed", "overdue"}
+
+// reminderQuery returns the calendar query selecting the reminders for
+// filter. Only completed reminders are filtered by the server: a negated
+// text-match on STATUS doesn't match reminders without a STATUS, and
+// go-webdav's client can't send is-not-defined to select those, so
+// incomplete reminders are filtered by runListReminders alone.
+func reminderQuery(filter string) (*caldav.CalendarQuery, error) {
+    newQuery := func(propFilters ...caldav.PropFilter) *caldav.CalendarQuery {
+        return &caldav.CalendarQuery{
+            CompRequest: caldav.CalendarCompRequest{
+                Name: "VCALENDAR",
+                Comps: []caldav.CalendarCompRequest{
+                    {
+                        Name: "VTODO",
+                        Props: []string{"SUMMARY", "DUE", "DTSTART", "STATUS", "UID", "COMPLETED", "PERCENT-COMPLETE", "PRIORITY", "DESCRIPTION", "RELATED-TO", "RECURRENCE-ID"},
+                        Comps: []caldav.CalendarCompRequest{{Name: "VALARM", AllProps: true}},
+                    },
+                },
+            },
+            CompFilter: caldav.CompFilter{
+                Name: "VCALENDAR",
+                Comps: []caldav.CompFilter{
+                    {
+                        Name:  "VTODO",
+                        Props: propFilters,
+                    },
+                },
+            },
+        }
+    }
+
+    switch filter {
+    case "", "all", "incomplete", "overdue":
+        return newQuery(), nil
+    case "completed":
+        return newQuery(caldav.PropFilter{Name: "STATUS", TextMatch: &caldav.TextMatch{Text: "COMPLETED"}}), nil
+    default:
+        return nil, fmt.Errorf("invalid filter %q: use one of %s", filter, strings.Join(reminderFilters, ", "))
+    }
+}
+
+// newReminderOutput describes todo, stored in obj, as of now. Floating
+// times are read in loc.
+func newReminderOutput(obj caldav.CalendarObject, todo *ical.Component, now time.Time, loc *time.Location) reminderOutput {
+    out := reminderOutput{
+        UID:  objectUID(obj.Data),
+        Path: obj.Path,
+        ETag: obj.ETag,
+    }
+    out.Summary, _ = todo.Props.Text(ical.PropSummary)
+    out.Status, _ = todo.Props.Text(ical.PropStatus)
+    out.Notes, _ = todo.Props.Text(ical.PropDescription)
+    out.Completed = strings.EqualFold(out.Status, "COMPLETED") || todo.Props.Get(ical.PropCompleted) != nil
+    out.ParentUID = parentUID(todo)
+    out.Alerts = describeAlarms(todo)
+    if prop := todo.Props.Get(ical.PropPriority); prop != nil {
+        if p, err := strconv.Atoi(prop.Value); err == nil {
+            out.Priority = priorityName(p)
+        }
+    }
+
+    formatTime := func(prop *ical.Prop) (string, time.Time) {
+        t, err := prop.DateTime(loc)
+        if err != nil {
+            return prop.Value, time.Time{}
+        }
+        if prop.ValueType() == ical.ValueDate {
+            // A due date without time of day lasts until the end of it.
+            return t.Format(time.DateOnly), t.AddDate(0, 0, 1)
+        }
+        return t.Format(time.RFC3339), t
+    }
+    if prop := todo.Props.Get(ical.PropDue); prop != nil {
+        var due time.Time
+        out.Due, due = formatTime(prop)
+        out.Overdue = !out.Completed && !due.IsZero() && due.Before(now)
+    }
+    if prop := todo.Props.Get(ical.PropDateTimeStart); prop != nil {
+        out.Start, _ = formatTime(prop)
+    }
+    return out
+}
+
+// reminderTree nests subtasks under their parent reminders. Reminders whose
+// parent isn't in the list, for instance because a filter excluded it, stay
+// at the top level.
+func reminderTree(reminders []reminderOutput) []reminderOutput {
+    byUID := make(map[string]bool, len(reminders))
+    for _, r := range reminders {
+        byUID[r.UID] = true
+    }
+    children := make(map[string][]reminderOutput)
+    var roots []reminderOutput
+    for _, r := range reminders {
+        if r.ParentUID != "" && r.ParentUID != r.UID && byUID[r.ParentUID] {
+            children[r.ParentUID] = append(children[r.ParentUID], r)
+        } else {
+            roots = append(roots, r)
+        }
+    }
+
+    // visited guards against RELATED-TO cycles, which would otherwise leave
+    // reminders unreachable or recurse forever.
+    visited := make(map[string]bool)
+    var attach func(r reminderOutput) reminderOutput
+    attach = func(r reminderOutput) reminderOutput {
+        visited[r.UID] = true
+        for _, child := range children[r.UID] {
+            if !visited[child.UID] {
+                r.Subtasks = append(r.Subtasks, attach(child))
+            }
+        }
+        return r
+    }
+
+    tree := []reminderOutput{}
+    for _, r := range roots {
+        tree = append(tree, attach(r))
+    }
+    for _, r := range reminders {
+        if !visited[r.UID] {
+            tree = append(tree, attach(r))
+        }
+    }
+    return tree
+}
+
+// formatReminder renders reminder and its subtasks, indented by indent.
+func formatReminder(reminder reminderOutput, indent string) string {
+    result := fmt.Sprintf("%sFound object at %s\n", indent, reminder.Path)
+    result += fmt.Sprintf("%s  Summary: %s\n", indent, reminder.Summary)
+    if reminder.Status != "" {
+        result += fmt.Sprintf("%s  Status: %s\n", indent, reminder.Status)
+    }
+    if reminder.Due != "" {
+        if reminder.Overdue {
+            result += fmt.Sprintf("%s  Due: %s (overdue)\n", indent, reminder.Due)
+        } else {
+            result += fmt.Sprintf("%s  Due: %s\n", indent, reminder.Due)
+        }
+    }
+    if reminder.Start != "" {
+        result += fmt.Sprintf("%s  Start: %s\n", indent, reminder.Start)
+    }
+    if reminder.Priority != "" {
+        result += fmt.Sprintf("%s  Priority: %s\n", indent, reminder.Priority)
+    }
+    if reminder.Notes != "" {
+        result += fmt.Sprintf("%s  Notes: %s\n", indent, reminder.Notes)
+    }
+    if len(reminder.Alerts) > 0 {
+        result += fmt.Sprintf("%s  Alerts: %s\n", indent, strings.Join(reminder.Alerts, ", "))
+    }
+    if len(reminder.Subtasks) > 0 {
+        result += fmt.Sprintf("%s  Subtasks:\n", indent)
+        for _, subtask := range reminder.Subtasks {
+            result += formatReminder(subtask, indent+"    ")
+        }
+    }
+    return result
+}
+
+func runListReminders(ctx context.Context, calendar, filter string) (*mcp.CallToolResult, any, error) {
+    query, err := reminderQuery(filter)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    client, err := getCalDAVClient(ctx, "ICLOUD_REMINDERS_URL", ical.CompToDo, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+             Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+             IsError: true,
+        }, nil, nil
+    }
+
+    // Execute query
+    objs, err := client.QueryCalendar(ctx, "", query)
+    if err != nil {
+         return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query reminders: %v. Ensure the URL points to a Reminders collection.", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    loc, err := userLocation()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    now := time.Now()
+    var reminders []reminderOutput
+    for _, obj := range objs {
+        if obj.Data == nil {
+            continue
+        }
+        todo := masterComponent(obj.Data, ical.CompToDo)
+        if todo == nil {
+            continue
+        }
+        reminder := newReminderOutput(obj, todo, now, loc)
+
+        // Not every server implements prop-filters, so the filter is
+        // applied here as well.
+        switch filter {
+        case "completed":
+            if !reminder.Completed {
+                continue
+            }
+        case "incomplete":
+            if reminder.Completed {
+                continue
+            }
+        case "overdue":
+            if !reminder.Overdue {
+                continue
+            }
+        }
+        reminders = append(reminders, reminder)
+    }
+
+    out := listRemindersOutput{Reminders: reminderTree(reminders)}
+    var result string
+    for _, reminder := range out.Reminders {
+        result += formatReminder(reminder, "")
     }
 
     if result == "" {
@@ -281,5 +1693,5 @@ func runListReminders() (*mcp.CallToolResult, any, error) {
 
     return &mcp.CallToolResult{
         Content: []mcp.Content{&mcp.TextContent{Text: result}},
-    }, nil, nil
+    }, out, nil
 }
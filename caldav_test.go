@@ -0,0 +1,1431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// memBackend is an in-memory CalDAV backend with a calendar and a reminders
+// list, served by go-webdav.
+type memBackend struct {
+    mu   sync.Mutex
+    cals []caldav.Calendar
+    objs map[string]caldav.CalendarObject
+    n    int
+}
+
+func (b *memBackend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+    return "/user/", nil
+}
+
+func (b *memBackend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+    return "/user/calendars/", nil
+}
+
+func (b *memBackend) CreateCalendar(ctx context.Context, c *caldav.Calendar) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.cals = append(b.cals, *c)
+    return nil
+}
+
+func (b *memBackend) ListCalendars(ctx context.Context) ([]caldav.Calendar, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return append([]caldav.Calendar(nil), b.cals...), nil
+}
+
+func (b *memBackend) GetCalendar(ctx context.Context, p string) (*caldav.Calendar, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for _, c := range b.cals {
+        if c.Path == p {
+            return &c, nil
+        }
+    }
+    return nil, webdav.NewHTTPError(404, fmt.Errorf("no calendar %s", p))
+}
+
+func (b *memBackend) GetCalendarObject(ctx context.Context, p string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    obj, ok := b.objs[p]
+    if !ok {
+        return nil, webdav.NewHTTPError(404, fmt.Errorf("no object %s", p))
+    }
+    return &obj, nil
+}
+
+func (b *memBackend) ListCalendarObjects(ctx context.Context, p string, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    var objs []caldav.CalendarObject
+    for k, obj := range b.objs {
+        if path.Dir(k) == path.Clean(p) {
+            objs = append(objs, obj)
+        }
+    }
+    return objs, nil
+}
+
+func (b *memBackend) QueryCalendarObjects(ctx context.Context, p string, q *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+    objs, err := b.ListCalendarObjects(ctx, p, nil)
+    if err != nil {
+        return nil, err
+    }
+    return caldav.Filter(q, objs)
+}
+
+func (b *memBackend) PutCalendarObject(ctx context.Context, p string, cal *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.CalendarObject, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    old, exists := b.objs[p]
+    if opts.IfNoneMatch.IsSet() && exists {
+        return nil, webdav.NewHTTPError(412, fmt.Errorf("%s exists", p))
+    }
+    if opts.IfMatch.IsSet() {
+        if ok, _ := opts.IfMatch.MatchETag(old.ETag); !exists || !ok {
+            return nil, webdav.NewHTTPError(412, fmt.Errorf("ETag mismatch for %s", p))
+        }
+    }
+    var buf bytes.Buffer
+    if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+        return nil, webdav.NewHTTPError(400, err)
+    }
+    b.n++
+    obj := caldav.CalendarObject{Path: p, ModTime: time.Now(), ETag: fmt.Sprintf("etag-%d", b.n), Data: cal, ContentLength: int64(buf.Len())}
+    b.objs[p] = obj
+    return &obj, nil
+}
+
+func (b *memBackend) DeleteCalendarObject(ctx context.Context, p string) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if _, ok := b.objs[p]; !ok {
+        return webdav.NewHTTPError(404, fmt.Errorf("no object %s", p))
+    }
+    delete(b.objs, p)
+    return nil
+}
+
+// object returns the stored object at p, failing the test if there is none.
+func (b *memBackend) object(t *testing.T, p string) caldav.CalendarObject {
+    t.Helper()
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    obj, ok := b.objs[p]
+    if !ok {
+        t.Fatalf("no object stored at %s", p)
+    }
+    return obj
+}
+
+// store decodes the iCalendar text data and stores it at p, as another
+// client would.
+func (b *memBackend) store(t *testing.T, p, data string) caldav.CalendarObject {
+    t.Helper()
+    cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+    if err != nil {
+        t.Fatal(err)
+    }
+    obj, err := b.PutCalendarObject(context.Background(), p, cal, &caldav.PutCalendarObjectOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return *obj
+}
+
+func (b *memBackend) count() int {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return len(b.objs)
+}
+
+// startCalDAV serves a memBackend and points the CalDAV configuration at
+// it, with a private state directory.
+func startCalDAV(t *testing.T) *memBackend {
+    t.Helper()
+    return startCalDAVHandler(t, nil)
+}
+
+// startCalDAVHandler is startCalDAV with the server's handler passed
+// through wrap, if it isn't nil, so tests can intercept requests.
+func startCalDAVHandler(t *testing.T, wrap func(http.Handler) http.Handler) *memBackend {
+    t.Helper()
+    calendarDiscovery.homeSet, calendarDiscovery.calendars = "", nil
+    t.Cleanup(func() { calendarDiscovery.homeSet, calendarDiscovery.calendars = "", nil })
+
+    b := &memBackend{objs: make(map[string]caldav.CalendarObject)}
+    b.cals = []caldav.Calendar{
+        {Path: "/user/calendars/work/", Name: "Work", SupportedComponentSet: []string{ical.CompEvent}},
+        {Path: "/user/calendars/tasks/", Name: "Tasks", SupportedComponentSet: []string{ical.CompToDo}},
+    }
+    var h http.Handler = &caldav.Handler{Backend: b}
+    if wrap != nil {
+        h = wrap(h)
+    }
+    srv := httptest.NewServer(h)
+    t.Cleanup(srv.Close)
+
+    t.Setenv("ICLOUD_EMAIL", "me@example.com")
+    t.Setenv("ICLOUD_PASSWORD", "secret")
+    t.Setenv("ICLOUD_CALDAV_BASE_URL", srv.URL+"/")
+    t.Setenv("ICLOUD_CALDAV_URL", srv.URL+"/user/calendars/work/")
+    t.Setenv("ICLOUD_REMINDERS_URL", srv.URL+"/user/calendars/tasks/")
+    t.Setenv("ICLOUD_MCP_STATE_DIR", t.TempDir())
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "UTC")
+    return b
+}
+
+// resultText returns the text of a tool result, failing the test if the
+// result's error state isn't wantErr.
+func resultText(t *testing.T, res *mcp.CallToolResult, wantErr bool) string {
+    t.Helper()
+    var texts []string
+    for _, c := range res.Content {
+        if tc, ok := c.(*mcp.TextContent); ok {
+            texts = append(texts, tc.Text)
+        }
+    }
+    text := strings.Join(texts, "\n")
+    if res.IsError != wantErr {
+        t.Fatalf("IsError = %v, want %v: %s", res.IsError, wantErr, text)
+    }
+    return text
+}
+
+// storedEvent returns the master VEVENT of the object at p.
+func storedEvent(t *testing.T, b *memBackend, p string) *ical.Component {
+    t.Helper()
+    event := masterComponent(b.object(t, p).Data, ical.CompEvent)
+    if event == nil {
+        t.Fatalf("no VEVENT in %s", p)
+    }
+    return event
+}
+
+// storedTodo returns the master VTODO of the object at p.
+func storedTodo(t *testing.T, b *memBackend, p string) *ical.Component {
+    t.Helper()
+    todo := masterComponent(b.object(t, p).Data, ical.CompToDo)
+    if todo == nil {
+        t.Fatalf("no VTODO in %s", p)
+    }
+    return todo
+}
+
+func propValue(comp *ical.Component, name string) string {
+    if prop := comp.Props.Get(name); prop != nil {
+        return prop.Value
+    }
+    return ""
+}
+
+func TestCreateCalendarEvent(t *testing.T) {
+    b := startCalDAV(t)
+    ctx := context.Background()
+
+    res, out, err := runCreateCalendarEvent(ctx, "", newEventRequest{
+        Summary:   "Planning",
+        StartTime: "2025-07-01T10:00:00Z",
+        EndTime:   "2025-07-01T11:30:00Z",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    created, ok := out.(calDAVObjectOutput)
+    if !ok {
+        t.Fatalf("output is %T, want calDAVObjectOutput", out)
+    }
+    if want := "/user/calendars/work/" + created.UID + ".ics"; created.Path != want {
+        t.Errorf("path = %q, want %q", created.Path, want)
+    }
+
+    stored := b.object(t, created.Path)
+    if created.ETag != stored.ETag {
+        t.Errorf("ETag = %q, want %q", created.ETag, stored.ETag)
+    }
+    event := storedEvent(t, b, created.Path)
+    if got := propValue(event, ical.PropSummary); got != "Planning" {
+        t.Errorf("SUMMARY = %q", got)
+    }
+    if got := propValue(event, ical.PropUID); got != created.UID {
+        t.Errorf("UID = %q, want %q", got, created.UID)
+    }
+    if got := propValue(event, ical.PropDateTimeStart); got != "20250701T100000Z" {
+        t.Errorf("DTSTART = %q", got)
+    }
+    if got := propValue(event, ical.PropDateTimeEnd); got != "20250701T113000Z" {
+        t.Errorf("DTEND = %q", got)
+    }
+}
+
+func TestCreateCalendarEventInvalidTime(t *testing.T) {
+    b := startCalDAV(t)
+
+    res, _, err := runCreateCalendarEvent(context.Background(), "", newEventRequest{
+        Summary:   "Backwards",
+        StartTime: "2025-07-01T11:00:00Z",
+        EndTime:   "2025-07-01T10:00:00Z",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, true)
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) stored, want 0", n)
+    }
+}
+
+// createEvent creates an event and returns its UID and path.
+func createEvent(t *testing.T, req newEventRequest) calDAVObjectOutput {
+    t.Helper()
+    res, out, err := runCreateCalendarEvent(context.Background(), "", req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    return out.(calDAVObjectOutput)
+}
+
+func TestUpdateAllDayEvent(t *testing.T) {
+    b := startCalDAV(t)
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+    str := func(s string) *string { return &s }
+
+    tests := []struct {
+        name      string
+        lastDay   string
+        update    eventUpdate
+        wantStart string
+        wantEnd   string
+    }{
+        {"move start", "", eventUpdate{StartTime: str("2025-07-03")}, "20250703", "20250704"},
+        {"move start keeps days", "2025-07-02", eventUpdate{StartTime: str("2025-07-10")}, "20250710", "20250712"},
+        {"set last day", "", eventUpdate{EndTime: str("2025-07-05")}, "20250701", "20250706"},
+        {"time uses its date", "", eventUpdate{StartTime: str("2025-07-03T23:30:00+02:00")}, "20250703", "20250704"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            created := createEvent(t, newEventRequest{Summary: "Offsite", StartTime: "2025-07-01", EndTime: tt.lastDay, AllDay: true})
+
+            res, _, err := runUpdateCalendarEvent(context.Background(), "", created.UID, "", tt.update)
+            if err != nil {
+                t.Fatal(err)
+            }
+            resultText(t, res, false)
+
+            event := storedEvent(t, b, created.Path)
+            for _, c := range []struct{ name, want string }{
+                {ical.PropDateTimeStart, tt.wantStart},
+                {ical.PropDateTimeEnd, tt.wantEnd},
+            } {
+                prop := event.Props.Get(c.name)
+                if prop == nil {
+                    t.Fatalf("%s missing", c.name)
+                }
+                if prop.ValueType() != ical.ValueDate || prop.Value != c.want {
+                    t.Errorf("%s = %q (VALUE=%s), want date %q", c.name, prop.Value, prop.ValueType(), c.want)
+                }
+            }
+        })
+    }
+}
+
+func TestUpdateAllDayEventEndBeforeStart(t *testing.T) {
+    b := startCalDAV(t)
+    created := createEvent(t, newEventRequest{Summary: "Offsite", StartTime: "2025-07-05", AllDay: true})
+    end := "2025-07-01"
+
+    res, _, err := runUpdateCalendarEvent(context.Background(), "", created.UID, "", eventUpdate{EndTime: &end})
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, true)
+    if got := propValue(storedEvent(t, b, created.Path), ical.PropDateTimeEnd); got != "20250706" {
+        t.Errorf("DTEND = %q, want unchanged 20250706", got)
+    }
+}
+
+func TestUpdateTimedEventKeepsDuration(t *testing.T) {
+    b := startCalDAV(t)
+    created := createEvent(t, newEventRequest{Summary: "Call", StartTime: "2025-07-01T10:00:00Z", DurationMinutes: 45})
+    start := "2025-07-02T08:00:00Z"
+
+    res, _, err := runUpdateCalendarEvent(context.Background(), "", created.UID, "", eventUpdate{StartTime: &start})
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    event := storedEvent(t, b, created.Path)
+    if got := propValue(event, ical.PropDateTimeStart); got != "20250702T080000Z" {
+        t.Errorf("DTSTART = %q", got)
+    }
+    if got := propValue(event, ical.PropDateTimeEnd); got != "20250702T084500Z" {
+        t.Errorf("DTEND = %q", got)
+    }
+}
+
+func TestListRemindersFloatingTimes(t *testing.T) {
+    b := startCalDAV(t)
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+    b.store(t, "/user/calendars/tasks/floating.ics", "BEGIN:VCALENDAR\r\n"+
+        "VERSION:2.0\r\n"+
+        "PRODID:-//Example//Test//EN\r\n"+
+        "BEGIN:VTODO\r\n"+
+        "UID:floating\r\n"+
+        "DTSTAMP:20250601T000000Z\r\n"+
+        "SUMMARY:Call Bob\r\n"+
+        "DTSTART:20250701T080000\r\n"+
+        "DUE:20250701T090000\r\n"+
+        "END:VTODO\r\n"+
+        "END:VCALENDAR\r\n")
+
+    res, out, err := runListReminders(context.Background(), "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    reminders := out.(listRemindersOutput).Reminders
+    if len(reminders) != 1 {
+        t.Fatalf("reminders = %+v", reminders)
+    }
+    if r := reminders[0]; r.Due != "2025-07-01T09:00:00+02:00" || r.Start != "2025-07-01T08:00:00+02:00" {
+        t.Errorf("due = %s, start = %s, want them in ICLOUD_MCP_TIMEZONE", r.Due, r.Start)
+    }
+
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Mars/Olympus")
+    res, _, err = runListReminders(context.Background(), "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, true)
+}
+
+func TestAbsoluteAlertTimezone(t *testing.T) {
+    b := startCalDAV(t)
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+
+    created := createEvent(t, newEventRequest{
+        Summary:   "Flight",
+        StartTime: "2025-07-01T12:00:00Z",
+        EndTime:   "2025-07-01T14:00:00Z",
+        Alerts:    []string{"2025-07-01T09:00", "-15m"},
+    })
+    var triggers []string
+    for _, child := range storedEvent(t, b, created.Path).Children {
+        if child.Name == ical.CompAlarm {
+            triggers = append(triggers, propValue(child, ical.PropTrigger))
+        }
+    }
+    if got := strings.Join(triggers, ","); got != "20250701T070000Z,-PT15M" {
+        t.Errorf("triggers = %s", got)
+    }
+
+    // A reminder without dates can only have absolute alerts, in any form
+    // a time argument takes.
+    res, _, err := runCreateReminder(context.Background(), "", newReminderRequest{Title: "Pack", Alerts: []string{"2025-07-01 07:30"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    res, _, err = runCreateReminder(context.Background(), "", newReminderRequest{Title: "Pack", Alerts: []string{"-1h"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "relative alerts need a due or start date") {
+        t.Errorf("error = %q", text)
+    }
+    res, _, err = runCreateReminder(context.Background(), "", newReminderRequest{Title: "Pack", Alerts: []string{"whenever"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "cannot parse time") {
+        t.Errorf("error = %q", text)
+    }
+}
+
+func TestCreateEventTimezoneDefault(t *testing.T) {
+    b := startCalDAV(t)
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+
+    // Without a timezone argument, local times are in ICLOUD_MCP_TIMEZONE
+    // and stored in UTC.
+    created := createEvent(t, newEventRequest{Summary: "Lunch", StartTime: "2025-07-01T12:00", EndTime: "2025-07-01T13:00"})
+    event := storedEvent(t, b, created.Path)
+    if got := propValue(event, ical.PropDateTimeStart); got != "20250701T100000Z" {
+        t.Errorf("DTSTART = %s, want 20250701T100000Z", got)
+    }
+
+    created = createEvent(t, newEventRequest{Summary: "Call", StartTime: "2025-07-01T12:00", EndTime: "2025-07-01T13:00", Timezone: "America/New_York"})
+    prop := storedEvent(t, b, created.Path).Props.Get(ical.PropDateTimeStart)
+    if prop.Value != "20250701T120000" || prop.Params.Get(ical.ParamTimezoneID) != "America/New_York" {
+        t.Errorf("DTSTART = %s;TZID=%s, want 20250701T120000 in America/New_York", prop.Value, prop.Params.Get(ical.ParamTimezoneID))
+    }
+}
+
+// racePUT has another client write the object at the path of the next
+// PUT the server receives, once armed is set, before the PUT is handled.
+func racePUT(t *testing.T, b **memBackend, armed *atomic.Bool, data func() string) func(http.Handler) http.Handler {
+    return func(h http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method == http.MethodPut && armed.CompareAndSwap(true, false) {
+                (*b).store(t, r.URL.Path, data())
+            }
+            h.ServeHTTP(w, r)
+        })
+    }
+}
+
+// conflictOutput checks that res is a conflict error and returns its
+// structured content.
+func conflictOutput(t *testing.T, res *mcp.CallToolResult, out any) calDAVErrorOutput {
+    t.Helper()
+    resultText(t, res, true)
+    errOut, ok := out.(calDAVErrorOutput)
+    if !ok {
+        t.Fatalf("structured output = %#v, want calDAVErrorOutput", out)
+    }
+    if !errOut.Conflict || errOut.StatusCode != http.StatusPreconditionFailed {
+        t.Errorf("output = %+v, want a 412 conflict", errOut)
+    }
+    return errOut
+}
+
+func TestCreateEventConflict(t *testing.T) {
+    var b *memBackend
+    var armed atomic.Bool
+    armed.Store(true)
+    b = startCalDAVHandler(t, racePUT(t, &b, &armed, func() string { return testEvent("other", "Other") }))
+
+    res, out, err := runCreateCalendarEvent(context.Background(), "", newEventRequest{Summary: "Mine", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T10:00:00Z"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    errOut := conflictOutput(t, res, out)
+    if got := propValue(storedEvent(t, b, errOut.Path), ical.PropSummary); got != "Other" {
+        t.Errorf("stored SUMMARY = %q, the existing object was replaced", got)
+    }
+}
+
+func TestUpdateEventConflict(t *testing.T) {
+    var b *memBackend
+    var armed atomic.Bool
+    var created calDAVObjectOutput
+    b = startCalDAVHandler(t, racePUT(t, &b, &armed, func() string { return testEvent(created.UID, "Theirs") }))
+    created = createEvent(t, newEventRequest{Summary: "Original", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T10:00:00Z"})
+
+    // Another client changes the event after it was fetched.
+    armed.Store(true)
+    summary := "Mine"
+    res, out, err := runUpdateCalendarEvent(context.Background(), "", created.UID, "", eventUpdate{Summary: &summary})
+    if err != nil {
+        t.Fatal(err)
+    }
+    conflictOutput(t, res, out)
+    if text := resultText(t, res, true); !strings.Contains(text, "modified elsewhere") {
+        t.Errorf("error = %q", text)
+    }
+    if got := propValue(storedEvent(t, b, created.Path), ical.PropSummary); got != "Theirs" {
+        t.Errorf("stored SUMMARY = %q, the other client's change was overwritten", got)
+    }
+
+    // Fetching again picks up the new ETag, so a retry succeeds.
+    res, _, err = runUpdateCalendarEvent(context.Background(), "", created.UID, "", eventUpdate{Summary: &summary})
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if got := propValue(storedEvent(t, b, created.Path), ical.PropSummary); got != "Mine" {
+        t.Errorf("stored SUMMARY = %q after retrying", got)
+    }
+}
+
+// createReminder creates a reminder and returns its UID and path.
+func createReminder(t *testing.T, req newReminderRequest) createReminderOutput {
+    t.Helper()
+    res, out, err := runCreateReminder(context.Background(), "", req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    return out.(createReminderOutput)
+}
+
+func TestCreateReminder(t *testing.T) {
+    b := startCalDAV(t)
+
+    tests := []struct {
+        due      string
+        wantDue  string
+        wantDate bool
+    }{
+        {"2025-07-01T10:00:00Z", "20250701T100000Z", false},
+        {"2025-07-01T12:00:00+02:00", "20250701T100000Z", false},
+        {"2025-07-01", "20250701", true},
+        {"", "", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.due, func(t *testing.T) {
+            created := createReminder(t, newReminderRequest{Title: "Call Bob", DueDate: tt.due})
+            if want := "/user/calendars/tasks/" + created.UID + ".ics"; created.Path != want {
+                t.Errorf("path = %q, want %q", created.Path, want)
+            }
+            if stored := b.object(t, created.Path); created.ETag != stored.ETag {
+                t.Errorf("ETag = %q, want %q", created.ETag, stored.ETag)
+            }
+
+            todo := storedTodo(t, b, created.Path)
+            if got := propValue(todo, ical.PropUID); got != created.UID {
+                t.Errorf("UID = %q, want %q", got, created.UID)
+            }
+            if got := propValue(todo, ical.PropSummary); got != "Call Bob" {
+                t.Errorf("SUMMARY = %q", got)
+            }
+            if got := propValue(todo, ical.PropStatus); got != "NEEDS-ACTION" {
+                t.Errorf("STATUS = %q", got)
+            }
+            if todo.Props.Get(ical.PropDateTimeStamp) == nil {
+                t.Error("no DTSTAMP")
+            }
+            due := todo.Props.Get(ical.PropDue)
+            switch {
+            case tt.wantDue == "":
+                if due != nil {
+                    t.Errorf("DUE = %q, want none", due.Value)
+                }
+            case due == nil:
+                t.Errorf("no DUE, want %q", tt.wantDue)
+            case due.Value != tt.wantDue || (due.ValueType() == ical.ValueDate) != tt.wantDate:
+                t.Errorf("DUE = %q (VALUE=%s), want %q", due.Value, due.ValueType(), tt.wantDue)
+            }
+        })
+    }
+}
+
+func TestCreateReminderInvalidDueDate(t *testing.T) {
+    b := startCalDAV(t)
+
+    for _, due := range []string{"next blursday", "2025-02-30", "07/01/2025"} {
+        res, _, err := runCreateReminder(context.Background(), "", newReminderRequest{Title: "Call Bob", DueDate: due})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if text := resultText(t, res, true); !strings.Contains(text, "Invalid due date format") {
+            t.Errorf("error for %q = %q", due, text)
+        }
+    }
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) stored, want 0", n)
+    }
+}
+
+func TestCreateReminderDiscoversList(t *testing.T) {
+    b := startCalDAV(t)
+    // Without ICLOUD_REMINDERS_URL the first list holding VTODOs is used,
+    // not the first calendar.
+    t.Setenv("ICLOUD_REMINDERS_URL", "")
+
+    created := createReminder(t, newReminderRequest{Title: "Call Bob"})
+    if !strings.HasPrefix(created.Path, "/user/calendars/tasks/") {
+        t.Errorf("path = %q, want it in the Tasks list", created.Path)
+    }
+    storedTodo(t, b, created.Path)
+}
+
+// calendarColors answers the PROPFIND for Apple's calendar-color, which
+// go-webdav's server doesn't know, with colors keyed by collection path.
+func calendarColors(colors map[string]string) func(http.Handler) http.Handler {
+    return func(h http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method != "PROPFIND" {
+                h.ServeHTTP(w, r)
+                return
+            }
+            body, _ := io.ReadAll(r.Body)
+            if !strings.Contains(string(body), "calendar-color") {
+                r.Body = io.NopCloser(bytes.NewReader(body))
+                h.ServeHTTP(w, r)
+                return
+            }
+            var responses string
+            for p, color := range colors {
+                responses += fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop><a:calendar-color>%s</a:calendar-color></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, p, color)
+            }
+            w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+            w.WriteHeader(http.StatusMultiStatus)
+            fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/">%s</d:multistatus>`, responses)
+        })
+    }
+}
+
+func TestListCalendars(t *testing.T) {
+    b := startCalDAVHandler(t, calendarColors(map[string]string{
+        "/user/calendars/work/": "#FF2968FF",
+    }))
+    b.mu.Lock()
+    b.cals[0].Description = "Meetings and deadlines"
+    b.cals = append(b.cals, caldav.Calendar{Path: "/user/calendars/inbox/", Name: "Inbox", SupportedComponentSet: []string{ical.CompEvent, ical.CompToDo}})
+    b.mu.Unlock()
+
+    res, out, err := runListCalendars(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    calendars := out.(listCalendarsOutput).Calendars
+    if len(calendars) != 3 {
+        t.Fatalf("calendars = %+v", calendars)
+    }
+    byName := make(map[string]calendarInfo)
+    for _, cal := range calendars {
+        byName[cal.Name] = cal
+    }
+
+    work := byName["Work"]
+    if work.Path != "/user/calendars/work/" || work.Description != "Meetings and deadlines" || work.Color != "#FF2968FF" {
+        t.Errorf("Work = %+v", work)
+    }
+    if !work.SupportsEvents || work.SupportsTodos || strings.Join(work.Components, ",") != ical.CompEvent {
+        t.Errorf("Work components = %v, events %v, todos %v", work.Components, work.SupportsEvents, work.SupportsTodos)
+    }
+    tasks := byName["Tasks"]
+    if tasks.Path != "/user/calendars/tasks/" || tasks.SupportsEvents || !tasks.SupportsTodos || tasks.Color != "" {
+        t.Errorf("Tasks = %+v", tasks)
+    }
+    inbox := byName["Inbox"]
+    if !inbox.SupportsEvents || !inbox.SupportsTodos || strings.Join(inbox.Components, ",") != "VEVENT,VTODO" {
+        t.Errorf("Inbox = %+v", inbox)
+    }
+
+    for _, want := range []string{
+        "Work (events)\n  Path: /user/calendars/work/\n  Description: Meetings and deadlines\n  Color: #FF2968FF\n",
+        "Tasks (reminders)\n  Path: /user/calendars/tasks/\n",
+        "Inbox (events, reminders)\n",
+    } {
+        if !strings.Contains(text, want) {
+            t.Errorf("result doesn't contain %q:\n%s", want, text)
+        }
+    }
+}
+
+func TestListCalendarsDiscoveryFailure(t *testing.T) {
+    startCalDAV(t)
+    srv := httptest.NewServer(http.NotFoundHandler())
+    t.Cleanup(srv.Close)
+    t.Setenv("ICLOUD_CALDAV_BASE_URL", srv.URL+"/")
+
+    res, _, err := runListCalendars(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "Failed to discover calendars") {
+        t.Errorf("error = %q", text)
+    }
+}
+
+// addCalendars adds a Home event calendar and a Groceries reminder list to
+// b.
+func addCalendars(b *memBackend) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.cals = append(b.cals,
+        caldav.Calendar{Path: "/user/calendars/home/", Name: "Home", SupportedComponentSet: []string{ical.CompEvent}},
+        caldav.Calendar{Path: "/user/calendars/groceries/", Name: "Groceries", SupportedComponentSet: []string{ical.CompToDo}},
+    )
+}
+
+func TestNamedCalendar(t *testing.T) {
+    b := startCalDAV(t)
+    addCalendars(b)
+    ctx := context.Background()
+    req := newEventRequest{Summary: "Dinner", StartTime: "2025-07-01T18:00:00Z", EndTime: "2025-07-01T20:00:00Z"}
+
+    // The calendar is found by name, case-insensitively, by path or by
+    // URL, overriding ICLOUD_CALDAV_URL.
+    for _, calendar := range []string{"Home", "home", "/user/calendars/home", os.Getenv("ICLOUD_CALDAV_BASE_URL") + "user/calendars/home/"} {
+        res, out, err := runCreateCalendarEvent(ctx, calendar, req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resultText(t, res, false)
+        if p := out.(calDAVObjectOutput).Path; !strings.HasPrefix(p, "/user/calendars/home/") {
+            t.Errorf("created in %s with calendar %q, want Home", p, calendar)
+        }
+    }
+    work := createEvent(t, newEventRequest{Summary: "Standup", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T09:15:00Z"})
+    if !strings.HasPrefix(work.Path, "/user/calendars/work/") {
+        t.Errorf("created in %s without a calendar, want ICLOUD_CALDAV_URL", work.Path)
+    }
+
+    res, out, err := runListCalendarEvents(ctx, "Home", "2025-07-01", "2025-07-02")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    events := out.(listCalendarEventsOutput).Events
+    if len(events) != 4 {
+        t.Fatalf("events in Home = %+v", events)
+    }
+    for _, event := range events {
+        if event.Summary != "Dinner" {
+            t.Errorf("event %+v listed in Home", event)
+        }
+    }
+
+    res, out, err = runCreateReminder(ctx, "Groceries", newReminderRequest{Title: "Milk"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if p := out.(createReminderOutput).Path; !strings.HasPrefix(p, "/user/calendars/groceries/") {
+        t.Errorf("reminder created in %s, want Groceries", p)
+    }
+    createReminder(t, newReminderRequest{Title: "Call Bob"})
+
+    res, out, err = runListReminders(ctx, "groceries", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if reminders := out.(listRemindersOutput).Reminders; len(reminders) != 1 || reminders[0].Summary != "Milk" {
+        t.Errorf("reminders in Groceries = %+v", reminders)
+    }
+}
+
+func TestNamedCalendarErrors(t *testing.T) {
+    b := startCalDAV(t)
+    addCalendars(b)
+    ctx := context.Background()
+    req := newEventRequest{Summary: "Dinner", StartTime: "2025-07-01T18:00:00Z", EndTime: "2025-07-01T20:00:00Z"}
+
+    tests := []struct {
+        name string
+        run  func() (*mcp.CallToolResult, any, error)
+        want string
+    }{
+        {"unknown calendar", func() (*mcp.CallToolResult, any, error) {
+            return runCreateCalendarEvent(ctx, "Holidays", req)
+        }, `calendar "Holidays" not found; use list_calendars`},
+        {"event in a reminder list", func() (*mcp.CallToolResult, any, error) {
+            return runCreateCalendarEvent(ctx, "Groceries", req)
+        }, `calendar "Groceries" does not support VEVENT components`},
+        {"events of a reminder list", func() (*mcp.CallToolResult, any, error) {
+            return runListCalendarEvents(ctx, "Tasks", "", "")
+        }, `calendar "Tasks" does not support VEVENT components`},
+        {"reminder in a calendar", func() (*mcp.CallToolResult, any, error) {
+            return runCreateReminder(ctx, "Home", newReminderRequest{Title: "Milk"})
+        }, `calendar "Home" does not support VTODO components`},
+        {"reminders of a calendar", func() (*mcp.CallToolResult, any, error) {
+            return runListReminders(ctx, "Work", "")
+        }, `calendar "Work" does not support VTODO components`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := tt.run()
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) stored, want 0", n)
+    }
+}
+
+// deleteIfMatch refuses a DELETE whose If-Match doesn't name the stored
+// object's ETag, which go-webdav's server doesn't check. Once armed is set,
+// another client first rewrites the object at the path of the next DELETE.
+func deleteIfMatch(t *testing.T, b **memBackend, armed *atomic.Bool, data func() string) func(http.Handler) http.Handler {
+    return func(h http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method == http.MethodDelete {
+                if armed.CompareAndSwap(true, false) {
+                    (*b).store(t, r.URL.Path, data())
+                }
+                (*b).mu.Lock()
+                obj, ok := (*b).objs[r.URL.Path]
+                (*b).mu.Unlock()
+                if ifMatch := r.Header.Get("If-Match"); ok && ifMatch != quoteETag(obj.ETag) {
+                    http.Error(w, "ETag mismatch", http.StatusPreconditionFailed)
+                    return
+                }
+            }
+            h.ServeHTTP(w, r)
+        })
+    }
+}
+
+func TestDeleteCalendarObject(t *testing.T) {
+    var b *memBackend
+    var armed atomic.Bool
+    b = startCalDAVHandler(t, deleteIfMatch(t, &b, &armed, nil))
+    ctx := context.Background()
+    // text-match is a substring match; only the exact UID may be deleted.
+    b.store(t, "/user/calendars/work/meet.ics", testEvent("meet", "Meet"))
+    b.store(t, "/user/calendars/work/meeting.ics", testEvent("meeting", "Meeting"))
+    reminder := createReminder(t, newReminderRequest{Title: "Call Bob"})
+
+    tests := []struct {
+        name     string
+        compType string
+        uid      string
+        path     string
+        // want names the deleted object as the result does, e.g.
+        // `event "Meet"`.
+        want     string
+        wantPath string
+    }{
+        {"event by uid", ical.CompEvent, "meet", "", `event "Meet"`, "/user/calendars/work/meet.ics"},
+        {"event by path", ical.CompEvent, "", "/user/calendars/work/meeting.ics", `event "Meeting"`, "/user/calendars/work/meeting.ics"},
+        {"reminder by uid", ical.CompToDo, reminder.UID, "", `reminder "Call Bob"`, reminder.Path},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            etag := b.object(t, tt.wantPath).ETag
+
+            // A dry run only describes what would be deleted.
+            res, out, err := runDeleteCalendarObject(ctx, tt.compType, "", tt.uid, tt.path, true)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, false); !strings.HasPrefix(text, "Dry run: would delete "+tt.want) {
+                t.Errorf("dry run result = %q", text)
+            }
+            if got := out.(calDAVObjectOutput); got.Path != tt.wantPath || got.ETag != etag {
+                t.Errorf("dry run output = %+v, want path %s and ETag %s", got, tt.wantPath, etag)
+            }
+            b.object(t, tt.wantPath)
+
+            res, out, err = runDeleteCalendarObject(ctx, tt.compType, "", tt.uid, tt.path, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, false); !strings.HasPrefix(text, "Deleted "+tt.want) {
+                t.Errorf("result = %q", text)
+            }
+            if got := out.(calDAVObjectOutput); got.Path != tt.wantPath {
+                t.Errorf("output = %+v", got)
+            }
+            b.mu.Lock()
+            _, exists := b.objs[tt.wantPath]
+            b.mu.Unlock()
+            if exists {
+                t.Errorf("%s still exists", tt.wantPath)
+            }
+        })
+    }
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) left, want 0", n)
+    }
+}
+
+func TestDeleteCalendarObjectErrors(t *testing.T) {
+    b := startCalDAV(t)
+    ctx := context.Background()
+    event := createEvent(t, newEventRequest{Summary: "Planning", StartTime: "2025-07-01T10:00:00Z", EndTime: "2025-07-01T11:00:00Z"})
+
+    tests := []struct {
+        name     string
+        compType string
+        uid      string
+        path     string
+        want     string
+    }{
+        {"no uid or path", ical.CompEvent, "", "", "either uid or path is required"},
+        {"unknown uid", ical.CompEvent, "nope", "", "Failed to fetch event"},
+        {"uid prefix", ical.CompEvent, event.UID[:8], "", "Failed to fetch event"},
+        {"unknown path", ical.CompEvent, "", "/user/calendars/work/nope.ics", "Failed to fetch event"},
+        // Reminders are looked up in the reminder list.
+        {"event uid as reminder", ical.CompToDo, event.UID, "", "Failed to fetch reminder"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := runDeleteCalendarObject(ctx, tt.compType, "", tt.uid, tt.path, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+    storedEvent(t, b, event.Path)
+}
+
+func TestDeleteCalendarObjectConflict(t *testing.T) {
+    var b *memBackend
+    var armed atomic.Bool
+    var created calDAVObjectOutput
+    b = startCalDAVHandler(t, deleteIfMatch(t, &b, &armed, func() string { return testEvent(created.UID, "Theirs") }))
+    created = createEvent(t, newEventRequest{Summary: "Original", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T10:00:00Z"})
+
+    // Another client changes the event after it was fetched, so the
+    // If-Match of the DELETE no longer holds.
+    armed.Store(true)
+    res, out, err := runDeleteCalendarObject(context.Background(), ical.CompEvent, "", created.UID, "", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    conflictOutput(t, res, out)
+    if text := resultText(t, res, true); !strings.Contains(text, "modified elsewhere") {
+        t.Errorf("error = %q", text)
+    }
+    if got := propValue(storedEvent(t, b, created.Path), ical.PropSummary); got != "Theirs" {
+        t.Errorf("stored SUMMARY = %q, want the other client's change to survive", got)
+    }
+}
+
+func TestListCalendarEventsOutput(t *testing.T) {
+    b := startCalDAV(t)
+    header := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Test//EN\r\n"
+    b.store(t, "/user/calendars/work/review.ics", header+
+        "BEGIN:VEVENT\r\n"+
+        "UID:review\r\n"+
+        "DTSTAMP:20250601T000000Z\r\n"+
+        "SUMMARY:Review\r\n"+
+        "DTSTART;TZID=Europe/Berlin:20250701T100000\r\n"+
+        "DTEND;TZID=Europe/Berlin:20250701T113000\r\n"+
+        "LOCATION:Room 4\r\n"+
+        "DESCRIPTION:Bring the slides\r\n"+
+        "STATUS:CONFIRMED\r\n"+
+        "BEGIN:VALARM\r\n"+
+        "ACTION:DISPLAY\r\n"+
+        "DESCRIPTION:Review\r\n"+
+        "TRIGGER:-PT15M\r\n"+
+        "END:VALARM\r\n"+
+        "END:VEVENT\r\n"+
+        "END:VCALENDAR\r\n")
+    b.store(t, "/user/calendars/work/standup.ics", header+
+        "BEGIN:VEVENT\r\n"+
+        "UID:standup\r\n"+
+        "DTSTAMP:20250601T000000Z\r\n"+
+        "SUMMARY:Standup\r\n"+
+        "DTSTART:20250630T090000Z\r\n"+
+        "DURATION:PT15M\r\n"+
+        "RRULE:FREQ=DAILY;COUNT=5\r\n"+
+        "END:VEVENT\r\n"+
+        "END:VCALENDAR\r\n")
+    b.store(t, "/user/calendars/work/holiday.ics", header+
+        "BEGIN:VEVENT\r\n"+
+        "UID:holiday\r\n"+
+        "DTSTAMP:20250601T000000Z\r\n"+
+        "SUMMARY:Holiday\r\n"+
+        "DTSTART;VALUE=DATE:20250701\r\n"+
+        "DTEND;VALUE=DATE:20250703\r\n"+
+        "END:VEVENT\r\n"+
+        "END:VCALENDAR\r\n")
+
+    res, out, err := runListCalendarEvents(context.Background(), "", "2025-07-01", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    events := make(map[string]eventOutput)
+    for _, event := range out.(listCalendarEventsOutput).Events {
+        if _, ok := events[event.UID]; ok {
+            t.Errorf("%s listed more than once in a day", event.UID)
+        }
+        events[event.UID] = event
+    }
+
+    want := map[string]eventOutput{
+        "review": {
+            UID:         "review",
+            Path:        "/user/calendars/work/review.ics",
+            Summary:     "Review",
+            Start:       "2025-07-01T10:00:00+02:00",
+            End:         "2025-07-01T11:30:00+02:00",
+            Timezone:    "Europe/Berlin",
+            Location:    "Room 4",
+            Description: "Bring the slides",
+            Status:      "CONFIRMED",
+            Alerts:      []string{"15m before start"},
+        },
+        "standup": {
+            UID:       "standup",
+            Path:      "/user/calendars/work/standup.ics",
+            Summary:   "Standup",
+            Start:     "2025-07-01T09:00:00Z",
+            End:       "2025-07-01T09:15:00Z",
+            Timezone:  "UTC",
+            Recurring: true,
+        },
+        "holiday": {
+            UID:     "holiday",
+            Path:    "/user/calendars/work/holiday.ics",
+            Summary: "Holiday",
+            Start:   "2025-07-01",
+            End:     "2025-07-03",
+            AllDay:  true,
+        },
+    }
+    if len(events) != len(want) {
+        t.Errorf("events = %+v", events)
+    }
+    for uid, w := range want {
+        got, ok := events[uid]
+        if !ok {
+            t.Errorf("%s not listed", uid)
+            continue
+        }
+        // The ETag is whatever the server reports, but must be there.
+        if got.ETag == "" {
+            t.Errorf("%s has no ETag", uid)
+        }
+        w.ETag = got.ETag
+        if !reflect.DeepEqual(got, w) {
+            t.Errorf("%s = %+v, want %+v", uid, got, w)
+        }
+    }
+
+    for _, line := range []string{
+        "Event found at: /user/calendars/work/review.ics\n  Summary: Review\n  Start: 2025-07-01T10:00:00+02:00\n  End: 2025-07-01T11:30:00+02:00\n  Location: Room 4\n  Status: CONFIRMED\n  Alerts: 15m before start\n",
+        "  Summary: Standup\n  Start: 2025-07-01T09:00:00Z\n  End: 2025-07-01T09:15:00Z\n  Recurring: yes\n",
+        "  Start: 2025-07-01 (all day)\n  End: 2025-07-03\n",
+    } {
+        if !strings.Contains(text, line) {
+            t.Errorf("result doesn't contain %q:\n%s", line, text)
+        }
+    }
+
+    // Nothing in range is reported as such, with an empty list.
+    res, out, err = runListCalendarEvents(context.Background(), "", "2024-01-01", "2024-01-02")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, false); text != "No events found in the specified range." {
+        t.Errorf("result = %q", text)
+    }
+    if events := out.(listCalendarEventsOutput).Events; events == nil || len(events) != 0 {
+        t.Errorf("events = %#v, want an empty list", events)
+    }
+}
+
+func TestCreateReminderDetails(t *testing.T) {
+    b := startCalDAV(t)
+
+    created := createReminder(t, newReminderRequest{
+        Title:     "Call Bob",
+        DueDate:   "2025-07-02",
+        StartDate: "2025-07-01T09:00:00Z",
+        Priority:  "High",
+        Notes:     "About the offsite",
+    })
+    todo := storedTodo(t, b, created.Path)
+    for name, want := range map[string]string{
+        ical.PropPriority:      "1",
+        ical.PropDescription:   "About the offsite",
+        ical.PropDateTimeStart: "20250701T090000Z",
+        ical.PropDue:           "20250702",
+    } {
+        if got := propValue(todo, name); got != want {
+            t.Errorf("%s = %q, want %q", name, got, want)
+        }
+    }
+
+    // No priority, or priority none, stores no PRIORITY; numbers are kept.
+    for priority, want := range map[string]string{"": "", "none": "", "0": "", "medium": "5", "low": "9", "3": "3"} {
+        created := createReminder(t, newReminderRequest{Title: "Milk", Priority: priority})
+        if got := propValue(storedTodo(t, b, created.Path), ical.PropPriority); got != want {
+            t.Errorf("PRIORITY for %q = %q, want %q", priority, got, want)
+        }
+    }
+
+    n := b.count()
+    for _, req := range []newReminderRequest{
+        {Title: "Milk", Priority: "urgent"},
+        {Title: "Milk", Priority: "10"},
+        {Title: "Milk", StartDate: "someday"},
+    } {
+        res, _, err := runCreateReminder(context.Background(), "", req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if text := resultText(t, res, true); !strings.Contains(text, "invalid priority") && !strings.Contains(text, "Invalid start date format") {
+            t.Errorf("error for %+v = %q", req, text)
+        }
+    }
+    if b.count() != n {
+        t.Error("invalid reminders were stored")
+    }
+}
+
+func TestSetReminderCompleted(t *testing.T) {
+    b := startCalDAV(t)
+    ctx := context.Background()
+    created := createReminder(t, newReminderRequest{Title: "Call Bob"})
+
+    // By UID.
+    before := time.Now().UTC().Truncate(time.Second)
+    res, out, err := runSetReminderCompleted(ctx, "", created.UID, "", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, false); !strings.HasPrefix(text, "Reminder completed.") {
+        t.Errorf("result = %q", text)
+    }
+    todo := storedTodo(t, b, created.Path)
+    if got := propValue(todo, ical.PropStatus); got != "COMPLETED" {
+        t.Errorf("STATUS = %q", got)
+    }
+    if got := propValue(todo, ical.PropPercentComplete); got != "100" {
+        t.Errorf("PERCENT-COMPLETE = %q", got)
+    }
+    if completed, err := todo.Props.DateTime(ical.PropCompleted, nil); err != nil || completed.Before(before) {
+        t.Errorf("COMPLETED = %v (%v), want now", completed, err)
+    }
+    if got := out.(calDAVObjectOutput); got.ETag != b.object(t, created.Path).ETag {
+        t.Errorf("ETag = %q, want the new one", got.ETag)
+    }
+
+    // By path.
+    res, _, err = runSetReminderCompleted(ctx, "", "", created.Path, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, false); !strings.HasPrefix(text, "Reminder reopened.") {
+        t.Errorf("result = %q", text)
+    }
+    todo = storedTodo(t, b, created.Path)
+    if got := propValue(todo, ical.PropStatus); got != "NEEDS-ACTION" {
+        t.Errorf("STATUS = %q", got)
+    }
+    if got := propValue(todo, ical.PropPercentComplete); got != "0" {
+        t.Errorf("PERCENT-COMPLETE = %q", got)
+    }
+    if todo.Props.Get(ical.PropCompleted) != nil {
+        t.Error("COMPLETED kept after reopening")
+    }
+
+    res, _, err = runSetReminderCompleted(ctx, "", "nope", "", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "Failed to find reminder") {
+        t.Errorf("error = %q", text)
+    }
+}
+
+func TestListRemindersFilter(t *testing.T) {
+    b := startCalDAV(t)
+    storeTodo := func(uid, props string) {
+        b.store(t, "/user/calendars/tasks/"+uid+".ics", "BEGIN:VCALENDAR\r\n"+
+            "VERSION:2.0\r\n"+
+            "PRODID:-//Example//Test//EN\r\n"+
+            "BEGIN:VTODO\r\n"+
+            "UID:"+uid+"\r\n"+
+            "DTSTAMP:20250601T000000Z\r\n"+
+            "SUMMARY:"+uid+"\r\n"+
+            props+
+            "END:VTODO\r\n"+
+            "END:VCALENDAR\r\n")
+    }
+    storeTodo("done", "STATUS:COMPLETED\r\nCOMPLETED:20250601T100000Z\r\nDUE:20200101T000000Z\r\n")
+    storeTodo("late", "STATUS:NEEDS-ACTION\r\nDUE:20200101T000000Z\r\nPRIORITY:1\r\n")
+    storeTodo("later", "STATUS:IN-PROCESS\r\nDUE:20990101T000000Z\r\n")
+    // Without a STATUS, a reminder is incomplete.
+    storeTodo("plain", "DUE;VALUE=DATE:20200101\r\n")
+
+    tests := []struct {
+        filter string
+        want   []string
+    }{
+        {"", []string{"done", "late", "later", "plain"}},
+        {"all", []string{"done", "late", "later", "plain"}},
+        {"completed", []string{"done"}},
+        {"incomplete", []string{"late", "later", "plain"}},
+        {"overdue", []string{"late", "plain"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.filter, func(t *testing.T) {
+            res, out, err := runListReminders(context.Background(), "", tt.filter)
+            if err != nil {
+                t.Fatal(err)
+            }
+            text := resultText(t, res, false)
+            var got []string
+            for _, r := range out.(listRemindersOutput).Reminders {
+                got = append(got, r.UID)
+                if want := r.UID == "done"; r.Completed != want {
+                    t.Errorf("%s completed = %v", r.UID, r.Completed)
+                }
+                if want := r.UID == "late" || r.UID == "plain"; r.Overdue != want {
+                    t.Errorf("%s overdue = %v", r.UID, r.Overdue)
+                }
+            }
+            sort.Strings(got)
+            if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+                t.Errorf("reminders = %v, want %v", got, tt.want)
+            }
+            if slices.Contains(tt.want, "late") && !strings.Contains(text, "  Summary: late\n  Status: NEEDS-ACTION\n  Due: 2020-01-01T00:00:00Z (overdue)\n  Priority: high\n") {
+                t.Errorf("result doesn't describe late:\n%s", text)
+            }
+        })
+    }
+
+    res, out, err := runListReminders(context.Background(), "", "someday")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, `invalid filter "someday": use one of all, incomplete, completed, overdue`) {
+        t.Errorf("error = %q", text)
+    }
+    if out != nil {
+        t.Errorf("output = %+v, want none", out)
+    }
+}
+
+func TestCreateSubtasks(t *testing.T) {
+    b := startCalDAV(t)
+    addCalendars(b)
+    ctx := context.Background()
+
+    parent := createReminder(t, newReminderRequest{Title: "Shopping", Subtasks: []string{"Eggs", "Milk"}})
+    child := createReminder(t, newReminderRequest{Title: "Bread", ParentUID: parent.UID})
+    subtasks := append(parent.Subtasks, child.calDAVObjectOutput)
+    if len(subtasks) != 3 {
+        t.Fatalf("subtasks = %+v", parent.Subtasks)
+    }
+    if parentTodo := storedTodo(t, b, parent.Path); parentTodo.Props.Get(ical.PropRelatedTo) != nil {
+        t.Error("the parent has a RELATED-TO")
+    }
+    for i, title := range []string{"Eggs", "Milk", "Bread"} {
+        if !strings.HasPrefix(subtasks[i].Path, "/user/calendars/tasks/") {
+            t.Errorf("subtask %q stored at %s, want it in the parent's list", title, subtasks[i].Path)
+        }
+        todo := storedTodo(t, b, subtasks[i].Path)
+        if got := propValue(todo, ical.PropSummary); got != title {
+            t.Errorf("SUMMARY = %q, want %q", got, title)
+        }
+        related := todo.Props.Get(ical.PropRelatedTo)
+        if related == nil || related.Value != parent.UID || related.Params.Get(ical.ParamRelationshipType) != "PARENT" {
+            t.Errorf("RELATED-TO of %q = %+v, want the parent", title, related)
+        }
+    }
+
+    // The parent must be in the same list.
+    n := b.count()
+    for _, tt := range []struct{ calendar, parentUID string }{
+        {"", "nope"},
+        {"Groceries", "nope"},
+        {"Groceries", parent.UID},
+    } {
+        res, _, err := runCreateReminder(ctx, tt.calendar, newReminderRequest{Title: "Butter", ParentUID: tt.parentUID})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if text := resultText(t, res, true); !strings.HasPrefix(text, "Failed to find parent reminder in this list") {
+            t.Errorf("error for parent %q in %q = %q", tt.parentUID, tt.calendar, text)
+        }
+    }
+    if b.count() != n {
+        t.Error("subtasks of missing parents were stored")
+    }
+}
+
+func TestListRemindersTree(t *testing.T) {
+    b := startCalDAV(t)
+    storeTodo := func(uid, props string) {
+        b.store(t, "/user/calendars/tasks/"+uid+".ics", "BEGIN:VCALENDAR\r\n"+
+            "VERSION:2.0\r\n"+
+            "PRODID:-//Example//Test//EN\r\n"+
+            "BEGIN:VTODO\r\n"+
+            "UID:"+uid+"\r\n"+
+            "DTSTAMP:20250601T000000Z\r\n"+
+            "SUMMARY:"+uid+"\r\n"+
+            props+
+            "END:VTODO\r\n"+
+            "END:VCALENDAR\r\n")
+    }
+    storeTodo("trip", "STATUS:NEEDS-ACTION\r\n")
+    storeTodo("pack", "STATUS:NEEDS-ACTION\r\nRELATED-TO;RELTYPE=PARENT:trip\r\n")
+    // RELTYPE defaults to PARENT; other relations aren't nesting.
+    storeTodo("socks", "STATUS:COMPLETED\r\nRELATED-TO:pack\r\n")
+    storeTodo("tickets", "STATUS:COMPLETED\r\nRELATED-TO;RELTYPE=SIBLING:pack\r\nRELATED-TO;RELTYPE=PARENT:trip\r\n")
+    storeTodo("visa", "STATUS:NEEDS-ACTION\r\nRELATED-TO;RELTYPE=SIBLING:trip\r\n")
+    // A reminder that is its own parent, and a cycle.
+    storeTodo("self", "STATUS:NEEDS-ACTION\r\nRELATED-TO:self\r\n")
+    storeTodo("chicken", "STATUS:NEEDS-ACTION\r\nRELATED-TO:egg\r\n")
+    storeTodo("egg", "STATUS:NEEDS-ACTION\r\nRELATED-TO:chicken\r\n")
+
+    // tree renders reminders as "uid(subtasks...)", sorted.
+    var tree func(reminders []reminderOutput) string
+    tree = func(reminders []reminderOutput) string {
+        var names []string
+        for _, r := range reminders {
+            name := r.UID
+            if len(r.Subtasks) > 0 {
+                name += "(" + tree(r.Subtasks) + ")"
+            }
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        return strings.Join(names, " ")
+    }
+
+    tests := []struct {
+        filter string
+        want   string
+    }{
+        {"", "egg(chicken) self trip(pack(socks) tickets) visa"},
+        // Subtasks whose parent is filtered out are at the top level.
+        {"completed", "socks tickets"},
+        {"incomplete", "egg(chicken) self trip(pack) visa"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.filter, func(t *testing.T) {
+            res, out, err := runListReminders(context.Background(), "", tt.filter)
+            if err != nil {
+                t.Fatal(err)
+            }
+            resultText(t, res, false)
+            reminders := out.(listRemindersOutput).Reminders
+            // Which of the cycle is the root depends on the order the
+            // server lists them in.
+            got := strings.Replace(tree(reminders), "chicken(egg)", "egg(chicken)", 1)
+            if got != tt.want {
+                t.Errorf("tree = %s, want %s", got, tt.want)
+            }
+        })
+    }
+
+    res, _, err := runListReminders(context.Background(), "", "incomplete")
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    want := "Found object at /user/calendars/tasks/trip.ics\n" +
+        "  Summary: trip\n" +
+        "  Status: NEEDS-ACTION\n" +
+        "  Subtasks:\n" +
+        "    Found object at /user/calendars/tasks/pack.ics\n" +
+        "      Summary: pack\n" +
+        "      Status: NEEDS-ACTION\n"
+    if !strings.Contains(text, want) {
+        t.Errorf("result doesn't contain %q:\n%s", want, text)
+    }
+}
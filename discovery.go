@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// calendarDiscovery caches the calendars found via principal and home-set
+// discovery for the lifetime of the server process.
+var calendarDiscovery struct {
+    sync.Mutex
+    homeSet   string
+    calendars []caldav.Calendar
+    colors    map[string]string
+}
+
+// calDAVBaseURL returns the URL discovery starts from.
+func calDAVBaseURL() string {
+    if u := os.Getenv("ICLOUD_CALDAV_BASE_URL"); u != "" {
+        return u
+    }
+    return "https://caldav.icloud.com/"
+}
+
+// discoverCalendars finds the user's calendar collections as described in
+// RFC 6764 and RFC 4791: current-user-principal, then calendar-home-set,
+// then the collections inside the home set. The result is cached.
+func discoverCalendars(ctx context.Context, client *calDAVClient) ([]caldav.Calendar, error) {
+    calendarDiscovery.Lock()
+    defer calendarDiscovery.Unlock()
+
+    if calendarDiscovery.calendars != nil {
+        return calendarDiscovery.calendars, nil
+    }
+
+    homeSet := calendarDiscovery.homeSet
+    if homeSet == "" {
+        principal, err := client.FindCurrentUserPrincipal(ctx)
+        if err != nil {
+            // Servers that don't answer on the base URL are expected to
+            // redirect from the well-known location.
+            wellKnown, wkErr := client.withCollection("/.well-known/caldav")
+            if wkErr != nil {
+                return nil, err
+            }
+            principal, wkErr = wellKnown.FindCurrentUserPrincipal(ctx)
+            if wkErr != nil {
+                return nil, fmt.Errorf("failed to find current user principal: %v", err)
+            }
+        }
+
+        homeSet, err = client.FindCalendarHomeSet(ctx, principal)
+        if err != nil {
+            return nil, fmt.Errorf("failed to find calendar home set: %v", err)
+        }
+        log.Printf("Discovered calendar home set %s for principal %s", homeSet, principal)
+        calendarDiscovery.homeSet = homeSet
+    }
+
+    calendars, err := client.FindCalendars(ctx, homeSet)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list calendars: %v", err)
+    }
+
+    // Colors are cosmetic, so a server that can't report them shouldn't
+    // break discovery.
+    colors, err := findCalendarColors(ctx, client, homeSet)
+    if err != nil {
+        log.Printf("Failed to fetch calendar colors: %v", err)
+    }
+
+    calendarDiscovery.calendars = calendars
+    calendarDiscovery.colors = colors
+    return calendars, nil
+}
+
+// calendarColor returns the Apple calendar-color of the discovered calendar
+// at p, if known.
+func calendarColor(p string) string {
+    calendarDiscovery.Lock()
+    defer calendarDiscovery.Unlock()
+    return calendarDiscovery.colors[strings.TrimSuffix(p, "/")]
+}
+
+const calendarColorPropFind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/">
+  <d:prop><a:calendar-color/></d:prop>
+</d:propfind>`
+
+type calendarColorMultiStatus struct {
+    Responses []struct {
+        Href      string `xml:"DAV: href"`
+        PropStats []struct {
+            Prop struct {
+                Color string `xml:"http://apple.com/ns/ical/ calendar-color"`
+            } `xml:"DAV: prop"`
+        } `xml:"DAV: propstat"`
+    } `xml:"DAV: response"`
+}
+
+// findCalendarColors fetches the calendar-color property, which go-webdav's
+// FindCalendars doesn't request, for every collection in homeSet. The result
+// is keyed by collection path without a trailing slash.
+func findCalendarColors(ctx context.Context, client *calDAVClient, homeSet string) (map[string]string, error) {
+    req, err := client.newRequest(ctx, "PROPFIND", homeSet, strings.NewReader(calendarColorPropFind))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+    req.Header.Set("Depth", "1")
+
+    resp, err := client.do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusMultiStatus {
+        return nil, fmt.Errorf("PROPFIND %s: unexpected status %s", homeSet, resp.Status)
+    }
+
+    var ms calendarColorMultiStatus
+    if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+        return nil, err
+    }
+
+    colors := make(map[string]string)
+    for _, r := range ms.Responses {
+        u, err := url.Parse(r.Href)
+        if err != nil {
+            continue
+        }
+        for _, ps := range r.PropStats {
+            if ps.Prop.Color != "" {
+                colors[strings.TrimSuffix(u.Path, "/")] = strings.TrimSpace(ps.Prop.Color)
+            }
+        }
+    }
+    return colors, nil
+}
+
+// findCalendar returns the calendar in calendars whose display name
+// (case-insensitively) or path matches name. A full collection URL is
+// matched by its path.
+func findCalendar(calendars []caldav.Calendar, name string) (*caldav.Calendar, error) {
+    p := name
+    if u, err := url.Parse(name); err == nil && u.IsAbs() {
+        p = u.Path
+    }
+    p = strings.TrimSuffix(p, "/")
+
+    for i, cal := range calendars {
+        if strings.TrimSuffix(cal.Path, "/") == p {
+            return &calendars[i], nil
+        }
+    }
+    for i, cal := range calendars {
+        if strings.EqualFold(cal.Name, name) {
+            return &calendars[i], nil
+        }
+    }
+    return nil, fmt.Errorf("calendar %q not found; use list_calendars to see available calendars", name)
+}
+
+// supportsComponent reports whether cal accepts components of type compType.
+// A collection without a supported-calendar-component-set accepts any type.
+func supportsComponent(cal caldav.Calendar, compType string) bool {
+    if len(cal.SupportedComponentSet) == 0 {
+        return true
+    }
+    for _, comp := range cal.SupportedComponentSet {
+        if strings.EqualFold(comp, compType) {
+            return true
+        }
+    }
+    return false
+}
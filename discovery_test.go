@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+// requestLog records the method and path of the requests a test server
+// receives, as "PROPFIND /path". REPORTs are recorded with the name of
+// the report, as "REPORT calendar-multiget /path".
+type requestLog struct {
+    mu   sync.Mutex
+    reqs []string
+}
+
+func (l *requestLog) wrap(h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        req := r.Method + " " + r.URL.Path
+        if r.Method == "REPORT" {
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+            var root struct{ XMLName xml.Name }
+            xml.Unmarshal(body, &root)
+            req = r.Method + " " + root.XMLName.Local + " " + r.URL.Path
+        }
+        l.mu.Lock()
+        l.reqs = append(l.reqs, req)
+        l.mu.Unlock()
+        h.ServeHTTP(w, r)
+    })
+}
+
+// reset forgets the requests recorded so far.
+func (l *requestLog) reset() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.reqs = nil
+}
+
+func (l *requestLog) count(req string) int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    n := 0
+    for _, r := range l.reqs {
+        if r == req {
+            n++
+        }
+    }
+    return n
+}
+
+// startDiscovery serves a memBackend with no collection URLs configured,
+// so the calendar tools have to discover them from the base URL.
+func startDiscovery(t *testing.T, wrap func(http.Handler) http.Handler) {
+    t.Helper()
+    startCalDAVHandler(t, wrap)
+    t.Setenv("ICLOUD_CALDAV_URL", "")
+    t.Setenv("ICLOUD_REMINDERS_URL", "")
+}
+
+func TestDiscoverCollections(t *testing.T) {
+    var log requestLog
+    startDiscovery(t, log.wrap)
+
+    tests := []struct {
+        name     string
+        urlEnv   string
+        compType string
+        calendar string
+        want     string
+    }{
+        {"first event calendar", "ICLOUD_CALDAV_URL", ical.CompEvent, "", "/user/calendars/work/"},
+        {"first reminder list", "ICLOUD_REMINDERS_URL", ical.CompToDo, "", "/user/calendars/tasks/"},
+        {"by name", "ICLOUD_REMINDERS_URL", ical.CompToDo, "tasks", "/user/calendars/tasks/"},
+        {"by path", "ICLOUD_CALDAV_URL", ical.CompEvent, "/user/calendars/work", "/user/calendars/work/"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            client, err := getCalDAVClient(context.Background(), tt.urlEnv, tt.compType, tt.calendar)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := client.collectionPath(); got != tt.want {
+                t.Errorf("collection = %s, want %s", got, tt.want)
+            }
+        })
+    }
+
+    // Discovery ran once; later calls use the cached calendars.
+    if n := log.count("PROPFIND /"); n != 1 {
+        t.Errorf("%d principal lookup(s), want 1", n)
+    }
+    if n := log.count("PROPFIND /user/calendars/"); n != 2 {
+        t.Errorf("%d home set listing(s), want 2 (calendars and colors)", n)
+    }
+    if n := log.count("PROPFIND /.well-known/caldav"); n != 0 {
+        t.Errorf("well-known location queried %d time(s)", n)
+    }
+}
+
+func TestDiscoverCollectionsErrors(t *testing.T) {
+    startDiscovery(t, nil)
+
+    tests := []struct {
+        name     string
+        compType string
+        calendar string
+        want     string
+    }{
+        {"unknown calendar", ical.CompEvent, "Personal", `calendar "Personal" not found`},
+        {"wrong component", ical.CompToDo, "Work", `calendar "Work" does not support VTODO`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := getCalDAVClient(context.Background(), "ICLOUD_CALDAV_URL", tt.compType, tt.calendar)
+            if err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("err = %v, want it to contain %q", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestDiscoverWellKnown(t *testing.T) {
+    var log requestLog
+    startDiscovery(t, func(h http.Handler) http.Handler {
+        // The base URL isn't a DAV resource, as on servers that only
+        // answer below a prefix.
+        return log.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if strings.HasPrefix(r.URL.Path, "/dav") {
+                http.NotFound(w, r)
+                return
+            }
+            h.ServeHTTP(w, r)
+        }))
+    })
+    t.Setenv("ICLOUD_CALDAV_BASE_URL", strings.TrimSuffix(mustEnv(t, "ICLOUD_CALDAV_BASE_URL"), "/")+"/dav/")
+
+    client, err := getCalDAVClient(context.Background(), "ICLOUD_CALDAV_URL", ical.CompEvent, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := client.collectionPath(); got != "/user/calendars/work/" {
+        t.Errorf("collection = %s, want /user/calendars/work/", got)
+    }
+    if n := log.count("PROPFIND /.well-known/caldav"); n != 1 {
+        t.Errorf("well-known location queried %d time(s), want 1", n)
+    }
+}
+
+func TestDiscoveryFailure(t *testing.T) {
+    startDiscovery(t, func(h http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            http.Error(w, "no", http.StatusForbidden)
+        })
+    })
+
+    res, _, err := runListCalendarEvents(context.Background(), "", "2025-07-01", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "set ICLOUD_CALDAV_URL to skip discovery") {
+        t.Errorf("error = %q", text)
+    }
+}
+
+func mustEnv(t *testing.T, name string) string {
+    t.Helper()
+    v, err := getEnv(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return v
+}
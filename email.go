@@ -2,41 +2,65 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/smtp"
+	"os"
     "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-func runSendEmail(to, subject, body string) (*mcp.CallToolResult, any, error) {
+// smtpAddr returns the SMTP server to submit mail to.
+func smtpAddr() string {
+    if addr := os.Getenv("ICLOUD_SMTP_ADDR"); addr != "" {
+        return addr
+    }
+    return "smtp.mail.me.com:587"
+}
+
+// sendMail submits msg, which must already carry its headers, to the
+// recipients in to using the iCloud account's credentials.
+func sendMail(to []string, msg []byte) error {
     email, err := getEnv("ICLOUD_EMAIL")
     if err != nil {
+        return err
+    }
+    password, err := getEnv("ICLOUD_PASSWORD")
+    if err != nil {
+        return err
+    }
+
+    addr := smtpAddr()
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return fmt.Errorf("invalid SMTP address %q: %v", addr, err)
+    }
+
+    // Authentication
+    auth := smtp.PlainAuth("", email, password, host)
+    return smtp.SendMail(addr, auth, email, to, msg)
+}
+
+func runSendEmail(to, subject, body string) (*mcp.CallToolResult, any, error) {
+    if _, err := getEnv("ICLOUD_EMAIL"); err != nil {
         return &mcp.CallToolResult{
             Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
             IsError: true,
         }, nil, nil
     }
-    password, err := getEnv("ICLOUD_PASSWORD")
-    if err != nil {
+    if _, err := getEnv("ICLOUD_PASSWORD"); err != nil {
         return &mcp.CallToolResult{
             Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
             IsError: true,
         }, nil, nil
     }
 
-    smtpHost := "smtp.mail.me.com"
-    smtpPort := "587"
-
     // Message
     msg := []byte("To: " + to + "\r\n" +
         "Subject: " + subject + "\r\n" +
         "\r\n" +
         body + "\r\n")
 
-    // Authentication
-    auth := smtp.PlainAuth("", email, password, smtpHost)
-
     // Sending email
-    err = smtp.SendMail(smtpHost+":"+smtpPort, auth, email, []string{to}, msg)
-    if err != nil {
+    if err := sendMail([]string{to}, msg); err != nil {
         return &mcp.CallToolResult{
             Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to send email: %v", err)}},
             IsError: true,
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// timeInterval is a half-open interval [Start, End).
+type timeInterval struct {
+    Start time.Time
+    End   time.Time
+}
+
+// findFreeTimeRequest holds the arguments of find_free_time.
+type findFreeTimeRequest struct {
+    StartTime       string
+    EndTime         string
+    DurationMinutes int
+    WorkdayStart    string
+    WorkdayEnd      string
+    Timezone        string
+    IncludeWeekends bool
+    Calendars       []string
+    MaxResults      int
+}
+
+type freeSlot struct {
+    Start   string `json:"start"`
+    End     string `json:"end"`
+    Minutes int    `json:"minutes"`
+}
+
+// skippedEvent is a calendar object find_free_time couldn't read. The time
+// it may block is not counted as busy.
+type skippedEvent struct {
+    Path  string `json:"path"`
+    Error string `json:"error"`
+}
+
+type findFreeTimeOutput struct {
+    Timezone string         `json:"timezone"`
+    Slots    []freeSlot     `json:"slots"`
+    Skipped  []skippedEvent `json:"skipped,omitempty"`
+}
+
+// parseClock parses a "15:04" time of day into the offset from midnight.
+// "24:00" denotes the end of the day.
+func parseClock(value string) (time.Duration, error) {
+    if value == "24:00" {
+        return 24 * time.Hour, nil
+    }
+    t, err := time.Parse("15:04", value)
+    if err != nil {
+        return 0, fmt.Errorf("invalid time of day %q: expected HH:MM", value)
+    }
+    return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// isBusy reports whether event blocks time in the schedule of self.
+// Transparent and cancelled events, and events self declined, don't.
+func isBusy(event *ical.Component, self string) bool {
+    if transp, _ := event.Props.Text(ical.PropTransparency); strings.EqualFold(transp, "TRANSPARENT") {
+        return false
+    }
+    if status, _ := event.Props.Text(ical.PropStatus); strings.EqualFold(status, "CANCELLED") {
+        return false
+    }
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        if strings.EqualFold(addressEmail(prop.Value), self) &&
+            strings.EqualFold(prop.Params.Get(ical.ParamParticipationStatus), "DECLINED") {
+            return false
+        }
+    }
+    return true
+}
+
+// mergeIntervals sorts intervals and merges the overlapping and adjacent
+// ones.
+func mergeIntervals(intervals []timeInterval) []timeInterval {
+    sort.Slice(intervals, func(i, j int) bool {
+        return intervals[i].Start.Before(intervals[j].Start)
+    })
+    var merged []timeInterval
+    for _, in := range intervals {
+        if n := len(merged); n > 0 && !in.Start.After(merged[n-1].End) {
+            if in.End.After(merged[n-1].End) {
+                merged[n-1].End = in.End
+            }
+            continue
+        }
+        merged = append(merged, in)
+    }
+    return merged
+}
+
+// freeSlots returns the gaps of at least minDuration between the merged
+// busy intervals that fall within working hours in loc, between rangeStart
+// and rangeEnd.
+func freeSlots(busy []timeInterval, rangeStart, rangeEnd time.Time, loc *time.Location, workStart, workEnd, minDuration time.Duration, weekends bool) []timeInterval {
+    var slots []timeInterval
+    first := rangeStart.In(loc)
+    for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc); day.Before(rangeEnd); day = day.AddDate(0, 0, 1) {
+        if !weekends && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+            continue
+        }
+
+        // Working hours are wall clock times, so they are computed from the
+        // date rather than by adding durations across DST changes.
+        start := time.Date(day.Year(), day.Month(), day.Day(), 0, int(workStart.Minutes()), 0, 0, loc)
+        end := time.Date(day.Year(), day.Month(), day.Day(), 0, int(workEnd.Minutes()), 0, 0, loc)
+        if start.Before(rangeStart) {
+            start = rangeStart
+        }
+        if end.After(rangeEnd) {
+            end = rangeEnd
+        }
+
+        for _, b := range busy {
+            if !start.Before(end) {
+                break
+            }
+            if !b.End.After(start) || !b.Start.Before(end) {
+                continue
+            }
+            if b.Start.Sub(start) >= minDuration {
+                slots = append(slots, timeInterval{Start: start, End: b.Start})
+            }
+            if b.End.After(start) {
+                start = b.End
+            }
+        }
+        if end.Sub(start) >= minDuration {
+            slots = append(slots, timeInterval{Start: start, End: end})
+        }
+    }
+    return slots
+}
+
+// eventCalendars returns clients for the named calendars. If names is empty
+// it returns the calendar configured in ICLOUD_CALDAV_URL, or else every
+// discovered calendar holding events.
+func eventCalendars(ctx context.Context, names []string) ([]*calDAVClient, error) {
+    if len(names) > 0 {
+        var clients []*calDAVClient
+        for _, name := range names {
+            client, err := getCalDAVClient(ctx, "ICLOUD_CALDAV_URL", ical.CompEvent, name)
+            if err != nil {
+                return nil, err
+            }
+            clients = append(clients, client)
+        }
+        return clients, nil
+    }
+    if endpoint := os.Getenv("ICLOUD_CALDAV_URL"); endpoint != "" {
+        client, err := newCalDAVClient(endpoint)
+        if err != nil {
+            return nil, err
+        }
+        return []*calDAVClient{client}, nil
+    }
+
+    base, err := newCalDAVClient(calDAVBaseURL())
+    if err != nil {
+        return nil, err
+    }
+    calendars, err := discoverCalendars(ctx, base)
+    if err != nil {
+        return nil, fmt.Errorf("calendar discovery failed: %v (set ICLOUD_CALDAV_URL to skip discovery)", err)
+    }
+    var clients []*calDAVClient
+    for _, cal := range calendars {
+        if !supportsComponent(cal, ical.CompEvent) {
+            continue
+        }
+        client, err := base.withCollection(cal.Path)
+        if err != nil {
+            return nil, err
+        }
+        clients = append(clients, client)
+    }
+    if len(clients) == 0 {
+        return nil, fmt.Errorf("no calendar supporting %s found", ical.CompEvent)
+    }
+    return clients, nil
+}
+
+// busyIntervals returns the times between rangeStart and rangeEnd that the
+// events in client's calendar block for self, and the objects it couldn't
+// read. All-day events block whole days in loc. The events are expanded
+// locally rather than with a free-busy-query so that recurrences,
+// transparency and declined invitations are handled the same way on every
+// server.
+func busyIntervals(ctx context.Context, client *calDAVClient, rangeStart, rangeEnd time.Time, loc *time.Location, self string) ([]timeInterval, []skippedEvent, error) {
+    query := &caldav.CalendarQuery{
+        CompRequest: caldav.CalendarCompRequest{
+            Name: "VCALENDAR",
+            Comps: []caldav.CalendarCompRequest{
+                {
+                    Name: "VEVENT",
+                    Props: []string{"UID", "DTSTART", "DTEND", "DURATION", "STATUS", "TRANSP", "ATTENDEE", "RRULE", "RDATE", "EXDATE", "RECURRENCE-ID"},
+                },
+            },
+        },
+        CompFilter: caldav.CompFilter{
+            Name: "VCALENDAR",
+            Comps: []caldav.CompFilter{
+                {
+                    Name:  "VEVENT",
+                    Start: rangeStart,
+                    End:   rangeEnd,
+                },
+            },
+        },
+    }
+
+    objs, err := client.QueryCalendar(ctx, "", query)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var busy []timeInterval
+    var skipped []skippedEvent
+    for _, obj := range objs {
+        if obj.Data == nil {
+            skipped = append(skipped, skippedEvent{Path: obj.Path, Error: "no calendar data"})
+            continue
+        }
+        // Widen the range by a day so all-day events, which are expanded
+        // in UTC, aren't missed at the edges.
+        occurrences, err := expandEvents(obj.Data, rangeStart.AddDate(0, 0, -1), rangeEnd.AddDate(0, 0, 1))
+        if err != nil {
+            log.Printf("Skipping %s: %v", obj.Path, err)
+            skipped = append(skipped, skippedEvent{Path: obj.Path, Error: err.Error()})
+            continue
+        }
+        for _, occ := range occurrences {
+            if !isBusy(occ.Event, self) {
+                continue
+            }
+            start, end := occ.Start, occ.End
+            if occ.AllDay {
+                start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+                end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc)
+            }
+            if start.Before(rangeEnd) && end.After(rangeStart) {
+                busy = append(busy, timeInterval{Start: start, End: end})
+            }
+        }
+    }
+    return busy, skipped, nil
+}
+
+func runFindFreeTime(ctx context.Context, req findFreeTimeRequest) (*mcp.CallToolResult, any, error) {
+    if req.DurationMinutes <= 0 {
+        req.DurationMinutes = 30
+    }
+    if req.WorkdayStart == "" {
+        req.WorkdayStart = "09:00"
+    }
+    if req.WorkdayEnd == "" {
+        req.WorkdayEnd = "17:00"
+    }
+    if req.MaxResults <= 0 {
+        req.MaxResults = 20
+    }
+
+    loc, err := userLocation()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if req.Timezone != "" {
+        loc, err = time.LoadLocation(req.Timezone)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid timezone %q: %v", req.Timezone, err)}},
+                IsError: true,
+            }, nil, nil
+        }
+    }
+
+    rangeStart := time.Now()
+    if req.StartTime != "" {
+        t, err := parseEventTime(req.StartTime, loc)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid start_time: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        rangeStart = t
+    }
+    rangeEnd := rangeStart.AddDate(0, 0, 7)
+    if req.EndTime != "" {
+        t, dateOnly, err := parseTimeArg(req.EndTime, loc)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid end_time: %v", err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        // An end date includes the whole day.
+        if dateOnly {
+            t = t.AddDate(0, 0, 1)
+        }
+        rangeEnd = t.In(loc)
+    }
+    if !rangeEnd.After(rangeStart) {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "end_time must be after start_time"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    workStart, err := parseClock(req.WorkdayStart)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid workday_start: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    workEnd, err := parseClock(req.WorkdayEnd)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid workday_end: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if workEnd <= workStart {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "workday_end must be after workday_start"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    self, err := getEnv("ICLOUD_EMAIL")
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    clients, err := eventCalendars(ctx, req.Calendars)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    var busy []timeInterval
+    var skipped []skippedEvent
+    for _, client := range clients {
+        b, s, err := busyIntervals(ctx, client, rangeStart, rangeEnd, loc, self)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query events in %s: %v", client.collectionPath(), err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        busy = append(busy, b...)
+        skipped = append(skipped, s...)
+    }
+
+    minDuration := time.Duration(req.DurationMinutes) * time.Minute
+    slots := freeSlots(mergeIntervals(busy), rangeStart, rangeEnd, loc, workStart, workEnd, minDuration, req.IncludeWeekends)
+
+    out := findFreeTimeOutput{Timezone: loc.String(), Slots: []freeSlot{}, Skipped: skipped}
+    var result string
+    for i, slot := range slots {
+        if i == req.MaxResults {
+            result += fmt.Sprintf("... %d more slots\n", len(slots)-i)
+            break
+        }
+        s, e := slot.Start.In(loc), slot.End.In(loc)
+        out.Slots = append(out.Slots, freeSlot{
+            Start:   s.Format(time.RFC3339),
+            End:     e.Format(time.RFC3339),
+            Minutes: int(e.Sub(s).Minutes()),
+        })
+        result += fmt.Sprintf("Free: %s - %s (%d min)\n", s.Format("Mon 2006-01-02 15:04"), e.Format("15:04"), int(e.Sub(s).Minutes()))
+    }
+    if len(slots) == 0 {
+        result = fmt.Sprintf("No free slot of %d minutes found between %s and %s.", req.DurationMinutes, rangeStart.In(loc).Format(time.RFC3339), rangeEnd.In(loc).Format(time.RFC3339))
+    } else {
+        result = fmt.Sprintf("Free slots of at least %d minutes (%s):\n", req.DurationMinutes, loc) + result
+    }
+    if len(skipped) > 0 {
+        result += fmt.Sprintf("\nWarning: %d event(s) couldn't be read, so their time may be shown as free:\n", len(skipped))
+        for _, s := range skipped {
+            result += fmt.Sprintf("- %s: %s\n", s.Path, s.Error)
+        }
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+func TestMergeIntervals(t *testing.T) {
+    at := func(hour, min int) time.Time {
+        return time.Date(2025, 7, 1, hour, min, 0, 0, time.UTC)
+    }
+    in := func(h1, m1, h2, m2 int) timeInterval {
+        return timeInterval{Start: at(h1, m1), End: at(h2, m2)}
+    }
+
+    tests := []struct {
+        name string
+        in   []timeInterval
+        want []timeInterval
+    }{
+        {"empty", nil, nil},
+        {"disjoint", []timeInterval{in(9, 0, 10, 0), in(11, 0, 12, 0)}, []timeInterval{in(9, 0, 10, 0), in(11, 0, 12, 0)}},
+        {"overlapping", []timeInterval{in(9, 0, 10, 30), in(10, 0, 11, 0)}, []timeInterval{in(9, 0, 11, 0)}},
+        {"adjacent", []timeInterval{in(9, 0, 10, 0), in(10, 0, 11, 0)}, []timeInterval{in(9, 0, 11, 0)}},
+        {"contained", []timeInterval{in(9, 0, 12, 0), in(10, 0, 11, 0)}, []timeInterval{in(9, 0, 12, 0)}},
+        {"unsorted", []timeInterval{in(13, 0, 14, 0), in(9, 0, 10, 0), in(9, 30, 10, 15)}, []timeInterval{in(9, 0, 10, 15), in(13, 0, 14, 0)}},
+        {"chain", []timeInterval{in(9, 0, 10, 0), in(11, 0, 12, 0), in(9, 45, 11, 0)}, []timeInterval{in(9, 0, 12, 0)}},
+        {"empty interval", []timeInterval{in(9, 0, 10, 0), in(10, 0, 10, 0)}, []timeInterval{in(9, 0, 10, 0)}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := mergeIntervals(tt.in)
+            if len(got) != len(tt.want) {
+                t.Fatalf("merged = %v, want %v", got, tt.want)
+            }
+            for i := range got {
+                if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+                    t.Errorf("merged = %v, want %v", got, tt.want)
+                    break
+                }
+            }
+        })
+    }
+}
+
+// formatSlots formats intervals as "start/end" in RFC 3339, in loc.
+func formatSlots(slots []timeInterval, loc *time.Location) string {
+    var s []string
+    for _, slot := range slots {
+        s = append(s, slot.Start.In(loc).Format(time.RFC3339)+"/"+slot.End.In(loc).Format(time.RFC3339))
+    }
+    return strings.Join(s, " ")
+}
+
+func TestFreeSlots(t *testing.T) {
+    berlin, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatal(err)
+    }
+    at := func(month time.Month, day, hour, min int) time.Time {
+        return time.Date(2025, month, day, hour, min, 0, 0, berlin)
+    }
+    busy := func(month time.Month, day, h1, m1, h2, m2 int) timeInterval {
+        return timeInterval{Start: at(month, day, h1, m1), End: at(month, day, h2, m2)}
+    }
+
+    tests := []struct {
+        name                 string
+        busy                 []timeInterval
+        rangeStart, rangeEnd time.Time
+        workStart, workEnd   string
+        minutes              int
+        weekends             bool
+        want                 string
+    }{
+        {
+            name:       "free day",
+            rangeStart: at(7, 1, 0, 0), rangeEnd: at(7, 2, 0, 0),
+            workStart: "09:00", workEnd: "17:00", minutes: 30,
+            want: "2025-07-01T09:00:00+02:00/2025-07-01T17:00:00+02:00",
+        },
+        {
+            name:       "busy intervals split the day",
+            busy:       []timeInterval{busy(7, 1, 8, 0, 9, 30), busy(7, 1, 12, 0, 13, 0), busy(7, 1, 16, 45, 18, 0)},
+            rangeStart: at(7, 1, 0, 0), rangeEnd: at(7, 2, 0, 0),
+            workStart: "09:00", workEnd: "17:00", minutes: 30,
+            want: "2025-07-01T09:30:00+02:00/2025-07-01T12:00:00+02:00 2025-07-01T13:00:00+02:00/2025-07-01T16:45:00+02:00",
+        },
+        {
+            name:       "gaps shorter than the duration",
+            busy:       []timeInterval{busy(7, 1, 9, 20, 12, 0), busy(7, 1, 12, 45, 16, 0)},
+            rangeStart: at(7, 1, 0, 0), rangeEnd: at(7, 2, 0, 0),
+            workStart: "09:00", workEnd: "17:00", minutes: 60,
+            want: "2025-07-01T16:00:00+02:00/2025-07-01T17:00:00+02:00",
+        },
+        {
+            name:       "range inside working hours",
+            busy:       []timeInterval{busy(7, 1, 14, 0, 15, 0)},
+            rangeStart: at(7, 1, 10, 30), rangeEnd: at(7, 1, 15, 30),
+            workStart: "09:00", workEnd: "17:00", minutes: 30,
+            want: "2025-07-01T10:30:00+02:00/2025-07-01T14:00:00+02:00 2025-07-01T15:00:00+02:00/2025-07-01T15:30:00+02:00",
+        },
+        {
+            name:       "event spanning days",
+            busy:       []timeInterval{{Start: at(7, 1, 15, 0), End: at(7, 2, 11, 0)}},
+            rangeStart: at(7, 1, 0, 0), rangeEnd: at(7, 3, 0, 0),
+            workStart: "09:00", workEnd: "17:00", minutes: 30,
+            want: "2025-07-01T09:00:00+02:00/2025-07-01T15:00:00+02:00 2025-07-02T11:00:00+02:00/2025-07-02T17:00:00+02:00",
+        },
+        {
+            name:       "weekends skipped",
+            rangeStart: at(7, 4, 0, 0), rangeEnd: at(7, 8, 0, 0),
+            workStart: "09:00", workEnd: "10:00", minutes: 30,
+            want: "2025-07-04T09:00:00+02:00/2025-07-04T10:00:00+02:00 2025-07-07T09:00:00+02:00/2025-07-07T10:00:00+02:00",
+        },
+        {
+            // Summer time starts on Sunday 2025-03-30 at 02:00 in Berlin.
+            name:       "start of summer time",
+            busy:       []timeInterval{busy(3, 30, 11, 0, 12, 0)},
+            rangeStart: at(3, 29, 0, 0), rangeEnd: at(3, 31, 0, 0),
+            workStart: "09:00", workEnd: "17:00", minutes: 30, weekends: true,
+            want: "2025-03-29T09:00:00+01:00/2025-03-29T17:00:00+01:00 2025-03-30T09:00:00+02:00/2025-03-30T11:00:00+02:00 2025-03-30T12:00:00+02:00/2025-03-30T17:00:00+02:00",
+        },
+        {
+            // The night of the change is an hour shorter, and the working
+            // day still ends at midnight.
+            name:       "working hours over the change",
+            rangeStart: at(3, 29, 0, 0), rangeEnd: at(3, 31, 0, 0),
+            workStart: "00:00", workEnd: "24:00", minutes: 30, weekends: true,
+            want: "2025-03-29T00:00:00+01:00/2025-03-30T00:00:00+01:00 2025-03-30T00:00:00+01:00/2025-03-31T00:00:00+02:00",
+        },
+        {
+            // Summer time ends on Sunday 2025-10-26 at 03:00 in Berlin.
+            name:       "end of summer time",
+            busy:       []timeInterval{{Start: time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC), End: time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC)}},
+            rangeStart: at(10, 26, 0, 0), rangeEnd: at(10, 27, 0, 0),
+            workStart: "01:00", workEnd: "05:00", minutes: 30, weekends: true,
+            want: "2025-10-26T01:00:00+02:00/2025-10-26T02:30:00+02:00 2025-10-26T02:30:00+01:00/2025-10-26T05:00:00+01:00",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            workStart, err := parseClock(tt.workStart)
+            if err != nil {
+                t.Fatal(err)
+            }
+            workEnd, err := parseClock(tt.workEnd)
+            if err != nil {
+                t.Fatal(err)
+            }
+            slots := freeSlots(mergeIntervals(tt.busy), tt.rangeStart, tt.rangeEnd, berlin, workStart, workEnd, time.Duration(tt.minutes)*time.Minute, tt.weekends)
+            if got := formatSlots(slots, berlin); got != tt.want {
+                t.Errorf("slots:\n%s\nwant:\n%s", strings.ReplaceAll(got, " ", "\n"), strings.ReplaceAll(tt.want, " ", "\n"))
+            }
+        })
+    }
+}
+
+func TestIsBusy(t *testing.T) {
+    tests := []struct {
+        name  string
+        lines []string
+        want  bool
+    }{
+        {"plain", nil, true},
+        {"opaque", []string{"TRANSP:OPAQUE"}, true},
+        {"transparent", []string{"TRANSP:TRANSPARENT"}, false},
+        {"cancelled", []string{"STATUS:CANCELLED"}, false},
+        {"tentative", []string{"STATUS:TENTATIVE"}, true},
+        {"declined", []string{"ATTENDEE;PARTSTAT=DECLINED:mailto:Me@Example.com"}, false},
+        {"accepted", []string{"ATTENDEE;PARTSTAT=ACCEPTED:mailto:me@example.com"}, true},
+        {"declined by someone else", []string{"ATTENDEE;PARTSTAT=DECLINED:mailto:bob@example.com", "ATTENDEE:mailto:me@example.com"}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            event := decodeEvents(t, append([]string{"UID:x", "DTSTAMP:20250601T000000Z", "DTSTART:20250701T090000Z"}, tt.lines...)).Children[0]
+            if got := isBusy(event, "me@example.com"); got != tt.want {
+                t.Errorf("isBusy = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// freeBusyEvent is a VCALENDAR holding one VEVENT on 2025-07-01 from start
+// to end (as "15:04" in UTC), with the extra lines added to it.
+func freeBusyEvent(uid, start, end string, extra ...string) string {
+    day := "20250701T"
+    lines := []string{
+        "BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Test//EN",
+        "BEGIN:VEVENT",
+        "UID:" + uid,
+        "DTSTAMP:20250601T000000Z",
+        "DTSTART:" + day + strings.Replace(start, ":", "", 1) + "00Z",
+        "DTEND:" + day + strings.Replace(end, ":", "", 1) + "00Z",
+        "SUMMARY:" + uid,
+    }
+    lines = append(lines, extra...)
+    lines = append(lines, "END:VEVENT", "END:VCALENDAR", "")
+    return strings.Join(lines, "\r\n")
+}
+
+// startFreeBusy serves the Work calendar with a busy, a transparent and a
+// declined event on Tuesday 2025-07-01, and a Home calendar with one busy
+// event that day.
+func startFreeBusy(t *testing.T) *memBackend {
+    t.Helper()
+    b := startCalDAV(t)
+    b.mu.Lock()
+    b.cals = append(b.cals, caldav.Calendar{Path: "/user/calendars/home/", Name: "Home", SupportedComponentSet: []string{ical.CompEvent}})
+    b.mu.Unlock()
+
+    b.store(t, "/user/calendars/work/busy.ics", freeBusyEvent("busy", "10:00", "11:00"))
+    b.store(t, "/user/calendars/work/free.ics", freeBusyEvent("free", "12:00", "13:00", "TRANSP:TRANSPARENT"))
+    b.store(t, "/user/calendars/work/declined.ics", freeBusyEvent("declined", "14:00", "15:00",
+        "ORGANIZER:mailto:alice@example.com",
+        "ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com",
+        "ATTENDEE;PARTSTAT=DECLINED:mailto:me@example.com"))
+    b.store(t, "/user/calendars/home/dentist.ics", freeBusyEvent("dentist", "15:30", "16:00"))
+    return b
+}
+
+func findFreeTime(t *testing.T, calendars ...string) (string, findFreeTimeOutput) {
+    t.Helper()
+    res, out, err := runFindFreeTime(context.Background(), findFreeTimeRequest{
+        StartTime:       "2025-07-01T00:00:00Z",
+        EndTime:         "2025-07-01",
+        DurationMinutes: 30,
+        Calendars:       calendars,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    return text, out.(findFreeTimeOutput)
+}
+
+func slotList(out findFreeTimeOutput) string {
+    var s []string
+    for _, slot := range out.Slots {
+        s = append(s, slot.Start+"/"+slot.End)
+    }
+    return strings.Join(s, " ")
+}
+
+func TestFindFreeTime(t *testing.T) {
+    startFreeBusy(t)
+
+    // ICLOUD_CALDAV_URL names the Work calendar.
+    _, out := findFreeTime(t)
+    if want := "2025-07-01T09:00:00Z/2025-07-01T10:00:00Z 2025-07-01T11:00:00Z/2025-07-01T17:00:00Z"; slotList(out) != want {
+        t.Errorf("slots = %s, want %s", slotList(out), want)
+    }
+    if out.Timezone != "UTC" || len(out.Skipped) != 0 {
+        t.Errorf("output = %+v", out)
+    }
+
+    _, out = findFreeTime(t, "Home", "Work")
+    if want := "2025-07-01T09:00:00Z/2025-07-01T10:00:00Z 2025-07-01T11:00:00Z/2025-07-01T15:30:00Z 2025-07-01T16:00:00Z/2025-07-01T17:00:00Z"; slotList(out) != want {
+        t.Errorf("slots = %s, want %s", slotList(out), want)
+    }
+
+    // Without ICLOUD_CALDAV_URL every event calendar is discovered.
+    t.Setenv("ICLOUD_CALDAV_URL", "")
+    _, out = findFreeTime(t)
+    if want := "2025-07-01T09:00:00Z/2025-07-01T10:00:00Z 2025-07-01T11:00:00Z/2025-07-01T15:30:00Z 2025-07-01T16:00:00Z/2025-07-01T17:00:00Z"; slotList(out) != want {
+        t.Errorf("slots = %s, want %s", slotList(out), want)
+    }
+}
+
+func TestFindFreeTimeUnreadableEvent(t *testing.T) {
+    b := startFreeBusy(t)
+    // The server accepts the object, but its override has an invalid
+    // RECURRENCE-ID, so it can't be expanded.
+    b.store(t, "/user/calendars/work/broken.ics", strings.Replace(freeBusyEvent("broken", "16:00", "17:00"),
+        "END:VCALENDAR", "BEGIN:VEVENT\r\nUID:broken\r\nDTSTAMP:20250601T000000Z\r\nRECURRENCE-ID:someday\r\nDTSTART:20250701T160000Z\r\nEND:VEVENT\r\nEND:VCALENDAR", 1))
+
+    text, out := findFreeTime(t)
+    if len(out.Skipped) != 1 || out.Skipped[0].Path != "/user/calendars/work/broken.ics" || !strings.Contains(out.Skipped[0].Error, "RECURRENCE-ID") {
+        t.Fatalf("skipped = %+v", out.Skipped)
+    }
+    if !strings.Contains(text, "Warning: 1 event(s) couldn't be read") || !strings.Contains(text, "/user/calendars/work/broken.ics") {
+        t.Errorf("result doesn't warn about the unreadable event:\n%s", text)
+    }
+    // The rest of the calendar is still taken into account.
+    if want := "2025-07-01T09:00:00Z/2025-07-01T10:00:00Z 2025-07-01T11:00:00Z/2025-07-01T17:00:00Z"; slotList(out) != want {
+        t.Errorf("slots = %s, want %s", slotList(out), want)
+    }
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// attachmentInfo describes an attachment in tool output. Part is the IMAP
+// section path of the attachment, such as "2" or "1.3".
+type attachmentInfo struct {
+    Part     string `json:"part"`
+    Filename string `json:"filename,omitempty"`
+    MIMEType string `json:"mime_type"`
+    Size     uint32 `json:"size"`
+}
+
+// partName formats an IMAP part path as a section path.
+func partName(path []int) string {
+    parts := make([]string, len(path))
+    for i, n := range path {
+        parts[i] = fmt.Sprint(n)
+    }
+    return strings.Join(parts, ".")
+}
+
+// messageAttachments lists the attachments in a message's BODYSTRUCTURE:
+// the parts marked as attachments or carrying a filename, and any other
+// part that isn't text or multipart, such as inline images. Sizes are those
+// of the encoded parts.
+func messageAttachments(bs *imap.BodyStructure) []attachmentInfo {
+    attachments := []attachmentInfo{}
+    if bs == nil {
+        return attachments
+    }
+    bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+        if strings.EqualFold(part.MIMEType, "multipart") {
+            return true
+        }
+        filename, _ := part.Filename()
+        if !strings.EqualFold(part.Disposition, "attachment") && filename == "" && strings.EqualFold(part.MIMEType, "text") {
+            return false
+        }
+        attachments = append(attachments, attachmentInfo{
+            Part:     partName(path),
+            Filename: filename,
+            MIMEType: strings.ToLower(part.MIMEType + "/" + part.MIMESubType),
+            Size:     part.Size,
+        })
+        return false
+    })
+    return attachments
+}
+
+// headerField is a message header field with its value decoded.
+type headerField struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+type getEmailOutput struct {
+    Mailbox     string           `json:"mailbox"`
+    UIDValidity uint32           `json:"uid_validity"`
+    Message     emailSummary     `json:"message"`
+    Headers     []headerField    `json:"headers"`
+    Body        string           `json:"body"`
+    Attachments []attachmentInfo `json:"attachments"`
+}
+
+// runGetEmail fetches the message with the given UID, without marking it as
+// seen, and returns its headers, its whole decoded body and its attachments.
+func runGetEmail(mailbox string, uid, uidValidity uint32) (*mcp.CallToolResult, any, error) {
+    if mailbox == "" {
+        mailbox = "INBOX"
+    }
+    if uid == 0 {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "uid is required"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    c, err := dialIMAP()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    defer c.Logout()
+
+    mailbox, mbox, err := selectMailbox(c, mailbox, uidValidity)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uid)
+    section := &imap.BodySectionName{Peek: true}
+    items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchUid, imap.FetchBodyStructure, section.FetchItem()}
+
+    messages := make(chan *imap.Message, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, items, messages)
+    }()
+
+    var msg *imap.Message
+    var raw []byte
+    var readErr error
+    for m := range messages {
+        msg = m
+        if r := m.GetBody(section); r != nil {
+            raw, readErr = ioutil.ReadAll(r)
+        }
+    }
+    if err := <-done; err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to fetch message: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if readErr != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to read message: %v", readErr)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if msg == nil || raw == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No message with UID %d in mailbox '%s'", uid, mailbox)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    out := getEmailOutput{
+        Mailbox:     mailbox,
+        UIDValidity: mbox.UidValidity,
+        Message:     newEmailSummary(msg),
+        Headers:     []headerField{},
+        Attachments: messageAttachments(msg.BodyStructure),
+    }
+
+    entity, err := message.Read(bytes.NewReader(raw))
+    if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to parse message: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    fields := entity.Header.Fields()
+    for fields.Next() {
+        value, err := fields.Text()
+        if err != nil {
+            value = fields.Value()
+        }
+        out.Headers = append(out.Headers, headerField{Name: fields.Key(), Value: value})
+    }
+    out.Body, err = messageText(bytes.NewReader(raw))
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to decode message body: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    result := fmt.Sprintf("Mailbox: %s (UIDVALIDITY %d)\nUID: %d\n", mailbox, mbox.UidValidity, uid)
+    if len(out.Message.Flags) > 0 {
+        result += fmt.Sprintf("Flags: %s\n", strings.Join(out.Message.Flags, " "))
+    }
+    result += "---\n"
+    for _, field := range out.Headers {
+        result += fmt.Sprintf("%s: %s\n", field.Name, field.Value)
+    }
+    result += "---\n" + out.Body + "\n"
+    if len(out.Attachments) > 0 {
+        result += "---\nAttachments (fetch them with get_attachment):\n"
+        for _, att := range out.Attachments {
+            name := att.Filename
+            if name == "" {
+                name = "(unnamed)"
+            }
+            result += fmt.Sprintf("Part %s: %s (%s, %d bytes)\n", att.Part, name, att.MIMEType, att.Size)
+        }
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
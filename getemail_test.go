@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// attachmentMail has an encoded From and Subject, a plain and HTML body
+// (part 1), a PDF attachment (part 2), an unnamed inline image (part 3)
+// and a text attachment (part 4).
+const attachmentMail = "From: =?utf-8?q?J=C3=BCrgen?= <j@example.com>\r\n" +
+    "To: me@example.com\r\n" +
+    "Subject: =?utf-8?b?8J+TjiBmaWxlcw==?=\r\n" +
+    "Date: Mon, 02 Jun 2025 15:04:05 +0000\r\n" +
+    "MIME-Version: 1.0\r\n" +
+    "Content-Type: multipart/mixed; boundary=XX\r\n" +
+    "\r\n" +
+    "--XX\r\n" +
+    "Content-Type: multipart/alternative; boundary=YY\r\n" +
+    "\r\n" +
+    "--YY\r\n" +
+    "Content-Type: text/plain; charset=utf-8\r\n" +
+    "\r\n" +
+    "Hello there\r\n" +
+    "--YY\r\n" +
+    "Content-Type: text/html\r\n" +
+    "\r\n" +
+    "<p>Hello there</p>\r\n" +
+    "--YY--\r\n" +
+    "--XX\r\n" +
+    "Content-Type: application/pdf; name=\"r.pdf\"\r\n" +
+    "Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+    "Content-Transfer-Encoding: base64\r\n" +
+    "\r\n" +
+    "JVBERi0xLjQKJcOkw7zDtsOfCg==\r\n" +
+    "--XX\r\n" +
+    "Content-Type: image/png\r\n" +
+    "Content-Disposition: inline\r\n" +
+    "Content-Transfer-Encoding: base64\r\n" +
+    "\r\n" +
+    "iVBORw0KGgo=\r\n" +
+    "--XX\r\n" +
+    "Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+    "Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+    "\r\n" +
+    "some notes\r\n" +
+    "--XX--\r\n"
+
+// attachmentUID is the IMAP UID of attachmentMail in startIMAP's INBOX.
+const attachmentUID = 7
+
+func TestGetEmail(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    res, out, err := runGetEmail("", attachmentUID, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    email := out.(getEmailOutput)
+    if email.Mailbox != "INBOX" || email.UIDValidity == 0 {
+        t.Errorf("mailbox = %q, uid_validity = %d", email.Mailbox, email.UIDValidity)
+    }
+    msg := email.Message
+    if msg.UID != attachmentUID || msg.Subject != "📎 files" || msg.From != "Jürgen <j@example.com>" || len(msg.Flags) != 0 {
+        t.Errorf("message = %+v", msg)
+    }
+
+    headers := make(map[string]string)
+    for _, field := range email.Headers {
+        headers[field.Name] = field.Value
+    }
+    if headers["From"] != "Jürgen <j@example.com>" || headers["Subject"] != "📎 files" || headers["To"] != "me@example.com" {
+        t.Errorf("headers = %+v", email.Headers)
+    }
+
+    if email.Body != "Hello there" {
+        t.Errorf("body = %q, want the plain text part", email.Body)
+    }
+
+    want := []attachmentInfo{
+        {Part: "2", Filename: "report.pdf", MIMEType: "application/pdf", Size: 28},
+        {Part: "3", MIMEType: "image/png", Size: 12},
+        {Part: "4", Filename: "notes.txt", MIMEType: "text/plain", Size: 10},
+    }
+    if fmt.Sprint(email.Attachments) != fmt.Sprint(want) {
+        t.Errorf("attachments = %+v, want %+v", email.Attachments, want)
+    }
+    if !strings.Contains(text, "Part 2: report.pdf (application/pdf, 28 bytes)") {
+        t.Errorf("result doesn't list the attachments:\n%s", text)
+    }
+
+    // Fetching the message doesn't mark it as seen.
+    _, out, _ = runGetEmail("", attachmentUID, email.UIDValidity)
+    if flags := out.(getEmailOutput).Message.Flags; len(flags) != 0 {
+        t.Errorf("flags after get_email = %v", flags)
+    }
+}
+
+func TestGetEmailErrors(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    tests := []struct {
+        name        string
+        uid         uint32
+        uidValidity uint32
+        want        string
+    }{
+        {"no uid", 0, 0, "uid is required"},
+        {"no such message", 99, 0, "No message with UID 99"},
+        {"uid validity changed", attachmentUID, 12345, "UIDVALIDITY of mailbox 'INBOX' changed from 12345"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := runGetEmail("", tt.uid, tt.uidValidity)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+}
+
+func TestReadEmailsUIDValidity(t *testing.T) {
+    startIMAP(t, attachmentMail)
+
+    res, out, err := runReadEmails("", 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    emails := out.(readEmailsOutput)
+    if emails.UIDValidity == 0 {
+        t.Fatal("no UIDVALIDITY in the output")
+    }
+    if want := fmt.Sprintf("Mailbox: INBOX (UIDVALIDITY %d)", emails.UIDValidity); !strings.HasPrefix(text, want) {
+        t.Errorf("result doesn't start with %q:\n%s", want, text)
+    }
+    if len(emails.Messages) != 2 {
+        t.Fatalf("messages = %+v", emails.Messages)
+    }
+
+    // The UIDs read_emails lists can be passed to get_email.
+    last := emails.Messages[len(emails.Messages)-1]
+    res, out, err = runGetEmail(emails.Mailbox, last.UID, emails.UIDValidity)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if got := out.(getEmailOutput).Message.Subject; got != last.Subject {
+        t.Errorf("get_email subject = %q, want %q", got, last.Subject)
+    }
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// duplicateModes are the ways import_ics handles a UID that already exists
+// in the target calendar.
+var duplicateModes = []string{"skip", "replace", "new_uid"}
+
+// importObject is one calendar object split out of an imported file: the
+// components sharing a UID (a master and its overrides) and the timezones
+// they reference.
+type importObject struct {
+    UID      string
+    CompType string
+    Cal      *ical.Calendar
+}
+
+// decodeCalendars decodes every VCALENDAR in r.
+func decodeCalendars(r io.Reader) ([]*ical.Calendar, error) {
+    dec := ical.NewDecoder(r)
+    var cals []*ical.Calendar
+    for {
+        cal, err := dec.Decode()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return nil, err
+        }
+        cals = append(cals, cal)
+    }
+    if len(cals) == 0 {
+        return nil, fmt.Errorf("no VCALENDAR found")
+    }
+    return cals, nil
+}
+
+// splitCalendars splits cals into one object per UID, in the order the
+// UIDs first appear. Components without a UID are given a new one. Each
+// object gets a fresh VCALENDAR, which drops the METHOD of iTIP messages
+// that CalDAV servers reject in stored objects.
+func splitCalendars(cals []*ical.Calendar) []importObject {
+    timezones := make(map[string]*ical.Component)
+    for _, cal := range cals {
+        for _, child := range cal.Children {
+            if child.Name != ical.CompTimezone {
+                continue
+            }
+            if tzid, err := child.Props.Text(ical.PropTimezoneID); err == nil {
+                timezones[tzid] = child
+            }
+        }
+    }
+
+    var objects []importObject
+    index := make(map[string]int)
+    for _, cal := range cals {
+        for _, child := range cal.Children {
+            if child.Name != ical.CompEvent && child.Name != ical.CompToDo {
+                continue
+            }
+            uid, _ := child.Props.Text(ical.PropUID)
+            if uid == "" {
+                uid = uuid.NewString()
+                child.Props.SetText(ical.PropUID, uid)
+            }
+            i, ok := index[uid]
+            if !ok {
+                i = len(objects)
+                index[uid] = i
+                objects = append(objects, importObject{UID: uid, CompType: child.Name, Cal: newCalendar()})
+            }
+            objects[i].Cal.Children = append(objects[i].Cal.Children, child)
+        }
+    }
+
+    for _, obj := range objects {
+        var tzs []*ical.Component
+        for _, tzid := range referencedTimezones(obj.Cal.Children) {
+            if tz, ok := timezones[tzid]; ok {
+                tzs = append(tzs, tz)
+            }
+        }
+        obj.Cal.Children = append(tzs, obj.Cal.Children...)
+    }
+    return objects
+}
+
+// referencedTimezones returns the TZIDs used by the properties of comps,
+// sorted.
+func referencedTimezones(comps []*ical.Component) []string {
+    seen := make(map[string]bool)
+    var walk func(comp *ical.Component)
+    walk = func(comp *ical.Component) {
+        for _, props := range comp.Props {
+            for _, prop := range props {
+                if tzid := prop.Params.Get(ical.ParamTimezoneID); tzid != "" {
+                    seen[tzid] = true
+                }
+            }
+        }
+        for _, child := range comp.Children {
+            walk(child)
+        }
+    }
+    for _, comp := range comps {
+        walk(comp)
+    }
+
+    tzids := make([]string, 0, len(seen))
+    for tzid := range seen {
+        tzids = append(tzids, tzid)
+    }
+    sort.Strings(tzids)
+    return tzids
+}
+
+// setObjectUID replaces the UID of every component of cal.
+func setObjectUID(cal *ical.Calendar, uid string) {
+    for _, child := range cal.Children {
+        if child.Name != ical.CompTimezone {
+            child.Props.SetText(ical.PropUID, uid)
+        }
+    }
+}
+
+// importedObject is an object in the output of import_ics.
+type importedObject struct {
+    UID     string `json:"uid"`
+    Path    string `json:"path,omitempty"`
+    ETag    string `json:"etag,omitempty"`
+    Summary string `json:"summary,omitempty"`
+    Status  string `json:"status"`
+    Error   string `json:"error,omitempty"`
+}
+
+type importICSOutput struct {
+    Objects []importedObject `json:"objects"`
+}
+
+// maxICSFileSize is the largest file import_ics reads.
+const maxICSFileSize = 10 << 20
+
+// openICSFile opens a file for import_ics. Only regular files named *.ics
+// are read, so the tool can't be used to read keys or other files on the
+// server's machine, nor block on a FIFO or device.
+func openICSFile(p string) (*os.File, error) {
+    if !strings.EqualFold(filepath.Ext(p), ".ics") {
+        return nil, errors.New("only .ics files can be imported")
+    }
+    fi, err := os.Stat(p)
+    if err != nil {
+        return nil, err
+    }
+    if !fi.Mode().IsRegular() {
+        return nil, errors.New("not a regular file")
+    }
+    if fi.Size() > maxICSFileSize {
+        return nil, fmt.Errorf("larger than %d bytes", maxICSFileSize)
+    }
+    return os.Open(p)
+}
+
+// runImportICS stores the objects of an iCalendar file, or of inline
+// content, in a calendar. Events go to the calendar, reminders to the
+// reminders list; calendar picks either by name.
+func runImportICS(ctx context.Context, calendar, filePath, content, onDuplicate string) (*mcp.CallToolResult, any, error) {
+    if (filePath == "") == (content == "") {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "Exactly one of path or content is required"}},
+            IsError: true,
+        }, nil, nil
+    }
+    if onDuplicate == "" {
+        onDuplicate = "skip"
+    }
+    switch onDuplicate {
+    case "skip", "replace", "new_uid":
+    default:
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid on_duplicate %q: use one of %s", onDuplicate, strings.Join(duplicateModes, ", "))}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    var r io.Reader = strings.NewReader(content)
+    if filePath != "" {
+        f, err := openICSFile(filePath)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to open %s: %v", filePath, err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        defer f.Close()
+        r = f
+    }
+    cals, err := decodeCalendars(r)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid iCalendar data: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    objects := splitCalendars(cals)
+    if len(objects) == 0 {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "No events or reminders to import"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    clients := make(map[string]*calDAVClient)
+    out := importICSOutput{Objects: []importedObject{}}
+    var result string
+    counts := make(map[string]int)
+    for _, obj := range objects {
+        imported := importObjectTo(ctx, clients, calendar, obj, onDuplicate)
+        out.Objects = append(out.Objects, imported)
+        counts[imported.Status]++
+
+        result += fmt.Sprintf("%s: %s", imported.Status, imported.UID)
+        if imported.Summary != "" {
+            result += fmt.Sprintf(" (%s)", imported.Summary)
+        }
+        if imported.Error != "" {
+            result += ": " + imported.Error
+        }
+        result += "\n"
+    }
+
+    summary := fmt.Sprintf("Imported %d object(s): %d created, %d replaced, %d skipped, %d failed.\n",
+        len(objects), counts["created"], counts["replaced"], counts["skipped"], counts["failed"])
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: summary + result}},
+        IsError: counts["failed"] == len(objects),
+    }, out, nil
+}
+
+// importObjectTo stores obj in the collection for its component type,
+// creating the client on first use.
+func importObjectTo(ctx context.Context, clients map[string]*calDAVClient, calendar string, obj importObject, onDuplicate string) importedObject {
+    imported := importedObject{UID: obj.UID, Status: "failed"}
+    if comp := masterComponent(obj.Cal, obj.CompType); comp != nil {
+        imported.Summary, _ = comp.Props.Text(ical.PropSummary)
+    }
+
+    compType := obj.CompType
+    client, ok := clients[compType]
+    if !ok {
+        urlEnv := "ICLOUD_CALDAV_URL"
+        if compType == ical.CompToDo {
+            urlEnv = "ICLOUD_REMINDERS_URL"
+        }
+        var err error
+        client, err = getCalDAVClient(ctx, urlEnv, compType, calendar)
+        if err != nil {
+            imported.Error = fmt.Sprintf("client error: %v", err)
+            return imported
+        }
+        clients[compType] = client
+    }
+
+    existing, err := client.findCalendarObject(ctx, compType, obj.UID, "")
+    var notFound *objectNotFoundError
+    if err != nil && !errors.As(err, &notFound) {
+        imported.Error = err.Error()
+        return imported
+    }
+
+    p := objectPath(client.collectionPath(), obj.UID)
+    ifMatch := ""
+    status := "created"
+    if existing != nil {
+        switch onDuplicate {
+        case "skip":
+            imported.Path = existing.Path
+            imported.ETag = existing.ETag
+            imported.Status = "skipped"
+            return imported
+        case "replace":
+            p, ifMatch, status = existing.Path, existing.ETag, "replaced"
+        case "new_uid":
+            imported.UID = uuid.NewString()
+            setObjectUID(obj.Cal, imported.UID)
+            p = objectPath(client.collectionPath(), imported.UID)
+        }
+    }
+
+    stored, err := client.putCalendarObject(ctx, p, obj.Cal, ifMatch)
+    if err != nil {
+        imported.Path = p
+        imported.Error = err.Error()
+        return imported
+    }
+    imported.Path = stored.Path
+    imported.ETag = stored.ETag
+    imported.Status = status
+    return imported
+}
+
+// writeExport writes data to p, which must not exist unless overwrite is
+// set. A replacement is written to a temporary file next to p and renamed
+// over it, so p is never truncated in place and a symlink at p is replaced
+// rather than followed.
+func writeExport(p string, data []byte, overwrite bool) error {
+    if !overwrite {
+        // O_EXCL fails on an existing file or symlink.
+        f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+        if err != nil {
+            return err
+        }
+        if _, err := f.Write(data); err != nil {
+            f.Close()
+            os.Remove(p)
+            return err
+        }
+        return f.Close()
+    }
+
+    if fi, err := os.Lstat(p); err == nil && !fi.Mode().IsRegular() {
+        return fmt.Errorf("%s is not a regular file", p)
+    }
+    f, err := os.CreateTemp(filepath.Dir(p), ".export-*.ics")
+    if err != nil {
+        return err
+    }
+    tmp := f.Name()
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, p); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    return nil
+}
+
+// runExportCalendar writes the events or reminders of a calendar, or those
+// overlapping a time range, to a single VCALENDAR. The result is saved to
+// filePath if given, without replacing an existing file unless overwrite
+// is set, and returned as an embedded text/calendar resource otherwise.
+func runExportCalendar(ctx context.Context, calendar, compType, startTime, endTime, filePath string, overwrite bool) (*mcp.CallToolResult, any, error) {
+    if filePath != "" && !strings.EqualFold(filepath.Ext(filePath), ".ics") {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Cannot export to %s: only .ics files can be written", filePath)}},
+            IsError: true,
+        }, nil, nil
+    }
+    start, end, _, err := parseTimeRange(startTime, endTime)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    urlEnv := "ICLOUD_CALDAV_URL"
+    if compType == ical.CompToDo {
+        urlEnv = "ICLOUD_REMINDERS_URL"
+    }
+    client, err := getCalDAVClient(ctx, urlEnv, compType, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    query := &caldav.CalendarQuery{
+        CompRequest: caldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+        CompFilter: caldav.CompFilter{
+            Name:  "VCALENDAR",
+            Comps: []caldav.CompFilter{{Name: compType, Start: start, End: end}},
+        },
+    }
+    objs, err := client.QueryCalendar(ctx, "", query)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to query calendar: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+
+    // Timezones are shared between objects, so each is exported once.
+    cal := newCalendar()
+    var comps []*ical.Component
+    seenTZ := make(map[string]bool)
+    count := 0
+    for _, obj := range objs {
+        if obj.Data == nil {
+            continue
+        }
+        count++
+        for _, child := range obj.Data.Children {
+            if child.Name != ical.CompTimezone {
+                comps = append(comps, child)
+                continue
+            }
+            tzid, _ := child.Props.Text(ical.PropTimezoneID)
+            if !seenTZ[tzid] {
+                seenTZ[tzid] = true
+                cal.Children = append(cal.Children, child)
+            }
+        }
+    }
+    cal.Children = append(cal.Children, comps...)
+
+    var buf bytes.Buffer
+    if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to encode calendar: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    if filePath != "" {
+        if err := writeExport(filePath, buf.Bytes(), overwrite); errors.Is(err, os.ErrExist) {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%s already exists; pass overwrite to replace it", filePath)}},
+                IsError: true,
+            }, nil, nil
+        } else if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to write %s: %v", filePath, err)}},
+                IsError: true,
+            }, nil, nil
+        }
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Exported %d object(s) to %s.", count, filePath)}},
+        }, nil, nil
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{
+            &mcp.TextContent{Text: fmt.Sprintf("Exported %d object(s) from %s.", count, client.collectionPath())},
+            &mcp.EmbeddedResource{Resource: &mcp.ResourceContents{
+                URI:      client.collectionURL(),
+                MIMEType: ical.MIMEType,
+                Text:     buf.String(),
+            }},
+        },
+    }, nil, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const importCalendar = "BEGIN:VCALENDAR\r\n" +
+    "VERSION:2.0\r\n" +
+    "PRODID:-//Example//Test//EN\r\n" +
+    "BEGIN:VEVENT\r\n" +
+    "UID:import-1@example.com\r\n" +
+    "DTSTAMP:20250630T090000Z\r\n" +
+    "DTSTART:20250701T090000Z\r\n" +
+    "DTEND:20250701T100000Z\r\n" +
+    "SUMMARY:Imported\r\n" +
+    "END:VEVENT\r\n" +
+    "END:VCALENDAR\r\n"
+
+func TestExportCalendarFile(t *testing.T) {
+    startCalDAV(t)
+    createEvent(t, newEventRequest{Summary: "Standup", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T09:15:00Z"})
+    p := filepath.Join(t.TempDir(), "work.ics")
+
+    res, _, err := runExportCalendar(context.Background(), "", "VEVENT", "", "", p, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    data, err := os.ReadFile(p)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), "SUMMARY:Standup") {
+        t.Errorf("export doesn't contain the event:\n%s", data)
+    }
+    fi, err := os.Stat(p)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mode := fi.Mode().Perm(); mode != 0o600 {
+        t.Errorf("export has mode %v, want 0600", mode)
+    }
+
+    // An existing file is kept unless overwrite is set.
+    if err := os.WriteFile(p, []byte("keep me"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    res, _, err = runExportCalendar(context.Background(), "", "VEVENT", "", "", p, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, "already exists") {
+        t.Errorf("error = %q", text)
+    }
+    if data, _ := os.ReadFile(p); string(data) != "keep me" {
+        t.Errorf("existing file was changed to %q", data)
+    }
+
+    res, _, err = runExportCalendar(context.Background(), "", "VEVENT", "", "", p, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if data, _ := os.ReadFile(p); !strings.HasPrefix(string(data), "BEGIN:VCALENDAR") {
+        t.Errorf("overwritten file = %q", data)
+    }
+    if fi, err := os.Stat(p); err != nil || fi.Mode().Perm() != 0o600 {
+        t.Errorf("overwritten file: %v, %v", fi, err)
+    }
+    entries, err := os.ReadDir(filepath.Dir(p))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 1 {
+        t.Errorf("directory holds %d files after overwrite, want 1", len(entries))
+    }
+}
+
+func TestExportCalendarNotICS(t *testing.T) {
+    startCalDAV(t)
+    p := filepath.Join(t.TempDir(), ".bashrc")
+    if err := os.WriteFile(p, []byte("keep me"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, overwrite := range []bool{false, true} {
+        res, _, err := runExportCalendar(context.Background(), "", "VEVENT", "", "", p, overwrite)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if text := resultText(t, res, true); !strings.Contains(text, "only .ics files") {
+            t.Errorf("error = %q", text)
+        }
+    }
+    if data, _ := os.ReadFile(p); string(data) != "keep me" {
+        t.Errorf("file was changed to %q", data)
+    }
+}
+
+func TestExportCalendarSymlink(t *testing.T) {
+    startCalDAV(t)
+    dir := t.TempDir()
+    target := filepath.Join(dir, "target")
+    if err := os.WriteFile(target, []byte("keep me"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    link := filepath.Join(dir, "link.ics")
+    if err := os.Symlink(target, link); err != nil {
+        t.Skip(err)
+    }
+
+    for _, overwrite := range []bool{false, true} {
+        res, _, err := runExportCalendar(context.Background(), "", "VEVENT", "", "", link, overwrite)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resultText(t, res, true)
+    }
+    if data, _ := os.ReadFile(target); string(data) != "keep me" {
+        t.Errorf("symlink target was changed to %q", data)
+    }
+}
+
+func TestImportICSFile(t *testing.T) {
+    b := startCalDAV(t)
+    dir := t.TempDir()
+    p := filepath.Join(dir, "invite.ICS")
+    if err := os.WriteFile(p, []byte(importCalendar), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    res, _, err := runImportICS(context.Background(), "", p, "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if n := b.count(); n != 1 {
+        t.Errorf("%d object(s) stored, want 1", n)
+    }
+}
+
+func TestImportICSFileErrors(t *testing.T) {
+    b := startCalDAV(t)
+    dir := t.TempDir()
+    notICS := filepath.Join(dir, "calendar.txt")
+    large := filepath.Join(dir, "large.ics")
+    for p, data := range map[string]string{
+        notICS: importCalendar,
+        large:  importCalendar + strings.Repeat(" ", maxICSFileSize),
+    } {
+        if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.Mkdir(filepath.Join(dir, "dir.ics"), 0o700); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        path string
+        want string
+    }{
+        {"not .ics", notICS, "only .ics files"},
+        {"directory", filepath.Join(dir, "dir.ics"), "not a regular file"},
+        {"too large", large, "larger than"},
+        {"missing", filepath.Join(dir, "missing.ics"), "no such file"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := runImportICS(context.Background(), "", tt.path, "", "")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) stored, want 0", n)
+    }
+}
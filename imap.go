@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strings"
     "io/ioutil"
 
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-ical"
     "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-func runReadEmails(limit int) (*mcp.CallToolResult, any, error) {
-    return fetchMessages("INBOX", limit)
+func runReadEmails(mailbox string, limit int) (*mcp.CallToolResult, any, error) {
+    if mailbox == "" {
+        mailbox = "INBOX"
+    }
+    return fetchMessages(mailbox, limit)
 }
 
 func runReadNotes(limit int) (*mcp.CallToolResult, any, error) {
@@ -29,48 +37,378 @@ func runReadNotes(limit int) (*mcp.CallToolResult, any, error) {
     }, nil, nil
 }
 
-func fetchMessages(mailbox string, limit int) (*mcp.CallToolResult, any, error) {
-    if limit <= 0 {
-        limit = 10
+// imapAddr returns the IMAP server to read mail from.
+func imapAddr() string {
+    if addr := os.Getenv("ICLOUD_IMAP_ADDR"); addr != "" {
+        return addr
     }
+    return "imap.mail.me.com:993"
+}
 
+// dialIMAP connects and logs in to the IMAP server. The caller must call
+// Logout on the returned client.
+func dialIMAP() (*client.Client, error) {
     email, err := getEnv("ICLOUD_EMAIL")
     if err != nil {
-        return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
-            IsError: true,
-        }, nil, nil
+        return nil, fmt.Errorf("Configuration error: %v", err)
     }
     password, err := getEnv("ICLOUD_PASSWORD")
+    if err != nil {
+        return nil, fmt.Errorf("Configuration error: %v", err)
+    }
+
+    c, err := client.DialTLS(imapAddr(), nil)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to connect to IMAP: %v", err)
+    }
+    if err := c.Login(email, password); err != nil {
+        c.Logout()
+        return nil, fmt.Errorf("Failed to login to IMAP: %v", err)
+    }
+    return c, nil
+}
+
+// formatAddress formats an envelope address as "Name <user@host>", or just
+// "user@host" without a name.
+func formatAddress(addr *imap.Address) string {
+    email := addr.MailboxName + "@" + addr.HostName
+    if addr.PersonalName == "" {
+        return email
+    }
+    return fmt.Sprintf("%s <%s>", addr.PersonalName, email)
+}
+
+// specialUseAttrs are the RFC 6154 attributes that mark a mailbox's role.
+var specialUseAttrs = []string{
+    imap.AllAttr, imap.ArchiveAttr, imap.DraftsAttr, imap.FlaggedAttr,
+    imap.JunkAttr, imap.SentAttr, imap.TrashAttr, imap.ImportantAttr,
+}
+
+// listMailboxes returns every mailbox on the server.
+func listMailboxes(c *client.Client) ([]*imap.MailboxInfo, error) {
+    ch := make(chan *imap.MailboxInfo, 10)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.List("", "*", ch)
+    }()
+
+    var mailboxes []*imap.MailboxInfo
+    for info := range ch {
+        mailboxes = append(mailboxes, info)
+    }
+    if err := <-done; err != nil {
+        return nil, fmt.Errorf("Failed to list mailboxes: %v", err)
+    }
+    return mailboxes, nil
+}
+
+// specialUse returns the special-use attribute of a mailbox, or "".
+func specialUse(info *imap.MailboxInfo) string {
+    for _, attr := range info.Attributes {
+        for _, use := range specialUseAttrs {
+            if strings.EqualFold(attr, use) {
+                return use
+            }
+        }
+    }
+    return ""
+}
+
+// resolveMailbox maps a special-use attribute such as \Sent to the name of
+// the mailbox carrying it, since the names differ between servers (iCloud
+// uses "Sent Messages"). Other names are returned as is.
+func resolveMailbox(c *client.Client, name string) (string, error) {
+    if !strings.HasPrefix(name, "\\") {
+        return name, nil
+    }
+    mailboxes, err := listMailboxes(c)
+    if err != nil {
+        return "", err
+    }
+    for _, info := range mailboxes {
+        if strings.EqualFold(specialUse(info), name) {
+            return info.Name, nil
+        }
+    }
+    return "", fmt.Errorf("No mailbox has the special-use attribute %s", name)
+}
+
+// selectMailbox resolves and selects mailbox read-only. If uidValidity is
+// non-zero it must match the mailbox's UIDVALIDITY, otherwise UIDs taken
+// from an earlier listing may name different messages.
+func selectMailbox(c *client.Client, mailbox string, uidValidity uint32) (string, *imap.MailboxStatus, error) {
+    mailbox, err := resolveMailbox(c, mailbox)
+    if err != nil {
+        return "", nil, err
+    }
+    mbox, err := c.Select(mailbox, true)
+    if err != nil {
+        return "", nil, fmt.Errorf("Failed to select mailbox '%s': %v", mailbox, err)
+    }
+    if uidValidity != 0 && mbox.UidValidity != uidValidity {
+        return "", nil, fmt.Errorf("The UIDVALIDITY of mailbox '%s' changed from %d to %d, so its UIDs are no longer valid. List the messages again.", mailbox, uidValidity, mbox.UidValidity)
+    }
+    return mailbox, mbox, nil
+}
+
+// mailboxOutput is a mailbox in the output of list_mailboxes.
+type mailboxOutput struct {
+    Name       string   `json:"name"`
+    Delimiter  string   `json:"delimiter,omitempty"`
+    Attributes []string `json:"attributes"`
+    SpecialUse string   `json:"special_use,omitempty"`
+    Selectable bool     `json:"selectable"`
+}
+
+type listMailboxesOutput struct {
+    Mailboxes []mailboxOutput `json:"mailboxes"`
+}
+
+func runListMailboxes() (*mcp.CallToolResult, any, error) {
+    c, err := dialIMAP()
     if err != nil {
         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
             IsError: true,
         }, nil, nil
     }
+    defer c.Logout()
 
-    log.Printf("Connecting to IMAP server to fetch %s...", mailbox)
-
-    c, err := client.DialTLS("imap.mail.me.com:993", nil)
+    mailboxes, err := listMailboxes(c)
     if err != nil {
         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to connect to IMAP: %v", err)}},
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
             IsError: true,
         }, nil, nil
     }
+    sort.Slice(mailboxes, func(i, j int) bool { return mailboxes[i].Name < mailboxes[j].Name })
+
+    out := listMailboxesOutput{Mailboxes: []mailboxOutput{}}
+    var result string
+    for _, info := range mailboxes {
+        mailbox := mailboxOutput{
+            Name:       info.Name,
+            Delimiter:  info.Delimiter,
+            Attributes: info.Attributes,
+            SpecialUse: specialUse(info),
+            Selectable: true,
+        }
+        if mailbox.Attributes == nil {
+            mailbox.Attributes = []string{}
+        }
+        for _, attr := range info.Attributes {
+            if strings.EqualFold(attr, imap.NoSelectAttr) {
+                mailbox.Selectable = false
+            }
+        }
+        out.Mailboxes = append(out.Mailboxes, mailbox)
+
+        result += mailbox.Name
+        if mailbox.SpecialUse != "" {
+            result += " (" + mailbox.SpecialUse + ")"
+        }
+        if !mailbox.Selectable {
+            result += " [not selectable]"
+        }
+        result += "\n"
+    }
+    if result == "" {
+        result = "No mailboxes found\n"
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// fetchMessage returns the full raw message with the given UID in mailbox
+// without marking it as seen.
+func fetchMessage(mailbox string, uid uint32) ([]byte, error) {
+    c, err := dialIMAP()
+    if err != nil {
+        return nil, err
+    }
     defer c.Logout()
 
-    if err := c.Login(email, password); err != nil {
+    mailbox, _, err = selectMailbox(c, mailbox, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uid)
+    section := &imap.BodySectionName{Peek: true}
+
+    messages := make(chan *imap.Message, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages)
+    }()
+
+    var body []byte
+    for msg := range messages {
+        if r := msg.GetBody(section); r != nil {
+            body, err = ioutil.ReadAll(r)
+        }
+    }
+    if fetchErr := <-done; fetchErr != nil {
+        return nil, fmt.Errorf("Failed to fetch message: %v", fetchErr)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("Failed to read message: %v", err)
+    }
+    if body == nil {
+        return nil, fmt.Errorf("No message with UID %d in mailbox '%s'", uid, mailbox)
+    }
+    return body, nil
+}
+
+// previewParts returns the paths of the parts read_emails looks at: the
+// message text, preferring text/plain to text/html, and the first calendar
+// part, which may be an invitation. Either is nil if there is no such part.
+func previewParts(bs *imap.BodyStructure) (text, calendar []int) {
+    var html []int
+    bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+        if strings.EqualFold(part.MIMEType, "multipart") {
+            return true
+        }
+        if !strings.EqualFold(part.MIMEType, "text") {
+            return false
+        }
+        subType := strings.ToLower(part.MIMESubType)
+        switch {
+        case subType == "calendar":
+            if calendar == nil {
+                calendar = path
+            }
+        case strings.EqualFold(part.Disposition, "attachment"):
+        case subType == "plain":
+            if text == nil {
+                text = path
+            }
+        case subType == "html":
+            if html == nil {
+                html = path
+            }
+        }
+        return false
+    })
+    if text == nil {
+        text = html
+    }
+    return text, calendar
+}
+
+// partSections returns the sections holding the header and the body of the
+// part at path. A message that isn't multipart has only part 1, whose
+// header is the message header.
+func partSections(bs *imap.BodyStructure, path []int) (header, body *imap.BodySectionName) {
+    if len(bs.Parts) == 0 {
+        return &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true},
+            &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.TextSpecifier}, Peek: true}
+    }
+    return &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.MIMESpecifier, Path: path}, Peek: true},
+        &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: path}, Peek: true}
+}
+
+// fetchPreviewParts fetches the parts chosen by previewParts from the
+// message with the given UID in the selected mailbox, each with its MIME
+// header so that it can be read as an entity of its own. Nothing else is
+// downloaded, and the message isn't marked as seen.
+func fetchPreviewParts(c *client.Client, uid uint32, bs *imap.BodyStructure) (text, calendar []byte, err error) {
+    if bs == nil {
+        return nil, nil, nil
+    }
+    textPath, calendarPath := previewParts(bs)
+    if textPath == nil && calendarPath == nil {
+        return nil, nil, nil
+    }
+
+    var items []imap.FetchItem
+    var sections [][2]*imap.BodySectionName
+    for _, path := range [][]int{textPath, calendarPath} {
+        var pair [2]*imap.BodySectionName
+        if path != nil {
+            pair[0], pair[1] = partSections(bs, path)
+            items = append(items, pair[0].FetchItem(), pair[1].FetchItem())
+        }
+        sections = append(sections, pair)
+    }
+
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uid)
+    messages := make(chan *imap.Message, 1)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, items, messages)
+    }()
+
+    parts := make([][]byte, len(sections))
+    var readErr error
+    for msg := range messages {
+        for i, pair := range sections {
+            if pair[0] == nil {
+                continue
+            }
+            var part []byte
+            for _, section := range pair {
+                r := msg.GetBody(section)
+                if r == nil {
+                    continue
+                }
+                data, err := ioutil.ReadAll(r)
+                if err != nil {
+                    readErr = err
+                }
+                part = append(part, data...)
+            }
+            parts[i] = part
+        }
+    }
+    if err := <-done; err != nil {
+        return nil, nil, fmt.Errorf("Failed to fetch message %d: %v", uid, err)
+    }
+    if readErr != nil {
+        return nil, nil, fmt.Errorf("Failed to read message %d: %v", uid, readErr)
+    }
+    return parts[0], parts[1], nil
+}
+
+// emailPreview is a message in the output of read_emails.
+type emailPreview struct {
+    emailSummary
+    Invitation bool   `json:"invitation,omitempty"`
+    Body       string `json:"body"`
+}
+
+// readEmailsOutput lists messages by UID. A UID names the same message only
+// as long as the mailbox's UIDVALIDITY stays the same.
+type readEmailsOutput struct {
+    Mailbox     string         `json:"mailbox"`
+    UIDValidity uint32         `json:"uid_validity"`
+    Messages    []emailPreview `json:"messages"`
+}
+
+func fetchMessages(mailbox string, limit int) (*mcp.CallToolResult, any, error) {
+    if limit <= 0 {
+        limit = 10
+    }
+
+    log.Printf("Connecting to IMAP server to fetch %s...", mailbox)
+
+    c, err := dialIMAP()
+    if err != nil {
         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to login to IMAP: %v", err)}},
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
             IsError: true,
         }, nil, nil
     }
+    defer c.Logout()
 
-    mbox, err := c.Select(mailbox, false)
+    mailbox, mbox, err := selectMailbox(c, mailbox, 0)
     if err != nil {
         return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to select mailbox '%s': %v. It might not exist.", mailbox, err)}},
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
             IsError: true,
         }, nil, nil
     }
@@ -89,9 +427,9 @@ func fetchMessages(mailbox string, limit int) (*mcp.CallToolResult, any, error)
     seqset := new(imap.SeqSet)
     seqset.AddRange(from, to)
 
-    // We want the body
-    section := &imap.BodySectionName{}
-    items := []imap.FetchItem{imap.FetchEnvelope, section.FetchItem()}
+    // Only the structure here: the text is fetched part by part below, so
+    // that attachments aren't downloaded just to show a preview.
+    items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchUid, imap.FetchBodyStructure}
 
     messages := make(chan *imap.Message, 10)
     done := make(chan error, 1)
@@ -99,37 +437,57 @@ func fetchMessages(mailbox string, limit int) (*mcp.CallToolResult, any, error)
         done <- c.Fetch(seqset, items, messages)
     }()
 
-    var result string
+    var fetched []*imap.Message
     for msg := range messages {
+        fetched = append(fetched, msg)
+    }
+    if err := <-done; err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to fetch messages: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    out := readEmailsOutput{Mailbox: mailbox, UIDValidity: mbox.UidValidity, Messages: []emailPreview{}}
+    result := fmt.Sprintf("Mailbox: %s (UIDVALIDITY %d)\n---\n", mailbox, mbox.UidValidity)
+    for _, msg := range fetched {
         fromStr := ""
         if len(msg.Envelope.From) > 0 {
-            addr := msg.Envelope.From[0]
-            fromStr = fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName)
+            fromStr = formatAddress(msg.Envelope.From[0])
         }
+        preview := emailPreview{emailSummary: newEmailSummary(msg)}
 
-        result += fmt.Sprintf("Subject: %s\nDate: %v\nFrom: %s\n", msg.Envelope.Subject, msg.Envelope.Date, fromStr)
+        result += fmt.Sprintf("UID: %d\nSubject: %s\nDate: %v\nFrom: %s\n", msg.Uid, msg.Envelope.Subject, msg.Envelope.Date, fromStr)
 
-        r := msg.GetBody(section)
-        if r != nil {
-            bodyBytes, _ := ioutil.ReadAll(r)
-            body := string(bodyBytes)
-            // Truncate body if too long
-            if len(body) > 500 {
-                body = body[:500] + "..."
+        text, calendar, err := fetchPreviewParts(c, msg.Uid, msg.BodyStructure)
+        if err != nil {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+                IsError: true,
+            }, nil, nil
+        }
+        if calendar != nil {
+            if cal, method, err := findInvitation(bytes.NewReader(calendar)); err == nil && method == "REQUEST" {
+                if event := invitationEvent(cal); event != nil {
+                    summary, _ := event.Props.Text(ical.PropSummary)
+                    preview.Invitation = true
+                    result += fmt.Sprintf("Invitation: %s (use respond_to_invitation with uid %d)\n", summary, msg.Uid)
+                }
             }
-            result += fmt.Sprintf("Body: %s\n", body)
         }
+        if text != nil {
+            body, err := messageText(bytes.NewReader(text))
+            if err != nil {
+                log.Printf("Failed to decode message %d: %v", msg.Uid, err)
+            }
+            preview.Body = truncateText(body, bodyPreviewLength)
+        }
+        result += fmt.Sprintf("Body: %s\n", preview.Body)
         result += "---\n"
-    }
-
-    if err := <-done; err != nil {
-        return &mcp.CallToolResult{
-            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to fetch messages: %v", err)}},
-            IsError: true,
-        }, nil, nil
+        out.Messages = append(out.Messages, preview)
     }
 
     return &mcp.CallToolResult{
         Content: []mcp.Content{&mcp.TextContent{Text: result}},
-    }, nil, nil
+    }, out, nil
 }
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+)
+
+// imapCert is the certificate test IMAP servers present. It is added to
+// the system roots through SSL_CERT_FILE, which Go reads only once, so
+// every server shares it.
+var imapCert struct {
+    once sync.Once
+    cert tls.Certificate
+    err  error
+}
+
+func testIMAPCert(t *testing.T) tls.Certificate {
+    t.Helper()
+    imapCert.once.Do(func() {
+        // httptest's certificate is valid for 127.0.0.1.
+        srv := httptest.NewUnstartedServer(nil)
+        srv.StartTLS()
+        defer srv.Close()
+        imapCert.cert = srv.TLS.Certificates[0]
+
+        f, err := os.CreateTemp("", "icloud-mcp-test-*.pem")
+        if err != nil {
+            imapCert.err = err
+            return
+        }
+        defer f.Close()
+        imapCert.err = pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+        os.Setenv("SSL_CERT_FILE", f.Name())
+    })
+    if imapCert.err != nil {
+        t.Fatal(imapCert.err)
+    }
+    return imapCert.cert
+}
+
+// startIMAP serves go-imap's in-memory backend with msgs added to its
+// INBOX, after the message the backend starts with (UID 6).
+func startIMAP(t *testing.T, msgs ...string) *memory.Backend {
+    t.Helper()
+    be := memory.New()
+    user, err := be.Login(nil, "username", "password")
+    if err != nil {
+        t.Fatal(err)
+    }
+    inbox, err := user.GetMailbox("INBOX")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, msg := range msgs {
+        if err := inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(msg)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    startIMAPBackend(t, be)
+    return be
+}
+
+// startIMAPBackend serves be over TLS and points the IMAP configuration at
+// it. be must accept the login username/password.
+func startIMAPBackend(t *testing.T, be backend.Backend) {
+    t.Helper()
+    cert := testIMAPCert(t)
+    ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := server.New(anyLogin{be})
+    s.AllowInsecureAuth = true
+    s.ErrorLog = log.New(io.Discard, "", 0)
+    go s.Serve(ln)
+    t.Cleanup(func() { s.Close() })
+
+    t.Setenv("ICLOUD_IMAP_ADDR", ln.Addr().String())
+    t.Setenv("ICLOUD_EMAIL", "me@example.com")
+    t.Setenv("ICLOUD_PASSWORD", "secret")
+}
+
+// anyLogin logs every client in as the in-memory backend's only user, so
+// the tests can use the same account for IMAP and CalDAV.
+type anyLogin struct {
+    backend.Backend
+}
+
+func (b anyLogin) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+    return b.Backend.Login(info, "username", "password")
+}
+
+// specialUseBackend adds special-use attributes, which go-imap's in-memory
+// backend doesn't have, to its mailboxes.
+type specialUseBackend struct {
+    backend.Backend
+    attrs map[string][]string
+}
+
+type specialUseUser struct {
+    backend.User
+    attrs map[string][]string
+}
+
+type specialUseMailbox struct {
+    backend.Mailbox
+    attrs []string
+}
+
+func (b specialUseBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+    user, err := b.Backend.Login(info, username, password)
+    if err != nil {
+        return nil, err
+    }
+    return specialUseUser{user, b.attrs}, nil
+}
+
+func (u specialUseUser) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+    mailboxes, err := u.User.ListMailboxes(subscribed)
+    for i, mbox := range mailboxes {
+        mailboxes[i] = specialUseMailbox{mbox, u.attrs[mbox.Name()]}
+    }
+    return mailboxes, err
+}
+
+func (m specialUseMailbox) Info() (*imap.MailboxInfo, error) {
+    info, err := m.Mailbox.Info()
+    if err == nil && m.attrs != nil {
+        info.Attributes = m.attrs
+    }
+    return info, err
+}
+
+// startMailboxes serves an account with a "Sent Messages" mailbox marked
+// \Sent, holding one message, and a non-selectable "Folder".
+func startMailboxes(t *testing.T) {
+    t.Helper()
+    be := memory.New()
+    user, err := be.Login(nil, "username", "password")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, name := range []string{"Sent Messages", "Folder"} {
+        if err := user.CreateMailbox(name); err != nil {
+            t.Fatal(err)
+        }
+    }
+    sent, err := user.GetMailbox("Sent Messages")
+    if err != nil {
+        t.Fatal(err)
+    }
+    msg := "From: me@example.com\r\nTo: bob@example.com\r\nSubject: Sent one\r\n\r\nHello Bob\r\n"
+    if err := sent.CreateMessage(nil, time.Now(), bytes.NewBufferString(msg)); err != nil {
+        t.Fatal(err)
+    }
+    startIMAPBackend(t, specialUseBackend{be, map[string][]string{
+        "Sent Messages": {imap.SentAttr, imap.HasNoChildrenAttr},
+        "Folder":        {imap.NoSelectAttr},
+    }})
+}
+
+func TestListMailboxes(t *testing.T) {
+    startMailboxes(t)
+
+    res, out, err := runListMailboxes()
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    got := make(map[string]mailboxOutput)
+    for _, mbox := range out.(listMailboxesOutput).Mailboxes {
+        got[mbox.Name] = mbox
+    }
+    if mbox := got["Sent Messages"]; mbox.SpecialUse != imap.SentAttr || !mbox.Selectable {
+        t.Errorf("Sent Messages = %+v", mbox)
+    }
+    if mbox := got["Folder"]; mbox.SpecialUse != "" || mbox.Selectable {
+        t.Errorf("Folder = %+v", mbox)
+    }
+    if mbox, ok := got["INBOX"]; !ok || !mbox.Selectable {
+        t.Errorf("INBOX = %+v", mbox)
+    }
+    if !strings.Contains(text, `\Sent`) {
+        t.Errorf("result doesn't mention \\Sent:\n%s", text)
+    }
+}
+
+func TestReadEmailsMailbox(t *testing.T) {
+    startMailboxes(t)
+
+    tests := []struct {
+        mailbox     string
+        wantMailbox string
+        wantSubject string
+    }{
+        {`\Sent`, "Sent Messages", "Sent one"},
+        {`\sent`, "Sent Messages", "Sent one"},
+        {"Sent Messages", "Sent Messages", "Sent one"},
+        {"", "INBOX", "A little message, just for you"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.mailbox, func(t *testing.T) {
+            res, out, err := runReadEmails(tt.mailbox, 5)
+            if err != nil {
+                t.Fatal(err)
+            }
+            resultText(t, res, false)
+            emails := out.(readEmailsOutput)
+            if emails.Mailbox != tt.wantMailbox {
+                t.Errorf("mailbox = %q, want %q", emails.Mailbox, tt.wantMailbox)
+            }
+            if len(emails.Messages) != 1 || emails.Messages[0].Subject != tt.wantSubject {
+                t.Errorf("messages = %+v, want one with subject %q", emails.Messages, tt.wantSubject)
+            }
+        })
+    }
+}
+
+func TestReadEmailsMailboxErrors(t *testing.T) {
+    startMailboxes(t)
+
+    tests := []struct {
+        mailbox string
+        want    string
+    }{
+        {`\Archive`, `No mailbox has the special-use attribute \Archive`},
+        {"Nope", "Failed to select mailbox 'Nope'"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.mailbox, func(t *testing.T) {
+            res, _, err := runReadEmails(tt.mailbox, 5)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+}
+
+// fetchLog records the body sections clients fetch from go-imap's
+// in-memory backend by UID.
+type fetchLog struct {
+    mu       sync.Mutex
+    sections map[string][]string
+}
+
+type fetchLogBackend struct {
+    backend.Backend
+    log *fetchLog
+}
+
+type fetchLogUser struct {
+    backend.User
+    log *fetchLog
+}
+
+type fetchLogMailbox struct {
+    backend.Mailbox
+    log *fetchLog
+}
+
+func (b fetchLogBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+    user, err := b.Backend.Login(info, username, password)
+    if err != nil {
+        return nil, err
+    }
+    return fetchLogUser{user, b.log}, nil
+}
+
+func (u fetchLogUser) GetMailbox(name string) (backend.Mailbox, error) {
+    mbox, err := u.User.GetMailbox(name)
+    if err != nil {
+        return nil, err
+    }
+    return fetchLogMailbox{mbox, u.log}, nil
+}
+
+func (m fetchLogMailbox) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+    m.log.mu.Lock()
+    for _, item := range items {
+        if strings.HasPrefix(string(item), "BODY[") || strings.HasPrefix(string(item), "BODY.PEEK[") {
+            key := seqSet.String()
+            if !uid {
+                key = "seq " + key
+            }
+            m.log.sections[key] = append(m.log.sections[key], string(item))
+        }
+    }
+    m.log.mu.Unlock()
+    return m.Mailbox.ListMessages(uid, seqSet, items, ch)
+}
+
+func TestReadEmailsPeeks(t *testing.T) {
+    be := memory.New()
+    user, err := be.Login(nil, "username", "password")
+    if err != nil {
+        t.Fatal(err)
+    }
+    inbox, err := user.GetMailbox("INBOX")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, msg := range []string{attachmentMail, invitationMail} {
+        if err := inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(msg)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    fetches := &fetchLog{sections: map[string][]string{}}
+    startIMAPBackend(t, fetchLogBackend{be, fetches})
+
+    res, out, err := runReadEmails("", 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    text := resultText(t, res, false)
+    emails := out.(readEmailsOutput)
+    if len(emails.Messages) != 3 {
+        t.Fatalf("messages = %+v", emails.Messages)
+    }
+    want := []struct {
+        body       string
+        invitation bool
+    }{
+        {"Hi there :)", false},
+        {"Hello there", false},
+        {"Alice has invited you to Design review.", true},
+    }
+    for i, w := range want {
+        got := emails.Messages[i]
+        if strings.TrimSpace(got.Body) != w.body || got.Invitation != w.invitation {
+            t.Errorf("message %d = %+v, want body %q and invitation %v", got.UID, got, w.body, w.invitation)
+        }
+    }
+    if !strings.Contains(text, "Invitation: Design review") {
+        t.Errorf("result doesn't mention the invitation:\n%s", text)
+    }
+
+    // Reading the mailbox must neither mark the messages as seen nor
+    // download more than the parts it shows.
+    for _, msg := range inbox.(*memory.Mailbox).Messages {
+        if msg.Uid == 6 {
+            continue // the backend's message starts out seen
+        }
+        for _, flag := range msg.Flags {
+            if flag == imap.SeenFlag {
+                t.Errorf("message %d was marked as seen", msg.Uid)
+            }
+        }
+    }
+    fetches.mu.Lock()
+    defer fetches.mu.Unlock()
+    wantSections := map[string][]string{
+        "6": {"BODY.PEEK[HEADER]", "BODY.PEEK[TEXT]"},
+        "7": {"BODY.PEEK[1.1.MIME]", "BODY.PEEK[1.1]"},
+        "8": {"BODY.PEEK[1.MIME]", "BODY.PEEK[1]", "BODY.PEEK[2.MIME]", "BODY.PEEK[2]"},
+    }
+    if !reflect.DeepEqual(fetches.sections, wantSections) {
+        t.Errorf("fetched sections %v, want %v", fetches.sections, wantSections)
+    }
+}
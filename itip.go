@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// calAddress returns the iCalendar CAL-ADDRESS for an email address.
+func calAddress(email string) string {
+    return "mailto:" + strings.TrimSpace(email)
+}
+
+// addressEmail returns the email address of a CAL-ADDRESS value.
+func addressEmail(addr string) string {
+    if len(addr) > len("mailto:") && strings.EqualFold(addr[:len("mailto:")], "mailto:") {
+        return addr[len("mailto:"):]
+    }
+    return addr
+}
+
+// parseAttendees checks the attendee arguments of an event and returns
+// their email addresses. Each must be an RFC 5322 address such as
+// "bob@example.com" or "Bob <bob@example.com>".
+func parseAttendees(values []string) ([]string, error) {
+    if values == nil {
+        return nil, nil
+    }
+    emails := make([]string, 0, len(values))
+    for _, value := range values {
+        addr, err := mail.ParseAddress(strings.TrimSpace(value))
+        if err != nil {
+            return nil, fmt.Errorf("invalid attendee %q: %v", value, err)
+        }
+        emails = append(emails, addr.Address)
+    }
+    return emails, nil
+}
+
+// setAttendees replaces the attendees of event with emails and makes the
+// configured account the ORGANIZER. Attendees that stay on the list keep
+// their participation status.
+func setAttendees(event *ical.Component, organizer string, emails []string) {
+    existing := make(map[string]ical.Prop)
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        existing[strings.ToLower(addressEmail(prop.Value))] = prop
+    }
+
+    event.Props.Del(ical.PropAttendee)
+    for _, email := range emails {
+        if prop, ok := existing[strings.ToLower(strings.TrimSpace(email))]; ok {
+            event.Props.Add(&prop)
+            continue
+        }
+        attendee := ical.NewProp(ical.PropAttendee)
+        attendee.Value = calAddress(email)
+        attendee.Params.Set(ical.ParamRole, "REQ-PARTICIPANT")
+        attendee.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+        attendee.Params.Set(ical.ParamRSVP, "TRUE")
+        event.Props.Add(attendee)
+    }
+
+    if len(emails) > 0 && event.Props.Get(ical.PropOrganizer) == nil {
+        org := ical.NewProp(ical.PropOrganizer)
+        org.Value = calAddress(organizer)
+        event.Props.Set(org)
+    }
+}
+
+// attendeeEmails returns the email addresses of the attendees of event,
+// excluding self.
+func attendeeEmails(event *ical.Component, self string) []string {
+    var emails []string
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        email := addressEmail(prop.Value)
+        if !strings.EqualFold(email, self) {
+            emails = append(emails, email)
+        }
+    }
+    return emails
+}
+
+// withMethod returns a shallow copy of cal carrying the iTIP METHOD, which
+// must not be present on objects stored in a calendar collection.
+func withMethod(cal *ical.Calendar, method string) *ical.Calendar {
+    props := make(ical.Props, len(cal.Props)+1)
+    for name, values := range cal.Props {
+        props[name] = values
+    }
+    props.SetText(ical.PropMethod, method)
+    return &ical.Calendar{Component: &ical.Component{
+        Name:     cal.Name,
+        Props:    props,
+        Children: cal.Children,
+    }}
+}
+
+// newITIPMessage builds an email carrying cal as an iTIP message (RFC 6047):
+// a text/plain part for humans followed by the text/calendar part that
+// calendar clients act on.
+func newITIPMessage(from string, to []string, subject, text string, cal *ical.Calendar, method string) ([]byte, error) {
+    var ics bytes.Buffer
+    if err := ical.NewEncoder(&ics).Encode(withMethod(cal, method)); err != nil {
+        return nil, err
+    }
+
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+
+    textPart, err := mw.CreatePart(textproto.MIMEHeader{
+        "Content-Type": {"text/plain; charset=utf-8"},
+    })
+    if err != nil {
+        return nil, err
+    }
+    textPart.Write([]byte(text))
+
+    calPart, err := mw.CreatePart(textproto.MIMEHeader{
+        "Content-Type":        {mime.FormatMediaType(ical.MIMEType, map[string]string{"charset": "utf-8", "method": method})},
+        "Content-Disposition": {`attachment; filename="invite.ics"`},
+    })
+    if err != nil {
+        return nil, err
+    }
+    calPart.Write(ics.Bytes())
+
+    if err := mw.Close(); err != nil {
+        return nil, err
+    }
+
+    var msg bytes.Buffer
+    fmt.Fprintf(&msg, "From: %s\r\n", from)
+    fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+    fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+    fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    fmt.Fprintf(&msg, "Message-ID: <%s@icloud-mcp>\r\n", uuid.NewString())
+    fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+    fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n", mw.Boundary())
+    fmt.Fprintf(&msg, "\r\n")
+    msg.Write(body.Bytes())
+    return msg.Bytes(), nil
+}
+
+// sendInvitations emails an iTIP REQUEST for the event in cal to all of its
+// attendees and returns the addresses it was sent to.
+func sendInvitations(cal *ical.Calendar, update bool) ([]string, error) {
+    self, err := getEnv("ICLOUD_EMAIL")
+    if err != nil {
+        return nil, err
+    }
+    event := masterComponent(cal, ical.CompEvent)
+    if event == nil {
+        return nil, fmt.Errorf("no VEVENT to send")
+    }
+    to := attendeeEmails(event, self)
+    if len(to) == 0 {
+        return nil, nil
+    }
+
+    summary, _ := event.Props.Text(ical.PropSummary)
+    subject := "Invitation: " + summary
+    if update {
+        subject = "Updated invitation: " + summary
+    }
+    text := fmt.Sprintf("%s has invited you to %q.", self, summary)
+    if start, _, allDay, err := eventTimes(event); err == nil {
+        if allDay {
+            text += fmt.Sprintf("\nWhen: %s (all day)", start.Format(time.DateOnly))
+        } else {
+            text += fmt.Sprintf("\nWhen: %s", start.Format(time.RFC1123))
+        }
+    }
+    if location, _ := event.Props.Text(ical.PropLocation); location != "" {
+        text += "\nWhere: " + location
+    }
+    text += "\n"
+
+    msg, err := newITIPMessage(self, to, subject, text, cal, "REQUEST")
+    if err != nil {
+        return nil, err
+    }
+    if err := sendMail(to, msg); err != nil {
+        return nil, err
+    }
+    return to, nil
+}
+
+// errNoInvitation is returned by findInvitation for messages without a
+// text/calendar part.
+var errNoInvitation = errors.New("message doesn't contain a calendar invitation")
+
+// findInvitation returns the first iTIP object carried by the MIME message
+// read from r, together with its METHOD.
+func findInvitation(r io.Reader) (*ical.Calendar, string, error) {
+    entity, err := message.Read(r)
+    if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+        return nil, "", err
+    }
+
+    var cal *ical.Calendar
+    var method string
+    walkErr := entity.Walk(func(path []int, part *message.Entity, err error) error {
+        if err != nil || cal != nil {
+            return err
+        }
+        mediaType, params, _ := part.Header.ContentType()
+        if mediaType != ical.MIMEType && mediaType != "application/ics" {
+            return nil
+        }
+        decoded, err := ical.NewDecoder(part.Body).Decode()
+        if err != nil {
+            return fmt.Errorf("invalid calendar attachment: %v", err)
+        }
+        cal = decoded
+        method = params["method"]
+        if m, _ := cal.Props.Text(ical.PropMethod); m != "" {
+            method = m
+        }
+        return nil
+    })
+    if walkErr != nil {
+        return nil, "", walkErr
+    }
+    if cal == nil {
+        return nil, "", errNoInvitation
+    }
+    return cal, strings.ToUpper(method), nil
+}
+
+// invitationEvent returns the VEVENT an invitation is about: the master
+// event, or the first override when only a single occurrence is sent.
+func invitationEvent(cal *ical.Calendar) *ical.Component {
+    if event := masterComponent(cal, ical.CompEvent); event != nil {
+        return event
+    }
+    for _, child := range cal.Children {
+        if child.Name == ical.CompEvent {
+            return child
+        }
+    }
+    return nil
+}
+
+// partStats maps the responses accepted by respond_to_invitation to
+// PARTSTAT values.
+var partStats = map[string]string{
+    "accept":    "ACCEPTED",
+    "accepted":  "ACCEPTED",
+    "decline":   "DECLINED",
+    "declined":  "DECLINED",
+    "tentative": "TENTATIVE",
+}
+
+// setPartStat sets the participation status of the attendee self on every
+// VEVENT in cal and reports whether self is an attendee at all.
+func setPartStat(cal *ical.Calendar, self, partStat string) bool {
+    found := false
+    for _, child := range cal.Children {
+        if child.Name != ical.CompEvent {
+            continue
+        }
+        for i, prop := range child.Props[ical.PropAttendee] {
+            if strings.EqualFold(addressEmail(prop.Value), self) {
+                child.Props[ical.PropAttendee][i].Params.Set(ical.ParamParticipationStatus, partStat)
+                child.Props[ical.PropAttendee][i].Params.Del(ical.ParamRSVP)
+                found = true
+            }
+        }
+    }
+    return found
+}
+
+// newReply builds the iTIP REPLY for invitation (RFC 5546 section 3.2.3):
+// each VEVENT keeps its identifying properties and only the replying
+// attendee.
+func newReply(invitation *ical.Calendar, self, partStat, comment string) *ical.Calendar {
+    reply := newCalendar()
+    for _, child := range invitation.Children {
+        if child.Name == ical.CompTimezone {
+            reply.Children = append(reply.Children, child)
+            continue
+        }
+        if child.Name != ical.CompEvent {
+            continue
+        }
+
+        event := ical.NewComponent(ical.CompEvent)
+        for _, name := range []string{
+            ical.PropUID, ical.PropRecurrenceID, ical.PropSequence, ical.PropSummary,
+            ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropDuration, ical.PropOrganizer,
+        } {
+            if props, ok := child.Props[name]; ok {
+                event.Props[name] = props
+            }
+        }
+        event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+        for _, prop := range child.Props[ical.PropAttendee] {
+            if strings.EqualFold(addressEmail(prop.Value), self) {
+                attendee := prop
+                attendee.Params = make(ical.Params)
+                for k, v := range prop.Params {
+                    attendee.Params[k] = v
+                }
+                attendee.Params.Set(ical.ParamParticipationStatus, partStat)
+                attendee.Params.Del(ical.ParamRSVP)
+                event.Props.Add(&attendee)
+            }
+        }
+        if comment != "" {
+            event.Props.SetText(ical.PropComment, comment)
+        }
+        reply.Children = append(reply.Children, event)
+    }
+    return reply
+}
+
+type invitationAttendee struct {
+    Email    string `json:"email"`
+    PartStat string `json:"partstat,omitempty"`
+}
+
+type invitationOutput struct {
+    UID          string               `json:"uid"`
+    Summary      string               `json:"summary"`
+    Organizer    string               `json:"organizer,omitempty"`
+    Start        string               `json:"start,omitempty"`
+    End          string               `json:"end,omitempty"`
+    AllDay       bool                 `json:"all_day,omitempty"`
+    Location     string               `json:"location,omitempty"`
+    Attendees    []invitationAttendee `json:"attendees,omitempty"`
+    Response     string               `json:"response,omitempty"`
+    ReplySentTo  string               `json:"reply_sent_to,omitempty"`
+    CalendarPath string               `json:"calendar_path,omitempty"`
+    ETag         string               `json:"etag,omitempty"`
+}
+
+// describeInvitation summarizes the event of an invitation.
+func describeInvitation(event *ical.Component) (invitationOutput, string) {
+    out := invitationOutput{}
+    out.UID, _ = event.Props.Text(ical.PropUID)
+    out.Summary, _ = event.Props.Text(ical.PropSummary)
+    out.Location, _ = event.Props.Text(ical.PropLocation)
+    if org := event.Props.Get(ical.PropOrganizer); org != nil {
+        out.Organizer = addressEmail(org.Value)
+    }
+
+    text := fmt.Sprintf("Invitation: %s\n  UID: %s\n", out.Summary, out.UID)
+    if out.Organizer != "" {
+        text += fmt.Sprintf("  Organizer: %s\n", out.Organizer)
+    }
+    if start, end, allDay, err := eventTimes(event); err == nil {
+        out.AllDay = allDay
+        if allDay {
+            out.Start = start.Format(time.DateOnly)
+            out.End = end.Format(time.DateOnly)
+            text += fmt.Sprintf("  When: %s (all day)\n", out.Start)
+        } else {
+            out.Start = start.Format(time.RFC3339)
+            out.End = end.Format(time.RFC3339)
+            text += fmt.Sprintf("  When: %s - %s\n", out.Start, out.End)
+        }
+    }
+    if event.Props.Get(ical.PropRecurrenceRule) != nil {
+        text += "  Recurring: yes\n"
+    }
+    if out.Location != "" {
+        text += fmt.Sprintf("  Where: %s\n", out.Location)
+    }
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        attendee := invitationAttendee{
+            Email:    addressEmail(prop.Value),
+            PartStat: prop.Params.Get(ical.ParamParticipationStatus),
+        }
+        out.Attendees = append(out.Attendees, attendee)
+        text += fmt.Sprintf("  Attendee: %s (%s)\n", attendee.Email, attendee.PartStat)
+    }
+    return out, text
+}
+
+// runRespondToInvitation shows the invitation in message uid of mailbox and,
+// if response is set, replies to the organizer and records the response in
+// the user's calendar.
+func runRespondToInvitation(ctx context.Context, mailbox string, uid uint32, response, comment, calendar string) (*mcp.CallToolResult, any, error) {
+    if mailbox == "" {
+        mailbox = "INBOX"
+    }
+    partStat := ""
+    if response != "" {
+        var ok bool
+        partStat, ok = partStats[strings.ToLower(response)]
+        if !ok {
+            return &mcp.CallToolResult{
+                Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid response %q: use accept, decline or tentative", response)}},
+                IsError: true,
+            }, nil, nil
+        }
+    }
+
+    raw, err := fetchMessage(mailbox, uid)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    invitation, method, err := findInvitation(bytes.NewReader(raw))
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to read invitation: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if method != "REQUEST" {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("The message carries an iTIP %s, not an invitation (REQUEST)", method)}},
+            IsError: true,
+        }, nil, nil
+    }
+    event := invitationEvent(invitation)
+    if event == nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: "The invitation doesn't contain an event"}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    out, result := describeInvitation(event)
+    if partStat == "" {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: result}},
+        }, out, nil
+    }
+    out.Response = partStat
+
+    self, err := getEnv("ICLOUD_EMAIL")
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if out.Organizer == "" {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: result + "\nThe invitation has no organizer to reply to"}},
+            IsError: true,
+        }, nil, nil
+    }
+    if !setPartStat(invitation, self, partStat) {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: result + fmt.Sprintf("\n%s is not an attendee of this invitation", self)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    subjects := map[string]string{
+        "ACCEPTED":  "Accepted",
+        "DECLINED":  "Declined",
+        "TENTATIVE": "Tentatively accepted",
+    }
+    subject := fmt.Sprintf("%s: %s", subjects[partStat], out.Summary)
+    text := fmt.Sprintf("%s has %s %q.\n", self, strings.ToLower(subjects[partStat]), out.Summary)
+    if comment != "" {
+        text += "\n" + comment + "\n"
+    }
+    msg, err := newITIPMessage(self, []string{out.Organizer}, subject, text, newReply(invitation, self, partStat, comment), "REPLY")
+    if err == nil {
+        err = sendMail([]string{out.Organizer}, msg)
+    }
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: result + fmt.Sprintf("\nFailed to send reply: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    out.ReplySentTo = out.Organizer
+    result += fmt.Sprintf("\nReplied %s to %s.\n", partStat, out.Organizer)
+
+    // The reply has been sent at this point, so calendar problems are only
+    // reported.
+    obj, err := recordResponse(ctx, calendar, invitation, out.UID, self, partStat)
+    switch {
+    case err != nil:
+        result += fmt.Sprintf("Warning: failed to update the calendar: %v\n", err)
+    case obj == nil:
+        result += "The event is not in your calendar.\n"
+    default:
+        out.CalendarPath, out.ETag = obj.Path, obj.ETag
+        result += fmt.Sprintf("Calendar updated: %s\n", obj.Path)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
+
+// recordResponse sets the user's PARTSTAT on their CalDAV copy of the event.
+// An accepted invitation that isn't in the calendar yet is added to it; a
+// declined one is left out and nil is returned.
+func recordResponse(ctx context.Context, calendar string, invitation *ical.Calendar, uid, self, partStat string) (*caldav.CalendarObject, error) {
+    client, err := getCalDAVClient(ctx, "ICLOUD_CALDAV_URL", ical.CompEvent, calendar)
+    if err != nil {
+        return nil, err
+    }
+
+    obj, err := client.findCalendarObject(ctx, ical.CompEvent, uid, "")
+    var notFound *objectNotFoundError
+    switch {
+    case errors.As(err, &notFound):
+        if partStat == "DECLINED" {
+            return nil, nil
+        }
+        stored := newCalendar()
+        stored.Children = invitation.Children
+        return client.putCalendarObject(ctx, objectPath(client.collectionPath(), uid), stored, "")
+    case err != nil:
+        return nil, err
+    }
+
+    if !setPartStat(obj.Data, self, partStat) {
+        return nil, fmt.Errorf("%s is not an attendee of the event in %s", self, obj.Path)
+    }
+    return client.putCalendarObject(ctx, obj.Path, obj.Data, obj.ETag)
+}
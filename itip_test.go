@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+// sentMail is a message received by smtpSink.
+type sentMail struct {
+    From string
+    To   []string
+    Data string
+}
+
+// smtpSink is a minimal SMTP server that accepts any login and records the
+// messages submitted to it.
+type smtpSink struct {
+    mu   sync.Mutex
+    mail []sentMail
+}
+
+func (s *smtpSink) messages() []sentMail {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]sentMail(nil), s.mail...)
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+    defer conn.Close()
+    tp := textproto.NewConn(conn)
+    tp.PrintfLine("220 localhost ESMTP sink")
+    var msg sentMail
+    for {
+        line, err := tp.ReadLine()
+        if err != nil {
+            return
+        }
+        verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+        switch verb {
+        case "EHLO", "HELO":
+            tp.PrintfLine("250-localhost")
+            tp.PrintfLine("250 AUTH PLAIN")
+        case "AUTH":
+            tp.PrintfLine("235 Authenticated")
+        case "MAIL":
+            msg = sentMail{From: addressArg(line)}
+            tp.PrintfLine("250 OK")
+        case "RCPT":
+            msg.To = append(msg.To, addressArg(line))
+            tp.PrintfLine("250 OK")
+        case "DATA":
+            tp.PrintfLine("354 Go ahead")
+            data, err := tp.ReadDotBytes()
+            if err != nil {
+                return
+            }
+            msg.Data = string(data)
+            s.mu.Lock()
+            s.mail = append(s.mail, msg)
+            s.mu.Unlock()
+            tp.PrintfLine("250 OK")
+        case "QUIT":
+            tp.PrintfLine("221 Bye")
+            return
+        default:
+            tp.PrintfLine("250 OK")
+        }
+    }
+}
+
+// addressArg returns the address in a MAIL FROM:<a> or RCPT TO:<a> line.
+func addressArg(line string) string {
+    start, end := strings.IndexByte(line, '<'), strings.IndexByte(line, '>')
+    if start < 0 || end < start {
+        return ""
+    }
+    return line[start+1 : end]
+}
+
+// startSMTP starts an smtpSink and points ICLOUD_SMTP_ADDR at it. It
+// listens on localhost, where net/smtp allows PLAIN auth without TLS.
+func startSMTP(t *testing.T) *smtpSink {
+    t.Helper()
+    ln, err := net.Listen("tcp", "localhost:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { ln.Close() })
+    sink := &smtpSink{}
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go sink.serve(conn)
+        }
+    }()
+    _, port, _ := net.SplitHostPort(ln.Addr().String())
+    t.Setenv("ICLOUD_SMTP_ADDR", net.JoinHostPort("localhost", port))
+    return sink
+}
+
+func attendeeValues(event *ical.Component) []string {
+    var values []string
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        values = append(values, prop.Value)
+    }
+    return values
+}
+
+func TestCreateEventWithAttendees(t *testing.T) {
+    b := startCalDAV(t)
+    sink := startSMTP(t)
+
+    created := createEvent(t, newEventRequest{
+        Summary:         "Review",
+        StartTime:       "2025-07-01T10:00:00Z",
+        DurationMinutes: 30,
+        Attendees:       []string{"Bob <bob@example.com>", " carol@example.com "},
+        SendInvitations: true,
+    })
+
+    event := storedEvent(t, b, created.Path)
+    got := strings.Join(attendeeValues(event), ",")
+    if want := "mailto:bob@example.com,mailto:carol@example.com"; got != want {
+        t.Errorf("ATTENDEE = %s, want %s", got, want)
+    }
+    if got := propValue(event, ical.PropOrganizer); got != "mailto:me@example.com" {
+        t.Errorf("ORGANIZER = %q", got)
+    }
+    if event.Props.Get(ical.PropMethod) != nil {
+        t.Error("stored event carries METHOD")
+    }
+
+    mail := sink.messages()
+    if len(mail) != 1 {
+        t.Fatalf("%d message(s) sent, want 1", len(mail))
+    }
+    if got := strings.Join(mail[0].To, ","); got != "bob@example.com,carol@example.com" {
+        t.Errorf("recipients = %s", got)
+    }
+    if !strings.Contains(mail[0].Data, "METHOD:REQUEST") || !strings.Contains(mail[0].Data, "Subject: Invitation: Review") {
+        t.Errorf("message isn't an invitation:\n%s", mail[0].Data)
+    }
+}
+
+func TestInvalidAttendee(t *testing.T) {
+    for _, attendee := range []string{"not an email", "bob@example.com\r\nBcc: eve@example.com", ""} {
+        t.Run(attendee, func(t *testing.T) {
+            b := startCalDAV(t)
+            sink := startSMTP(t)
+
+            res, _, err := runCreateCalendarEvent(context.Background(), "", newEventRequest{
+                Summary:         "Review",
+                StartTime:       "2025-07-01T10:00:00Z",
+                DurationMinutes: 30,
+                Attendees:       []string{"bob@example.com", attendee},
+                SendInvitations: true,
+            })
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, "invalid attendee") {
+                t.Errorf("error %q doesn't name the attendee", text)
+            }
+            if n := b.count(); n != 0 {
+                t.Errorf("%d object(s) stored, want 0", n)
+            }
+            if n := len(sink.messages()); n != 0 {
+                t.Errorf("%d message(s) sent, want 0", n)
+            }
+        })
+    }
+}
+
+func TestUpdateEventInvalidAttendee(t *testing.T) {
+    b := startCalDAV(t)
+    sink := startSMTP(t)
+    created := createEvent(t, newEventRequest{Summary: "Review", StartTime: "2025-07-01T10:00:00Z", DurationMinutes: 30})
+    etag := b.object(t, created.Path).ETag
+
+    res, _, err := runUpdateCalendarEvent(context.Background(), "", created.UID, "", eventUpdate{
+        Attendees:       []string{"not an email"},
+        SendInvitations: true,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text := resultText(t, res, true); !strings.Contains(text, `"not an email"`) {
+        t.Errorf("error %q doesn't name the attendee", text)
+    }
+    if got := b.object(t, created.Path).ETag; got != etag {
+        t.Errorf("event was rewritten: ETag %s, want %s", got, etag)
+    }
+    if n := len(sink.messages()); n != 0 {
+        t.Errorf("%d message(s) sent, want 0", n)
+    }
+}
+
+// invitationMail is an iTIP REQUEST from alice@example.com to
+// me@example.com, as a mail client sends it.
+const invitationMail = "From: Alice <alice@example.com>\r\n" +
+    "To: me@example.com\r\n" +
+    "Subject: Invitation: Design review\r\n" +
+    "Date: Mon, 30 Jun 2025 09:00:00 +0000\r\n" +
+    "MIME-Version: 1.0\r\n" +
+    "Content-Type: multipart/mixed; boundary=b1\r\n" +
+    "\r\n" +
+    "--b1\r\n" +
+    "Content-Type: text/plain\r\n" +
+    "\r\n" +
+    "Alice has invited you to Design review.\r\n" +
+    "--b1\r\n" +
+    "Content-Type: text/calendar; charset=utf-8; method=REQUEST\r\n" +
+    "\r\n" +
+    "BEGIN:VCALENDAR\r\n" +
+    "VERSION:2.0\r\n" +
+    "PRODID:-//Example//Test//EN\r\n" +
+    "METHOD:REQUEST\r\n" +
+    "BEGIN:VEVENT\r\n" +
+    "UID:review-1@example.com\r\n" +
+    "DTSTAMP:20250630T090000Z\r\n" +
+    "DTSTART:20250701T140000Z\r\n" +
+    "DTEND:20250701T150000Z\r\n" +
+    "SUMMARY:Design review\r\n" +
+    "ORGANIZER:mailto:alice@example.com\r\n" +
+    "ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com\r\n" +
+    "ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:me@example.com\r\n" +
+    "END:VEVENT\r\n" +
+    "END:VCALENDAR\r\n" +
+    "--b1--\r\n"
+
+// invitationUID is the IMAP UID of invitationMail in startIMAP's INBOX.
+const invitationUID = 7
+
+func partStatOf(event *ical.Component, email string) string {
+    for _, prop := range event.Props.Values(ical.PropAttendee) {
+        if strings.EqualFold(addressEmail(prop.Value), email) {
+            return prop.Params.Get(ical.ParamParticipationStatus)
+        }
+    }
+    return ""
+}
+
+func TestShowInvitation(t *testing.T) {
+    startCalDAV(t)
+    startIMAP(t, invitationMail)
+    sink := startSMTP(t)
+
+    res, out, err := runRespondToInvitation(context.Background(), "", invitationUID, "", "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    inv := out.(invitationOutput)
+    if inv.UID != "review-1@example.com" || inv.Summary != "Design review" || inv.Organizer != "alice@example.com" {
+        t.Errorf("invitation = %+v", inv)
+    }
+    if inv.Response != "" || inv.ReplySentTo != "" {
+        t.Errorf("showing the invitation responded to it: %+v", inv)
+    }
+    if n := len(sink.messages()); n != 0 {
+        t.Errorf("%d message(s) sent, want 0", n)
+    }
+}
+
+func TestAcceptInvitation(t *testing.T) {
+    b := startCalDAV(t)
+    startIMAP(t, invitationMail)
+    sink := startSMTP(t)
+
+    res, out, err := runRespondToInvitation(context.Background(), "INBOX", invitationUID, "accept", "See you there", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    inv := out.(invitationOutput)
+    if inv.Response != "ACCEPTED" || inv.ReplySentTo != "alice@example.com" {
+        t.Errorf("invitation = %+v", inv)
+    }
+
+    mail := sink.messages()
+    if len(mail) != 1 {
+        t.Fatalf("%d message(s) sent, want 1", len(mail))
+    }
+    if got := strings.Join(mail[0].To, ","); got != "alice@example.com" {
+        t.Errorf("reply sent to %s", got)
+    }
+    for _, want := range []string{"METHOD:REPLY", "PARTSTAT=ACCEPTED", "mailto:me@example.com", "See you there"} {
+        if !strings.Contains(mail[0].Data, want) {
+            t.Errorf("reply doesn't contain %q:\n%s", want, mail[0].Data)
+        }
+    }
+
+    // The accepted event wasn't in the calendar, so it is added.
+    if inv.CalendarPath == "" {
+        t.Fatalf("event not added to the calendar: %+v", inv)
+    }
+    event := storedEvent(t, b, inv.CalendarPath)
+    if got := partStatOf(event, "me@example.com"); got != "ACCEPTED" {
+        t.Errorf("stored PARTSTAT = %q, want ACCEPTED", got)
+    }
+    if stored := b.object(t, inv.CalendarPath).Data; stored.Props.Get(ical.PropMethod) != nil {
+        t.Error("stored event carries METHOD")
+    }
+}
+
+func TestDeclineInvitationUpdatesCalendar(t *testing.T) {
+    b := startCalDAV(t)
+    startIMAP(t, invitationMail)
+    sink := startSMTP(t)
+
+    // Accept first, so the event is in the calendar, then decline.
+    for _, response := range []string{"accept", "decline"} {
+        res, _, err := runRespondToInvitation(context.Background(), "", invitationUID, response, "", "")
+        if err != nil {
+            t.Fatal(err)
+        }
+        resultText(t, res, false)
+    }
+    if n := b.count(); n != 1 {
+        t.Fatalf("%d object(s) stored, want 1", n)
+    }
+    event := storedEvent(t, b, objectPath("/user/calendars/work/", "review-1@example.com"))
+    if got := partStatOf(event, "me@example.com"); got != "DECLINED" {
+        t.Errorf("stored PARTSTAT = %q, want DECLINED", got)
+    }
+    if n := len(sink.messages()); n != 2 {
+        t.Errorf("%d message(s) sent, want 2", n)
+    }
+}
+
+func TestDeclineInvitationNotInCalendar(t *testing.T) {
+    b := startCalDAV(t)
+    startIMAP(t, invitationMail)
+    startSMTP(t)
+
+    res, out, err := runRespondToInvitation(context.Background(), "", invitationUID, "decline", "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    if inv := out.(invitationOutput); inv.CalendarPath != "" {
+        t.Errorf("declined event was stored at %s", inv.CalendarPath)
+    }
+    if n := b.count(); n != 0 {
+        t.Errorf("%d object(s) stored, want 0", n)
+    }
+}
+
+func TestRespondToInvitationErrors(t *testing.T) {
+    startCalDAV(t)
+    startIMAP(t, invitationMail)
+    sink := startSMTP(t)
+
+    tests := []struct {
+        name     string
+        uid      uint32
+        response string
+    }{
+        {"invalid response", invitationUID, "maybe"},
+        {"not an invitation", 6, "accept"},
+        {"no such message", 99, "accept"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := runRespondToInvitation(context.Background(), "", tt.uid, tt.response, "", "")
+            if err != nil {
+                t.Fatal(err)
+            }
+            resultText(t, res, true)
+        })
+    }
+    if n := len(sink.messages()); n != 0 {
+        t.Errorf("%d message(s) sent, want 0", n)
+    }
+}
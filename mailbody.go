@@ -0,0 +1,182 @@
+package main
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/charset"
+)
+
+func init() {
+    // Decode envelope fields such as RFC 2047 subjects in any charset
+    // go-message knows, not just UTF-8 and US-ASCII.
+    imap.CharsetReader = charset.Reader
+}
+
+// bodyPreviewLength is the number of characters of a message body shown by
+// read_emails.
+const bodyPreviewLength = 500
+
+// messageText returns the readable text of the MIME message read from r:
+// the first text/plain part that isn't an attachment, or the first
+// text/html part converted to text. Transfer encodings are decoded and the
+// text is converted to UTF-8.
+func messageText(r io.Reader) (string, error) {
+    entity, err := message.Read(r)
+    if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+        return "", err
+    }
+
+    var plain, htmlText string
+    var havePlain, haveHTML bool
+    walkErr := entity.Walk(func(path []int, part *message.Entity, err error) error {
+        if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+            return err
+        }
+        if havePlain {
+            return nil
+        }
+        if disp, _, _ := part.Header.ContentDisposition(); disp == "attachment" {
+            return nil
+        }
+        mediaType, _, _ := part.Header.ContentType()
+        if mediaType == "" {
+            // RFC 2045: the default for parts without a Content-Type.
+            mediaType = "text/plain"
+        }
+        switch {
+        case mediaType == "text/plain":
+            data, err := ioutil.ReadAll(part.Body)
+            if err != nil {
+                return err
+            }
+            plain, havePlain = string(data), true
+        case mediaType == "text/html" && !haveHTML:
+            data, err := ioutil.ReadAll(part.Body)
+            if err != nil {
+                return err
+            }
+            htmlText, haveHTML = htmlToText(string(data)), true
+        }
+        return nil
+    })
+    if walkErr != nil {
+        return "", walkErr
+    }
+
+    text := plain
+    if !havePlain {
+        text = htmlText
+    }
+    return tidyText(text), nil
+}
+
+// htmlBlockTags are the elements that start a new line when HTML is
+// converted to text. List items are handled on their own, so that a closing
+// </li> doesn't leave a blank line before the next item.
+var htmlBlockTags = map[string]bool{
+    "br": true, "p": true, "div": true, "tr": true, "ul": true, "ol": true,
+    "table": true, "blockquote": true, "pre": true, "hr": true,
+    "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlToText converts an HTML body to plain text: tags are dropped, block
+// elements become line breaks, list items get a bullet, the contents of
+// script, style and head elements are skipped, and entities are decoded.
+func htmlToText(s string) string {
+    var b strings.Builder
+    skip := ""
+    for len(s) > 0 {
+        lt := strings.IndexByte(s, '<')
+        if lt < 0 {
+            if skip == "" {
+                b.WriteString(html.UnescapeString(s))
+            }
+            break
+        }
+        if skip == "" {
+            b.WriteString(html.UnescapeString(s[:lt]))
+        }
+        s = s[lt:]
+
+        if strings.HasPrefix(s, "<!--") {
+            end := strings.Index(s, "-->")
+            if end < 0 {
+                break
+            }
+            s = s[end+3:]
+            continue
+        }
+        gt := strings.IndexByte(s, '>')
+        if gt < 0 {
+            break
+        }
+        tag := s[1:gt]
+        s = s[gt+1:]
+
+        closing := strings.HasPrefix(tag, "/")
+        name := strings.ToLower(strings.TrimPrefix(tag, "/"))
+        if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+            name = name[:i]
+        }
+
+        if skip != "" {
+            if closing && name == skip {
+                skip = ""
+            }
+            continue
+        }
+        switch {
+        case !closing && (name == "script" || name == "style" || name == "head"):
+            skip = name
+        case !closing && name == "li":
+            b.WriteString("\n- ")
+        case htmlBlockTags[name]:
+            b.WriteString("\n")
+        case name == "td" || name == "th":
+            b.WriteString(" ")
+        }
+    }
+    return b.String()
+}
+
+// tidyText normalizes line endings, trims trailing spaces, collapses runs
+// of spaces left over from HTML and limits blank lines to one.
+func tidyText(s string) string {
+    s = strings.ReplaceAll(s, "\r\n", "\n")
+    lines := strings.Split(s, "\n")
+    var out []string
+    blank := false
+    for _, line := range lines {
+        line = strings.Join(strings.Fields(line), " ")
+        if line == "" {
+            if !blank && len(out) > 0 {
+                out = append(out, "")
+            }
+            blank = true
+            continue
+        }
+        blank = false
+        out = append(out, line)
+    }
+    return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// truncateText shortens s to at most n characters, cutting at a rune
+// boundary and marking the cut with "...".
+func truncateText(s string, n int) string {
+    if utf8.RuneCountInString(s) <= n {
+        return s
+    }
+    i := 0
+    for count := 0; count < n; count++ {
+        _, size := utf8.DecodeRuneInString(s[i:])
+        i += size
+    }
+    return s[:i] + "..."
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMessageText(t *testing.T) {
+    tests := []struct {
+        name string
+        msg  string
+        want string
+    }{
+        {
+            "no content type",
+            "Subject: hi\r\n\r\nHello\r\n",
+            "Hello",
+        },
+        {
+            "quoted-printable latin-1",
+            "Content-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nGr=FC=DFe aus K=F6ln, sch=\r\n=F6n\r\n",
+            "Grüße aus Köln, schön",
+        },
+        {
+            "base64",
+            "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\nSGVsbG8g8J+Ri4==\r\n",
+            "Hello 👋",
+        },
+        {
+            "plain preferred to html",
+            "Content-Type: multipart/alternative; boundary=b\r\n\r\n--b\r\nContent-Type: text/html\r\n\r\n<p>HTML</p>\r\n--b\r\nContent-Type: text/plain\r\n\r\nPlain\r\n--b--\r\n",
+            "Plain",
+        },
+        {
+            "html only",
+            "Content-Type: text/html; charset=utf-8\r\n\r\n<html><head><title>x</title></head><body><p>Hi &amp; welcome</p><ul><li>one</li><li>two</li></ul><script>alert(1)</script></body></html>\r\n",
+            "Hi & welcome\n\n- one\n- two",
+        },
+        {
+            "text attachment skipped",
+            "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=a.txt\r\n\r\nAttached\r\n--b\r\nContent-Type: text/html\r\n\r\nBody<br>text\r\n--b--\r\n",
+            "Body\ntext",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := messageText(strings.NewReader(tt.msg))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != tt.want {
+                t.Errorf("messageText = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestTruncateText(t *testing.T) {
+    tests := []struct {
+        s    string
+        n    int
+        want string
+    }{
+        {"short", 10, "short"},
+        {"exact", 5, "exact"},
+        {"truncated", 5, "trunc..."},
+        {"äöüß€", 3, "äöü..."},
+    }
+    for _, tt := range tests {
+        if got := truncateText(tt.s, tt.n); got != tt.want {
+            t.Errorf("truncateText(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+        }
+    }
+}
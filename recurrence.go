@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// recurrenceRequest is the recurrence argument of create_calendar_event.
+// Either RRule or the structured fields are used.
+type recurrenceRequest struct {
+    Frequency string   `json:"frequency"`
+    Interval  int      `json:"interval"`
+    ByDay     []string `json:"by_day"`
+    Until     string   `json:"until"`
+    Count     int      `json:"count"`
+    RRule     string   `json:"rrule"`
+}
+
+// buildRRule returns the RRULE value described by rec for an event starting
+// at start.
+func buildRRule(rec recurrenceRequest, start time.Time, allDay bool) (string, error) {
+    if rec.RRule != "" {
+        value := strings.TrimPrefix(strings.TrimSpace(rec.RRule), "RRULE:")
+        if _, err := rrule.StrToROption(value); err != nil {
+            return "", fmt.Errorf("invalid rrule: %v", err)
+        }
+        return value, nil
+    }
+
+    freq := strings.ToUpper(rec.Frequency)
+    if _, err := rrule.StrToFreq(freq); err != nil {
+        return "", fmt.Errorf("invalid frequency %q: use DAILY, WEEKLY, MONTHLY or YEARLY", rec.Frequency)
+    }
+    if rec.Count > 0 && rec.Until != "" {
+        return "", fmt.Errorf("count and until are mutually exclusive")
+    }
+
+    parts := []string{"FREQ=" + freq}
+    if rec.Interval > 1 {
+        parts = append(parts, fmt.Sprintf("INTERVAL=%d", rec.Interval))
+    }
+    if len(rec.ByDay) > 0 {
+        days := make([]string, len(rec.ByDay))
+        for i, day := range rec.ByDay {
+            days[i] = strings.ToUpper(strings.TrimSpace(day))
+        }
+        parts = append(parts, "BYDAY="+strings.Join(days, ","))
+    }
+    if rec.Count > 0 {
+        parts = append(parts, fmt.Sprintf("COUNT=%d", rec.Count))
+    }
+    if rec.Until != "" {
+        until, err := parseRecurrenceUntil(rec.Until, start.Location())
+        if err != nil {
+            return "", err
+        }
+        // UNTIL must have the same value type as DTSTART, and be in UTC
+        // when DTSTART is a date-time.
+        if allDay {
+            parts = append(parts, "UNTIL="+until.Format("20060102"))
+        } else {
+            parts = append(parts, "UNTIL="+until.UTC().Format("20060102T150405Z"))
+        }
+    }
+
+    value := strings.Join(parts, ";")
+    if _, err := rrule.StrToROption(value); err != nil {
+        return "", fmt.Errorf("invalid recurrence: %v", err)
+    }
+    return value, nil
+}
+
+// parseRecurrenceUntil parses a time argument (see parseTimeArg). A date
+// includes the whole day.
+func parseRecurrenceUntil(value string, loc *time.Location) (time.Time, error) {
+    t, dateOnly, err := parseTimeArg(value, loc)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid until: %v", err)
+    }
+    if dateOnly {
+        return t.AddDate(0, 0, 1).Add(-time.Second), nil
+    }
+    return t, nil
+}
+
+// eventOccurrence is a single instance of an event within a queried range.
+type eventOccurrence struct {
+    Event     *ical.Component
+    Start     time.Time
+    End       time.Time
+    AllDay    bool
+    Recurring bool
+}
+
+// eventTimes returns the start and end of comp, deriving the end from
+// DURATION or the RFC 5545 defaults when DTEND is missing.
+func eventTimes(comp *ical.Component) (start, end time.Time, allDay bool, err error) {
+    startProp := comp.Props.Get(ical.PropDateTimeStart)
+    if startProp == nil {
+        return time.Time{}, time.Time{}, false, fmt.Errorf("missing DTSTART")
+    }
+    start, err = startProp.DateTime(nil)
+    if err != nil {
+        return time.Time{}, time.Time{}, false, err
+    }
+    allDay = startProp.ValueType() == ical.ValueDate
+
+    switch {
+    case comp.Props.Get(ical.PropDateTimeEnd) != nil:
+        end, err = comp.Props.DateTime(ical.PropDateTimeEnd, nil)
+    case comp.Props.Get(ical.PropDuration) != nil:
+        var dur time.Duration
+        dur, err = comp.Props.Get(ical.PropDuration).Duration()
+        end = start.Add(dur)
+    case allDay:
+        end = start.AddDate(0, 0, 1)
+    default:
+        end = start
+    }
+    return start, end, allDay, err
+}
+
+// propTimes parses every value of a possibly comma-separated date or
+// date-time list property such as EXDATE or RDATE.
+func propTimes(props []ical.Prop, loc *time.Location) ([]time.Time, error) {
+    var times []time.Time
+    for _, prop := range props {
+        if prop.ValueType() == ical.ValuePeriod {
+            continue
+        }
+        for _, v := range strings.Split(prop.Value, ",") {
+            single := prop
+            single.Value = v
+            t, err := single.DateTime(loc)
+            if err != nil {
+                return nil, err
+            }
+            times = append(times, t)
+        }
+    }
+    return times, nil
+}
+
+// recurrenceSet returns the recurrence set of master starting at start, or
+// nil if the event doesn't recur. go-ical's RecurrenceSet doesn't handle
+// multi-valued EXDATE and RDATE properties, hence this version.
+func recurrenceSet(master *ical.Component, start time.Time) (*rrule.Set, error) {
+    rruleProp := master.Props.Get(ical.PropRecurrenceRule)
+    if rruleProp == nil && len(master.Props[ical.PropRecurrenceDates]) == 0 {
+        return nil, nil
+    }
+
+    // DTSTART is always the first instance, even without an RRULE or when
+    // it doesn't match the RRULE. The set skips duplicates.
+    set := &rrule.Set{}
+    set.DTStart(start)
+    set.RDate(start)
+    if rruleProp != nil {
+        opt, err := rrule.StrToROptionInLocation(rruleProp.Value, start.Location())
+        if err != nil {
+            return nil, fmt.Errorf("invalid RRULE: %v", err)
+        }
+        opt.Dtstart = start
+        rule, err := rrule.NewRRule(*opt)
+        if err != nil {
+            return nil, fmt.Errorf("invalid RRULE: %v", err)
+        }
+        set.RRule(rule)
+    }
+
+    rdates, err := propTimes(master.Props[ical.PropRecurrenceDates], start.Location())
+    if err != nil {
+        return nil, fmt.Errorf("invalid RDATE: %v", err)
+    }
+    for _, t := range rdates {
+        set.RDate(t)
+    }
+    exdates, err := propTimes(master.Props[ical.PropExceptionDates], start.Location())
+    if err != nil {
+        return nil, fmt.Errorf("invalid EXDATE: %v", err)
+    }
+    for _, t := range exdates {
+        set.ExDate(t)
+    }
+    return set, nil
+}
+
+// expandEvents returns the occurrences of the events in cal that overlap
+// [rangeStart, rangeEnd), expanding recurrences and applying EXDATE and
+// RECURRENCE-ID overrides.
+func expandEvents(cal *ical.Calendar, rangeStart, rangeEnd time.Time) ([]eventOccurrence, error) {
+    overlaps := func(start, end time.Time) bool {
+        if end.Equal(start) {
+            return !start.Before(rangeStart) && start.Before(rangeEnd)
+        }
+        return start.Before(rangeEnd) && end.After(rangeStart)
+    }
+
+    var master *ical.Component
+    overrides := make(map[int64]*ical.Component)
+    for _, child := range cal.Children {
+        if child.Name != ical.CompEvent {
+            continue
+        }
+        if prop := child.Props.Get(ical.PropRecurrenceID); prop != nil {
+            rid, err := prop.DateTime(nil)
+            if err != nil {
+                return nil, fmt.Errorf("invalid RECURRENCE-ID: %v", err)
+            }
+            overrides[rid.Unix()] = child
+        } else {
+            master = child
+        }
+    }
+
+    var occurrences []eventOccurrence
+    if master != nil {
+        start, end, allDay, err := eventTimes(master)
+        if err != nil {
+            return nil, err
+        }
+        set, err := recurrenceSet(master, start)
+        if err != nil {
+            return nil, err
+        }
+
+        if set == nil {
+            if overlaps(start, end) {
+                occurrences = append(occurrences, eventOccurrence{Event: master, Start: start, End: end, AllDay: allDay})
+            }
+        } else {
+            dur := end.Sub(start)
+            for _, t := range set.Between(rangeStart.Add(-dur), rangeEnd, true) {
+                if _, ok := overrides[t.Unix()]; ok {
+                    continue
+                }
+                if overlaps(t, t.Add(dur)) {
+                    occurrences = append(occurrences, eventOccurrence{Event: master, Start: t, End: t.Add(dur), AllDay: allDay, Recurring: true})
+                }
+            }
+        }
+    }
+
+    // Overrides are checked on their own since they may have been moved into
+    // the range from an occurrence outside of it.
+    for _, override := range overrides {
+        if status, _ := override.Props.Text(ical.PropStatus); strings.EqualFold(status, "CANCELLED") {
+            continue
+        }
+        start, end, allDay, err := eventTimes(override)
+        if err != nil {
+            return nil, err
+        }
+        if overlaps(start, end) {
+            occurrences = append(occurrences, eventOccurrence{Event: override, Start: start, End: end, AllDay: allDay, Recurring: true})
+        }
+    }
+
+    sort.Slice(occurrences, func(i, j int) bool {
+        return occurrences[i].Start.Before(occurrences[j].Start)
+    })
+    return occurrences, nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// decodeEvents decodes a calendar holding the given VEVENTs, each a list of
+// content lines without BEGIN and END.
+func decodeEvents(t *testing.T, events ...[]string) *ical.Calendar {
+    t.Helper()
+    lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Test//EN"}
+    for _, event := range events {
+        lines = append(lines, "BEGIN:VEVENT")
+        lines = append(lines, event...)
+        lines = append(lines, "END:VEVENT")
+    }
+    lines = append(lines, "END:VCALENDAR", "")
+    cal, err := ical.NewDecoder(strings.NewReader(strings.Join(lines, "\r\n"))).Decode()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return cal
+}
+
+// daily is a daily event at 09:00 UTC from Monday 2025-06-30 on, lasting an
+// hour, followed by its extra lines.
+func daily(extra ...string) []string {
+    return append([]string{
+        "UID:daily",
+        "DTSTAMP:20250601T000000Z",
+        "DTSTART:20250630T090000Z",
+        "DTEND:20250630T100000Z",
+        "SUMMARY:Standup",
+        "RRULE:FREQ=DAILY;COUNT=10",
+    }, extra...)
+}
+
+// override is an instance of daily with the given RECURRENCE-ID line,
+// followed by its extra lines.
+func override(recurrenceID string, extra ...string) []string {
+    return append([]string{
+        "UID:daily",
+        "DTSTAMP:20250601T000000Z",
+        recurrenceID,
+    }, extra...)
+}
+
+func TestExpandEvents(t *testing.T) {
+    // Tuesday 2025-07-01 to Friday 2025-07-04, in UTC.
+    rangeStart := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+    rangeEnd := time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        name   string
+        events [][]string
+        // want lists the occurrences as "start summary", with the start in
+        // UTC.
+        want []string
+    }{
+        {
+            name: "single event",
+            events: [][]string{{
+                "UID:single", "DTSTAMP:20250601T000000Z", "SUMMARY:Lunch",
+                "DTSTART:20250702T120000Z", "DTEND:20250702T130000Z",
+            }},
+            want: []string{"2025-07-02T12:00:00Z Lunch"},
+        },
+        {
+            name: "single event outside the range",
+            events: [][]string{{
+                "UID:single", "DTSTAMP:20250601T000000Z", "SUMMARY:Lunch",
+                "DTSTART:20250704T120000Z", "DTEND:20250704T130000Z",
+            }},
+            want: nil,
+        },
+        {
+            name:   "rrule",
+            events: [][]string{daily()},
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name:   "rrule ending in the range",
+            events: [][]string{{
+                "UID:short", "DTSTAMP:20250601T000000Z", "SUMMARY:Sprint",
+                "DTSTART:20250630T090000Z", "DURATION:PT30M",
+                "RRULE:FREQ=DAILY;UNTIL=20250701T090000Z",
+            }},
+            want: []string{"2025-07-01T09:00:00Z Sprint"},
+        },
+        {
+            name: "occurrence overlapping the range start",
+            events: [][]string{{
+                "UID:night", "DTSTAMP:20250601T000000Z", "SUMMARY:Night shift",
+                "DTSTART:20250629T220000Z", "DTEND:20250630T060000Z",
+                "RRULE:FREQ=DAILY",
+            }},
+            want: []string{
+                "2025-06-30T22:00:00Z Night shift",
+                "2025-07-01T22:00:00Z Night shift",
+                "2025-07-02T22:00:00Z Night shift",
+                "2025-07-03T22:00:00Z Night shift",
+            },
+        },
+        {
+            name:   "multi-valued exdate",
+            events: [][]string{daily("EXDATE:20250701T090000Z,20250703T090000Z")},
+            want:   []string{"2025-07-02T09:00:00Z Standup"},
+        },
+        {
+            name:   "repeated exdate",
+            events: [][]string{daily("EXDATE:20250701T090000Z", "EXDATE:20250702T090000Z")},
+            want:   []string{"2025-07-03T09:00:00Z Standup"},
+        },
+        {
+            name: "exdate with a tzid",
+            events: [][]string{{
+                "UID:berlin", "DTSTAMP:20250601T000000Z", "SUMMARY:Standup",
+                "DTSTART;TZID=Europe/Berlin:20250630T110000",
+                "DTEND;TZID=Europe/Berlin:20250630T120000",
+                "RRULE:FREQ=DAILY",
+                "EXDATE;TZID=Europe/Berlin:20250701T110000,20250703T110000",
+            }},
+            want: []string{"2025-07-02T09:00:00Z Standup"},
+        },
+        {
+            name:   "exdate in another timezone than dtstart",
+            events: [][]string{daily("EXDATE;TZID=America/New_York:20250702T050000")},
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name:   "exdate not matching an occurrence",
+            events: [][]string{daily("EXDATE:20250702T100000Z")},
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "multi-valued rdate without rrule",
+            events: [][]string{{
+                "UID:rdate", "DTSTAMP:20250601T000000Z", "SUMMARY:Review",
+                "DTSTART:20250630T150000Z", "DTEND:20250630T160000Z",
+                "RDATE:20250701T150000Z,20250703T150000Z",
+                "RDATE:20250710T150000Z",
+            }},
+            want: []string{
+                "2025-07-01T15:00:00Z Review",
+                "2025-07-03T15:00:00Z Review",
+            },
+        },
+        {
+            name: "rdate without rrule starting in the range",
+            events: [][]string{{
+                "UID:rdate", "DTSTAMP:20250601T000000Z", "SUMMARY:Review",
+                "DTSTART:20250701T150000Z", "DTEND:20250701T160000Z",
+                "RDATE:20250703T150000Z",
+            }},
+            want: []string{
+                "2025-07-01T15:00:00Z Review",
+                "2025-07-03T15:00:00Z Review",
+            },
+        },
+        {
+            name: "dtstart not matching the rrule",
+            events: [][]string{{
+                "UID:weekly", "DTSTAMP:20250601T000000Z", "SUMMARY:Retro",
+                "DTSTART:20250701T090000Z", "DTEND:20250701T100000Z",
+                "RRULE:FREQ=WEEKLY;BYDAY=TH",
+            }},
+            want: []string{
+                "2025-07-01T09:00:00Z Retro",
+                "2025-07-03T09:00:00Z Retro",
+            },
+        },
+        {
+            name:   "rdate added to an rrule",
+            events: [][]string{daily("RDATE:20250702T170000Z")},
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T09:00:00Z Standup",
+                "2025-07-02T17:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "override moving an instance",
+            events: [][]string{
+                daily(),
+                override("RECURRENCE-ID:20250702T090000Z", "DTSTART:20250702T140000Z", "DTEND:20250702T150000Z", "SUMMARY:Standup (moved)"),
+            },
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T14:00:00Z Standup (moved)",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "override moving an instance into the range",
+            events: [][]string{
+                daily(),
+                override("RECURRENCE-ID:20250705T090000Z", "DTSTART:20250703T140000Z", "DTEND:20250703T150000Z", "SUMMARY:Standup (early)"),
+            },
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+                "2025-07-03T14:00:00Z Standup (early)",
+            },
+        },
+        {
+            name: "override moving an instance out of the range",
+            events: [][]string{
+                daily(),
+                override("RECURRENCE-ID:20250702T090000Z", "DTSTART:20250709T090000Z", "DTEND:20250709T100000Z", "SUMMARY:Standup (late)"),
+            },
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "override with a tzid recurrence-id",
+            events: [][]string{
+                daily(),
+                override("RECURRENCE-ID;TZID=Europe/Berlin:20250702T110000", "DTSTART:20250702T140000Z", "DTEND:20250702T150000Z", "SUMMARY:Standup (moved)"),
+            },
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-02T14:00:00Z Standup (moved)",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "cancelled override",
+            events: [][]string{
+                daily(),
+                override("RECURRENCE-ID:20250702T090000Z", "DTSTART:20250702T090000Z", "DTEND:20250702T100000Z", "SUMMARY:Standup", "STATUS:CANCELLED"),
+            },
+            want: []string{
+                "2025-07-01T09:00:00Z Standup",
+                "2025-07-03T09:00:00Z Standup",
+            },
+        },
+        {
+            name: "override without its master",
+            events: [][]string{
+                override("RECURRENCE-ID:20250702T090000Z", "DTSTART:20250702T140000Z", "DTEND:20250702T150000Z", "SUMMARY:Standup (moved)"),
+            },
+            want: []string{"2025-07-02T14:00:00Z Standup (moved)"},
+        },
+        {
+            name: "all-day with a date exdate",
+            events: [][]string{{
+                "UID:allday", "DTSTAMP:20250601T000000Z", "SUMMARY:Conference",
+                "DTSTART;VALUE=DATE:20250630",
+                "RRULE:FREQ=DAILY;COUNT=5",
+                "EXDATE;VALUE=DATE:20250702",
+            }},
+            want: []string{
+                "2025-07-01T00:00:00Z Conference",
+                "2025-07-03T00:00:00Z Conference",
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            occurrences, err := expandEvents(decodeEvents(t, tt.events...), rangeStart, rangeEnd)
+            if err != nil {
+                t.Fatal(err)
+            }
+            var got []string
+            for _, occ := range occurrences {
+                summary, _ := occ.Event.Props.Text(ical.PropSummary)
+                got = append(got, occ.Start.UTC().Format(time.RFC3339)+" "+summary)
+            }
+            if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+                t.Errorf("occurrences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+            }
+        })
+    }
+}
+
+func TestExpandEventsDST(t *testing.T) {
+    // A weekly event at 09:00 in Berlin, across the end of summer time on
+    // 2025-10-26.
+    cal := decodeEvents(t, []string{
+        "UID:weekly", "DTSTAMP:20250601T000000Z", "SUMMARY:Planning",
+        "DTSTART;TZID=Europe/Berlin:20251020T090000",
+        "DTEND;TZID=Europe/Berlin:20251020T100000",
+        "RRULE:FREQ=WEEKLY",
+        "EXDATE;TZID=Europe/Berlin:20251103T090000",
+    })
+    occurrences, err := expandEvents(cal, time.Date(2025, 10, 20, 0, 0, 0, 0, time.UTC), time.Date(2025, 11, 11, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"2025-10-20T07:00:00Z", "2025-10-27T08:00:00Z", "2025-11-10T08:00:00Z"}
+    var got []string
+    for _, occ := range occurrences {
+        got = append(got, occ.Start.UTC().Format(time.RFC3339))
+        if !occ.Recurring || occ.End.Sub(occ.Start) != time.Hour {
+            t.Errorf("occurrence %+v", occ)
+        }
+    }
+    if strings.Join(got, " ") != strings.Join(want, " ") {
+        t.Errorf("starts = %v, want %v", got, want)
+    }
+}
+
+func TestRecurrenceSet(t *testing.T) {
+    start := time.Date(2025, 6, 30, 9, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        name  string
+        lines []string
+        // want lists the first instances, nil for events that don't recur.
+        want []string
+    }{
+        {"no recurrence", nil, nil},
+        {"rrule", []string{"RRULE:FREQ=WEEKLY;COUNT=3"}, []string{"2025-06-30T09:00:00Z", "2025-07-07T09:00:00Z", "2025-07-14T09:00:00Z"}},
+        {"rdate only", []string{"RDATE:20250701T090000Z,20250801T090000Z"}, []string{"2025-06-30T09:00:00Z", "2025-07-01T09:00:00Z", "2025-08-01T09:00:00Z"}},
+        {"rdate periods are ignored", []string{"RDATE;VALUE=PERIOD:20250701T090000Z/PT1H", "RDATE:20250702T090000Z"}, []string{"2025-06-30T09:00:00Z", "2025-07-02T09:00:00Z"}},
+        {"exdate", []string{"RRULE:FREQ=DAILY;COUNT=4", "EXDATE:20250630T090000Z,20250702T090000Z"}, []string{"2025-07-01T09:00:00Z", "2025-07-03T09:00:00Z"}},
+        {"floating exdate", []string{"RRULE:FREQ=DAILY;COUNT=3", "EXDATE:20250701T090000"}, []string{"2025-06-30T09:00:00Z", "2025-07-02T09:00:00Z"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            master := decodeEvents(t, append([]string{"UID:x", "DTSTAMP:20250601T000000Z", "DTSTART:20250630T090000Z"}, tt.lines...)).Children[0]
+            set, err := recurrenceSet(master, start)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tt.want == nil {
+                if set != nil {
+                    t.Errorf("set = %v, want nil", set.All())
+                }
+                return
+            }
+            if set == nil {
+                t.Fatal("set is nil")
+            }
+            var got []string
+            for _, instance := range set.All() {
+                got = append(got, instance.UTC().Format(time.RFC3339))
+            }
+            if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+                t.Errorf("instances = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRecurrenceSetErrors(t *testing.T) {
+    start := time.Date(2025, 6, 30, 9, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        lines []string
+        want  string
+    }{
+        {[]string{"RRULE:FREQ=SOMETIMES"}, "invalid RRULE"},
+        {[]string{"RRULE:FREQ=DAILY;COUNT=many"}, "invalid RRULE"},
+        {[]string{"RRULE:FREQ=DAILY", "EXDATE:20250701T090000Z,July 2nd"}, "invalid EXDATE"},
+        {[]string{"RDATE:tomorrow"}, "invalid RDATE"},
+    }
+    for _, tt := range tests {
+        t.Run(strings.Join(tt.lines, " "), func(t *testing.T) {
+            master := decodeEvents(t, append([]string{"UID:x", "DTSTAMP:20250601T000000Z", "DTSTART:20250630T090000Z"}, tt.lines...)).Children[0]
+            _, err := recurrenceSet(master, start)
+            if err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("error = %v, want it to contain %q", err, tt.want)
+            }
+        })
+    }
+
+    // Errors in an event or override are returned by expandEvents.
+    for _, events := range [][][]string{
+        {daily("EXDATE:never")},
+        {daily(), override("RECURRENCE-ID:soon", "DTSTART:20250702T140000Z")},
+        {{"UID:x", "DTSTAMP:20250601T000000Z", "SUMMARY:No start"}},
+    } {
+        if _, err := expandEvents(decodeEvents(t, events...), start, start.AddDate(0, 0, 7)); err == nil {
+            t.Errorf("no error expanding %v", events)
+        }
+    }
+}
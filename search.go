@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// searchEmailsRequest holds the arguments of search_emails. All criteria
+// must match.
+type searchEmailsRequest struct {
+    Mailbox    string
+    From       string
+    To         string
+    Subject    string
+    Body       string
+    Since      string
+    Before     string
+    Unseen     bool
+    Flagged    bool
+    LargerThan int
+    Limit      int
+    Offset     int
+}
+
+// searchCriteria maps req onto IMAP SEARCH keys. Dates are compared with
+// the messages' internal (received) date, by day as IMAP does.
+func searchCriteria(req searchEmailsRequest) (*imap.SearchCriteria, error) {
+    criteria := imap.NewSearchCriteria()
+    if req.From != "" {
+        criteria.Header.Add("From", req.From)
+    }
+    if req.To != "" {
+        criteria.Header.Add("To", req.To)
+    }
+    if req.Subject != "" {
+        criteria.Header.Add("Subject", req.Subject)
+    }
+    if req.Body != "" {
+        criteria.Body = []string{req.Body}
+    }
+    if req.Since != "" {
+        t, _, err := parseTimeArg(req.Since, nil)
+        if err != nil {
+            return nil, fmt.Errorf("invalid since: %v", err)
+        }
+        criteria.Since = t
+    }
+    if req.Before != "" {
+        t, _, err := parseTimeArg(req.Before, nil)
+        if err != nil {
+            return nil, fmt.Errorf("invalid before: %v", err)
+        }
+        criteria.Before = t
+    }
+    if req.Unseen {
+        criteria.WithoutFlags = append(criteria.WithoutFlags, imap.SeenFlag)
+    }
+    if req.Flagged {
+        criteria.WithFlags = append(criteria.WithFlags, imap.FlaggedFlag)
+    }
+    if req.LargerThan < 0 {
+        return nil, fmt.Errorf("larger_than must not be negative")
+    }
+    criteria.Larger = uint32(req.LargerThan)
+    return criteria, nil
+}
+
+// emailSummary describes a message in structured tool output.
+type emailSummary struct {
+    UID     uint32   `json:"uid"`
+    Subject string   `json:"subject"`
+    From    string   `json:"from,omitempty"`
+    To      []string `json:"to,omitempty"`
+    Date    string   `json:"date,omitempty"`
+    Flags   []string `json:"flags"`
+    Size    uint32   `json:"size,omitempty"`
+}
+
+func newEmailSummary(msg *imap.Message) emailSummary {
+    summary := emailSummary{UID: msg.Uid, Flags: msg.Flags, Size: msg.Size}
+    if summary.Flags == nil {
+        summary.Flags = []string{}
+    }
+    if env := msg.Envelope; env != nil {
+        summary.Subject = env.Subject
+        if len(env.From) > 0 {
+            summary.From = formatAddress(env.From[0])
+        }
+        for _, addr := range env.To {
+            summary.To = append(summary.To, formatAddress(addr))
+        }
+        if !env.Date.IsZero() {
+            summary.Date = env.Date.Format(time.RFC3339)
+        }
+    }
+    return summary
+}
+
+// fetchSummaries fetches the envelope, flags and size of the messages with
+// the given UIDs in the selected mailbox, in the order of uids.
+func fetchSummaries(c *client.Client, uids []uint32) ([]emailSummary, error) {
+    if len(uids) == 0 {
+        return nil, nil
+    }
+    seqset := new(imap.SeqSet)
+    seqset.AddNum(uids...)
+    items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchUid}
+
+    messages := make(chan *imap.Message, 10)
+    done := make(chan error, 1)
+    go func() {
+        done <- c.UidFetch(seqset, items, messages)
+    }()
+
+    byUID := make(map[uint32]emailSummary)
+    for msg := range messages {
+        byUID[msg.Uid] = newEmailSummary(msg)
+    }
+    if err := <-done; err != nil {
+        return nil, fmt.Errorf("Failed to fetch messages: %v", err)
+    }
+
+    summaries := make([]emailSummary, 0, len(uids))
+    for _, uid := range uids {
+        if summary, ok := byUID[uid]; ok {
+            summaries = append(summaries, summary)
+        }
+    }
+    return summaries, nil
+}
+
+type searchEmailsOutput struct {
+    Mailbox     string         `json:"mailbox"`
+    UIDValidity uint32         `json:"uid_validity"`
+    Total       int            `json:"total"`
+    Offset      int            `json:"offset"`
+    NextOffset  int            `json:"next_offset,omitempty"`
+    Messages    []emailSummary `json:"messages"`
+}
+
+// runSearchEmails runs a UID SEARCH and returns a page of the matching
+// messages, newest (highest UID) first.
+func runSearchEmails(req searchEmailsRequest) (*mcp.CallToolResult, any, error) {
+    if req.Mailbox == "" {
+        req.Mailbox = "INBOX"
+    }
+    if req.Limit <= 0 {
+        req.Limit = 20
+    }
+    if req.Limit > 100 {
+        req.Limit = 100
+    }
+    if req.Offset < 0 {
+        req.Offset = 0
+    }
+
+    criteria, err := searchCriteria(req)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid search: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    c, err := dialIMAP()
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    defer c.Logout()
+
+    mailbox, mbox, err := selectMailbox(c, req.Mailbox, 0)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    uids, err := c.UidSearch(criteria)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Search failed: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+
+    out := searchEmailsOutput{
+        Mailbox:     mailbox,
+        UIDValidity: mbox.UidValidity,
+        Total:       len(uids),
+        Offset:      req.Offset,
+        Messages:    []emailSummary{},
+    }
+    page := []uint32{}
+    if req.Offset < len(uids) {
+        page = uids[req.Offset:]
+        if len(page) > req.Limit {
+            page = page[:req.Limit]
+            out.NextOffset = req.Offset + req.Limit
+        }
+    }
+
+    summaries, err := fetchSummaries(c, page)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    out.Messages = append(out.Messages, summaries...)
+
+    result := fmt.Sprintf("%d message(s) in %s match", out.Total, mailbox)
+    if len(summaries) > 0 {
+        result += fmt.Sprintf(", showing %d-%d", req.Offset+1, req.Offset+len(summaries))
+    }
+    result += ".\n"
+    for _, summary := range summaries {
+        result += fmt.Sprintf("---\nUID: %d\nSubject: %s\nDate: %s\nFrom: %s\n", summary.UID, summary.Subject, summary.Date, summary.From)
+        if len(summary.To) > 0 {
+            result += fmt.Sprintf("To: %s\n", strings.Join(summary.To, ", "))
+        }
+        if len(summary.Flags) > 0 {
+            result += fmt.Sprintf("Flags: %s\n", strings.Join(summary.Flags, " "))
+        }
+    }
+    if out.NextOffset > 0 {
+        result += fmt.Sprintf("---\nMore results: use offset %d.\n", out.NextOffset)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
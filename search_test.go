@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// startSearch serves an INBOX with five reports (UIDs 7-11), the
+// even-numbered ones from alice@example.com and the odd ones from Bob,
+// and a large message (UID 12).
+func startSearch(t *testing.T) {
+    t.Helper()
+    var msgs []string
+    for i := 0; i < 5; i++ {
+        from := "alice@example.com"
+        if i%2 == 1 {
+            from = "Bob <bob@example.com>"
+        }
+        msgs = append(msgs, fmt.Sprintf("From: %s\r\nTo: me@example.com\r\nSubject: Report %d\r\nDate: Mon, 02 Jun 2025 15:04:05 +0000\r\n\r\nThe quarterly numbers, part %d.\r\n", from, i, i))
+    }
+    msgs = append(msgs, "From: carol@example.com\r\nTo: me@example.com\r\nSubject: Big\r\n\r\n"+strings.Repeat("x", 4000)+"\r\n")
+    startIMAP(t, msgs...)
+}
+
+func searchUIDs(t *testing.T, req searchEmailsRequest) searchEmailsOutput {
+    t.Helper()
+    res, out, err := runSearchEmails(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resultText(t, res, false)
+    return out.(searchEmailsOutput)
+}
+
+func uidsOf(out searchEmailsOutput) []uint32 {
+    uids := []uint32{}
+    for _, msg := range out.Messages {
+        uids = append(uids, msg.UID)
+    }
+    return uids
+}
+
+func TestSearchEmails(t *testing.T) {
+    startSearch(t)
+
+    tests := []struct {
+        name string
+        req  searchEmailsRequest
+        want []uint32
+    }{
+        {"all", searchEmailsRequest{}, []uint32{12, 11, 10, 9, 8, 7, 6}},
+        {"from", searchEmailsRequest{From: "bob"}, []uint32{10, 8}},
+        {"to", searchEmailsRequest{To: "me@example.com", Subject: "report 3"}, []uint32{10}},
+        {"body", searchEmailsRequest{Body: "quarterly"}, []uint32{11, 10, 9, 8, 7}},
+        {"larger than", searchEmailsRequest{LargerThan: 2000}, []uint32{12}},
+        {"no match", searchEmailsRequest{From: "nobody"}, []uint32{}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            out := searchUIDs(t, tt.req)
+            if got := fmt.Sprint(uidsOf(out)); got != fmt.Sprint(tt.want) {
+                t.Errorf("UIDs = %s, want %s", got, fmt.Sprint(tt.want))
+            }
+            if out.Total != len(tt.want) || out.NextOffset != 0 {
+                t.Errorf("total = %d, next_offset = %d", out.Total, out.NextOffset)
+            }
+            if out.Mailbox != "INBOX" || out.UIDValidity == 0 {
+                t.Errorf("mailbox = %q, uid_validity = %d", out.Mailbox, out.UIDValidity)
+            }
+        })
+    }
+}
+
+func TestSearchEmailsSummary(t *testing.T) {
+    startSearch(t)
+
+    out := searchUIDs(t, searchEmailsRequest{From: "bob", Subject: "report 1"})
+    if len(out.Messages) != 1 {
+        t.Fatalf("messages = %+v", out.Messages)
+    }
+    msg := out.Messages[0]
+    if msg.UID != 8 || msg.Subject != "Report 1" || msg.From != "Bob <bob@example.com>" ||
+        fmt.Sprint(msg.To) != "[me@example.com]" || msg.Date != "2025-06-02T15:04:05Z" || msg.Size == 0 {
+        t.Errorf("message = %+v", msg)
+    }
+}
+
+func TestSearchEmailsPagination(t *testing.T) {
+    startSearch(t)
+
+    tests := []struct {
+        offset         int
+        want           []uint32
+        wantNextOffset int
+    }{
+        {0, []uint32{11, 10}, 2},
+        {2, []uint32{9, 8}, 4},
+        {4, []uint32{7}, 0},
+        {6, []uint32{}, 0},
+    }
+    for _, tt := range tests {
+        t.Run(fmt.Sprint(tt.offset), func(t *testing.T) {
+            out := searchUIDs(t, searchEmailsRequest{Subject: "report", Limit: 2, Offset: tt.offset})
+            if got := fmt.Sprint(uidsOf(out)); got != fmt.Sprint(tt.want) {
+                t.Errorf("UIDs = %s, want %s", got, fmt.Sprint(tt.want))
+            }
+            if out.Total != 5 || out.Offset != tt.offset || out.NextOffset != tt.wantNextOffset {
+                t.Errorf("total = %d, offset = %d, next_offset = %d, want 5, %d, %d", out.Total, out.Offset, out.NextOffset, tt.offset, tt.wantNextOffset)
+            }
+        })
+    }
+}
+
+func TestSearchEmailsErrors(t *testing.T) {
+    startSearch(t)
+
+    tests := []struct {
+        name string
+        req  searchEmailsRequest
+        want string
+    }{
+        {"invalid since", searchEmailsRequest{Since: "garbage"}, "invalid since"},
+        {"invalid before", searchEmailsRequest{Before: "garbage"}, "invalid before"},
+        {"negative size", searchEmailsRequest{LargerThan: -1}, "larger_than must not be negative"},
+        {"missing special-use mailbox", searchEmailsRequest{Mailbox: `\Archive`}, `No mailbox has the special-use attribute \Archive`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, _, err := runSearchEmails(tt.req)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, tt.want) {
+                t.Errorf("error = %q, want it to contain %q", text, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// stateDir returns the directory local state such as sync tokens is kept
+// in. Losing it only costs a full resync.
+func stateDir() (string, error) {
+    if dir := os.Getenv("ICLOUD_MCP_STATE_DIR"); dir != "" {
+        return dir, nil
+    }
+    dir, err := os.UserCacheDir()
+    if err != nil {
+        return "", fmt.Errorf("no state directory: %v (set ICLOUD_MCP_STATE_DIR)", err)
+    }
+    return filepath.Join(dir, "icloud-mcp"), nil
+}
+
+// syncState is what sync_calendar remembers about a collection between
+// calls: the RFC 6578 sync token if the server supports sync-collection,
+// the CalendarServer ctag otherwise, and the ETag of every member, which
+// is used to tell created from changed objects.
+type syncState struct {
+    Collection string            `json:"collection"`
+    SyncToken  string            `json:"sync_token,omitempty"`
+    CTag       string            `json:"ctag,omitempty"`
+    ETags      map[string]string `json:"etags"`
+
+    // NoSync records that the server rejected sync-collection, so it isn't
+    // tried again until the state is reset.
+    NoSync bool `json:"no_sync,omitempty"`
+}
+
+// stateFile returns the file in the kind subdirectory of the state
+// directory that holds state about collection. The account is part of the
+// key so that switching accounts doesn't reuse another account's state.
+func stateFile(kind, account, collection string) (string, error) {
+    dir, err := stateDir()
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256([]byte(account + "\n" + collection))
+    return filepath.Join(dir, kind, hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// syncStatePath returns the file the sync state of collection is stored
+// in.
+func syncStatePath(account, collection string) (string, error) {
+    return stateFile("sync", account, collection)
+}
+
+func loadSyncState(p, collection string) (*syncState, error) {
+    state := &syncState{Collection: collection, ETags: make(map[string]string)}
+    data, err := os.ReadFile(p)
+    if errors.Is(err, os.ErrNotExist) {
+        return state, nil
+    } else if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, state); err != nil {
+        log.Printf("Ignoring corrupt sync state %s: %v", p, err)
+        return &syncState{Collection: collection, ETags: make(map[string]string)}, nil
+    }
+    if state.ETags == nil {
+        state.ETags = make(map[string]string)
+    }
+    return state, nil
+}
+
+func saveSyncState(p string, state *syncState) error {
+    return writeStateFile(p, state)
+}
+
+// writeStateFile stores v as JSON in p, replacing the file atomically so
+// that a crash never leaves half-written state behind.
+func writeStateFile(p string, v any) error {
+    if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+        return err
+    }
+    data, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp := p + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, p)
+}
+
+type syncMultiStatus struct {
+    Responses []struct {
+        Href      string `xml:"DAV: href"`
+        Status    string `xml:"DAV: status"`
+        PropStats []struct {
+            Prop struct {
+                ETag         string `xml:"DAV: getetag"`
+                CTag         string `xml:"http://calendarserver.org/ns/ getctag"`
+                ResourceType struct {
+                    Collection *struct{} `xml:"DAV: collection"`
+                } `xml:"DAV: resourcetype"`
+            } `xml:"DAV: prop"`
+            Status string `xml:"DAV: status"`
+        } `xml:"DAV: propstat"`
+    } `xml:"DAV: response"`
+    SyncToken string `xml:"DAV: sync-token"`
+}
+
+// statusOK reports whether an HTTP status line such as "HTTP/1.1 200 OK"
+// is a success. A missing status counts as success.
+func statusOK(status string) bool {
+    fields := strings.Fields(status)
+    return len(fields) < 2 || strings.HasPrefix(fields[1], "2")
+}
+
+// hrefPath returns the path of a multistatus href, which may be a full URL.
+func hrefPath(href string) string {
+    if u, err := url.Parse(href); err == nil {
+        return u.Path
+    }
+    return href
+}
+
+// multiStatus sends body as a WebDAV request to the client's collection and
+// decodes the multistatus response.
+func (c *calDAVClient) multiStatus(ctx context.Context, method, depth, body string) (*syncMultiStatus, error) {
+    req, err := c.newRequest(ctx, method, c.collectionPath(), strings.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+    req.Header.Set("Depth", depth)
+
+    resp, err := c.do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusMultiStatus {
+        return nil, &calDAVStatusError{Method: method, Path: req.URL.Path, StatusCode: resp.StatusCode, Status: resp.Status}
+    }
+
+    var ms syncMultiStatus
+    if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+        return nil, fmt.Errorf("invalid %s response: %v", method, err)
+    }
+    return &ms, nil
+}
+
+// syncChanges is the difference between two states of a collection.
+type syncChanges struct {
+    Changed []string // created or modified object paths
+    Deleted []string
+}
+
+// syncCollection runs an RFC 6578 sync-collection REPORT from token and
+// applies the result to etags. An empty token requests all members.
+func (c *calDAVClient) syncCollection(ctx context.Context, token string, etags map[string]string) (string, syncChanges, error) {
+    var body strings.Builder
+    body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+    body.WriteString(`<d:sync-collection xmlns:d="DAV:"><d:sync-token>`)
+    xml.EscapeText(&body, []byte(token))
+    body.WriteString(`</d:sync-token><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`)
+
+    ms, err := c.multiStatus(ctx, "REPORT", "0", body.String())
+    if err != nil {
+        return "", syncChanges{}, err
+    }
+    if ms.SyncToken == "" {
+        return "", syncChanges{}, fmt.Errorf("server returned no sync token")
+    }
+
+    // A full listing replaces the known members, so anything not in it
+    // has been deleted.
+    seen := make(map[string]bool)
+    var changes syncChanges
+    collection := strings.TrimSuffix(c.collectionPath(), "/")
+    for _, r := range ms.Responses {
+        p := hrefPath(r.Href)
+        if strings.TrimSuffix(p, "/") == collection {
+            continue
+        }
+        if !statusOK(r.Status) {
+            if _, ok := etags[p]; ok {
+                delete(etags, p)
+                changes.Deleted = append(changes.Deleted, p)
+            }
+            continue
+        }
+        for _, ps := range r.PropStats {
+            if !statusOK(ps.Status) || ps.Prop.ETag == "" {
+                continue
+            }
+            seen[p] = true
+            if etags[p] != ps.Prop.ETag {
+                etags[p] = ps.Prop.ETag
+                changes.Changed = append(changes.Changed, p)
+            }
+        }
+    }
+    if token == "" {
+        for p := range etags {
+            if !seen[p] {
+                delete(etags, p)
+                changes.Deleted = append(changes.Deleted, p)
+            }
+        }
+    }
+    return ms.SyncToken, changes, nil
+}
+
+// errSyncUnsupported stands in for the sync-collection error once the
+// server has refused the REPORT, so it isn't sent again.
+var errSyncUnsupported = errors.New("not supported by the server")
+
+// syncUnsupported reports whether err says the server doesn't implement
+// the sync-collection REPORT: 405 or 501, or 403 with the
+// DAV:supported-report precondition (RFC 3253 section 3.6).
+func syncUnsupported(err error) bool {
+    if errors.Is(err, errSyncUnsupported) {
+        return true
+    }
+    var statusErr *calDAVStatusError
+    if !errors.As(err, &statusErr) {
+        return false
+    }
+    switch statusErr.StatusCode {
+    case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+        return true
+    case http.StatusForbidden:
+        return statusErr.Precondition == xml.Name{Space: "DAV:", Local: "supported-report"}
+    }
+    return false
+}
+
+// collectionCTag returns the CalendarServer getctag of the collection, or
+// "" if the server doesn't report one.
+func (c *calDAVClient) collectionCTag(ctx context.Context) (string, error) {
+    ms, err := c.multiStatus(ctx, "PROPFIND", "0", `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><cs:getctag/></d:prop></d:propfind>`)
+    if err != nil {
+        return "", err
+    }
+    for _, r := range ms.Responses {
+        for _, ps := range r.PropStats {
+            if statusOK(ps.Status) && ps.Prop.CTag != "" {
+                return ps.Prop.CTag, nil
+            }
+        }
+    }
+    return "", nil
+}
+
+// memberETags lists the members of the collection with their ETags.
+func (c *calDAVClient) memberETags(ctx context.Context) (map[string]string, error) {
+    ms, err := c.multiStatus(ctx, "PROPFIND", "1", `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/><d:resourcetype/></d:prop></d:propfind>`)
+    if err != nil {
+        return nil, err
+    }
+
+    etags := make(map[string]string)
+    for _, r := range ms.Responses {
+        for _, ps := range r.PropStats {
+            if statusOK(ps.Status) && ps.Prop.ETag != "" && ps.Prop.ResourceType.Collection == nil {
+                etags[hrefPath(r.Href)] = ps.Prop.ETag
+            }
+        }
+    }
+    return etags, nil
+}
+
+// compareETags lists the members of the collection with their ETags and
+// applies the differences to etags. This is the fallback for servers
+// without sync-collection.
+func (c *calDAVClient) compareETags(ctx context.Context, etags map[string]string) (syncChanges, error) {
+    current, err := c.memberETags(ctx)
+    if err != nil {
+        return syncChanges{}, err
+    }
+
+    var changes syncChanges
+    for p, etag := range current {
+        if etags[p] != etag {
+            etags[p] = etag
+            changes.Changed = append(changes.Changed, p)
+        }
+    }
+    for p := range etags {
+        if _, ok := current[p]; !ok {
+            delete(etags, p)
+            changes.Deleted = append(changes.Deleted, p)
+        }
+    }
+    return changes, nil
+}
+
+// syncedObject is a created or changed object in the output of
+// sync_calendar.
+type syncedObject struct {
+    Path    string `json:"path"`
+    UID     string `json:"uid,omitempty"`
+    ETag    string `json:"etag,omitempty"`
+    Summary string `json:"summary,omitempty"`
+    Created bool   `json:"created"`
+}
+
+type syncCalendarOutput struct {
+    Collection string         `json:"collection"`
+    Method     string         `json:"method"`
+    Initial    bool           `json:"initial"`
+    Changed    []syncedObject `json:"changed"`
+    Deleted    []string       `json:"deleted"`
+}
+
+// runSyncCalendar reports the objects created, changed and deleted in a
+// collection since the previous call. It uses sync-collection when the
+// server supports it and falls back to comparing the ctag and ETags.
+func runSyncCalendar(ctx context.Context, calendar, compType string, reset bool) (*mcp.CallToolResult, any, error) {
+    urlEnv := "ICLOUD_CALDAV_URL"
+    if compType == ical.CompToDo {
+        urlEnv = "ICLOUD_REMINDERS_URL"
+    }
+    client, err := getCalDAVClient(ctx, urlEnv, compType, calendar)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Client error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    account, err := getEnv("ICLOUD_EMAIL")
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Configuration error: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    collection := client.collectionURL()
+    statePath, err := syncStatePath(account, collection)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+            IsError: true,
+        }, nil, nil
+    }
+    state, err := loadSyncState(statePath, collection)
+    if err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to read sync state: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if reset {
+        state = &syncState{Collection: collection, ETags: make(map[string]string)}
+    }
+    initial := state.SyncToken == "" && state.CTag == "" && len(state.ETags) == 0
+    previous := make(map[string]bool, len(state.ETags))
+    for p := range state.ETags {
+        previous[p] = true
+    }
+
+    out := syncCalendarOutput{Collection: client.collectionPath(), Method: "sync-collection", Initial: initial}
+    var token string
+    var changes syncChanges
+    err = errSyncUnsupported
+    if !state.NoSync {
+        token, changes, err = client.syncCollection(ctx, state.SyncToken, state.ETags)
+    }
+    var statusErr *calDAVStatusError
+    if err != nil && state.SyncToken != "" && errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+        // The token expired or was invalidated; start over from a full
+        // listing, which is diffed against the known ETags.
+        log.Printf("Sync token for %s rejected (%v), resyncing", collection, err)
+        token, changes, err = client.syncCollection(ctx, "", state.ETags)
+    }
+    if err != nil && errors.As(err, &statusErr) && statusErr.StatusCode/100 == 4 && !syncUnsupported(err) {
+        // Authentication, permission or missing-collection errors would
+        // fail the ETag comparison too.
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to sync %s: %v", client.collectionPath(), err)}},
+            IsError: true,
+        }, nil, nil
+    }
+    if err == nil {
+        state.SyncToken = token
+        state.CTag = ""
+    } else {
+        log.Printf("sync-collection on %s failed (%v), comparing ETags", collection, err)
+        out.Method = "etag"
+        state.SyncToken = ""
+        // Only a definite refusal disables sync-collection; network errors
+        // and server failures may be transient.
+        if syncUnsupported(err) {
+            state.NoSync = true
+        }
+
+        ctag, err := client.collectionCTag(ctx)
+        if err != nil {
+            log.Printf("Failed to get ctag of %s: %v", collection, err)
+        }
+        changes = syncChanges{}
+        if ctag == "" || ctag != state.CTag || initial {
+            changes, err = client.compareETags(ctx, state.ETags)
+            if err != nil {
+                return &mcp.CallToolResult{
+                    Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to list %s: %v", client.collectionPath(), err)}},
+                    IsError: true,
+                }, nil, nil
+            }
+        }
+        state.CTag = ctag
+    }
+
+    out.Changed = []syncedObject{}
+    out.Deleted = changes.Deleted
+    if out.Deleted == nil {
+        out.Deleted = []string{}
+    }
+    sort.Strings(out.Deleted)
+    sort.Strings(changes.Changed)
+
+    if len(changes.Changed) > 0 {
+        objs, err := client.MultiGetCalendar(ctx, "", &caldav.CalendarMultiGet{
+            Paths: changes.Changed,
+            CompRequest: caldav.CalendarCompRequest{
+                Name: "VCALENDAR",
+                Comps: []caldav.CalendarCompRequest{
+                    {
+                        Name:  compType,
+                        Props: []string{"UID", "SUMMARY"},
+                    },
+                },
+            },
+        })
+        if err != nil {
+            log.Printf("Failed to fetch changed objects: %v", err)
+        }
+        byPath := make(map[string]caldav.CalendarObject, len(objs))
+        for _, obj := range objs {
+            byPath[obj.Path] = obj
+        }
+        for _, p := range changes.Changed {
+            synced := syncedObject{Path: p, ETag: state.ETags[p], Created: !previous[p]}
+            if obj, ok := byPath[p]; ok && obj.Data != nil {
+                synced.UID = objectUID(obj.Data)
+                if comp := masterComponent(obj.Data, compType); comp != nil {
+                    synced.Summary, _ = comp.Props.Text(ical.PropSummary)
+                }
+            }
+            out.Changed = append(out.Changed, synced)
+        }
+    }
+
+    if err := saveSyncState(statePath, state); err != nil {
+        return &mcp.CallToolResult{
+            Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to save sync state: %v", err)}},
+            IsError: true,
+        }, nil, nil
+    }
+
+    result := fmt.Sprintf("Synced %s using %s", out.Collection, out.Method)
+    if initial {
+        result += " (initial sync, all objects are reported as created)"
+    }
+    result += fmt.Sprintf(": %d created or changed, %d deleted.\n", len(out.Changed), len(out.Deleted))
+    for _, obj := range out.Changed {
+        kind := "Changed"
+        if obj.Created {
+            kind = "Created"
+        }
+        result += fmt.Sprintf("%s: %s\n", kind, obj.Path)
+        if obj.Summary != "" {
+            result += fmt.Sprintf("  Summary: %s\n", obj.Summary)
+        }
+        if obj.UID != "" {
+            result += fmt.Sprintf("  UID: %s\n", obj.UID)
+        }
+    }
+    for _, p := range out.Deleted {
+        result += fmt.Sprintf("Deleted: %s\n", p)
+    }
+
+    return &mcp.CallToolResult{
+        Content: []mcp.Content{&mcp.TextContent{Text: result}},
+    }, out, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// syncReportStatus answers sync-collection REPORTs with status and reply,
+// counting them in reports, and passes other requests to h.
+func syncReportStatus(status int, reply string, reports *int32) func(http.Handler) http.Handler {
+    return func(h http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method != "REPORT" {
+                h.ServeHTTP(w, r)
+                return
+            }
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+            if bytes.Contains(body, []byte("sync-collection")) {
+                atomic.AddInt32(reports, 1)
+                if reply != "" {
+                    w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+                }
+                w.WriteHeader(status)
+                io.WriteString(w, reply)
+                return
+            }
+            h.ServeHTTP(w, r)
+        })
+    }
+}
+
+const supportedReportError = `<?xml version="1.0" encoding="utf-8"?>
+<d:error xmlns:d="DAV:"><d:supported-report/></d:error>`
+
+func TestSyncCalendarFallback(t *testing.T) {
+    tests := []struct {
+        name       string
+        status     int
+        body       string
+        wantNoSync bool
+    }{
+        {"method not allowed", http.StatusMethodNotAllowed, "", true},
+        {"not implemented", http.StatusNotImplemented, "", true},
+        {"unsupported report", http.StatusForbidden, supportedReportError, true},
+        {"server error", http.StatusInternalServerError, "", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var reports int32
+            startCalDAVHandler(t, syncReportStatus(tt.status, tt.body, &reports))
+            created := createEvent(t, newEventRequest{Summary: "Standup", StartTime: "2025-07-01T09:00:00Z", EndTime: "2025-07-01T09:15:00Z"})
+
+            res, out, err := runSyncCalendar(context.Background(), "", "VEVENT", false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            resultText(t, res, false)
+            sync := out.(syncCalendarOutput)
+            if sync.Method != "etag" || len(sync.Changed) != 1 || sync.Changed[0].Path != created.Path {
+                t.Errorf("output = %+v", sync)
+            }
+
+            // A refusal isn't retried, in any later sync; other failures
+            // may be transient.
+            for i := 0; i < 2; i++ {
+                res, out, err = runSyncCalendar(context.Background(), "", "VEVENT", false)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                resultText(t, res, false)
+                if sync := out.(syncCalendarOutput); sync.Method != "etag" || len(sync.Changed) != 0 {
+                    t.Errorf("output = %+v", sync)
+                }
+            }
+            want := int32(3)
+            if tt.wantNoSync {
+                want = 1
+            }
+            if reports != want {
+                t.Errorf("%d sync-collection REPORT(s), want %d", reports, want)
+            }
+        })
+    }
+}
+
+func TestSyncCalendarClientError(t *testing.T) {
+    tests := []struct {
+        name   string
+        status int
+        body   string
+    }{
+        {"unauthorized", http.StatusUnauthorized, ""},
+        {"forbidden", http.StatusForbidden, ""},
+        {"other precondition", http.StatusForbidden, `<d:error xmlns:d="DAV:"><d:need-privileges/></d:error>`},
+        {"not found", http.StatusNotFound, ""},
+        {"bad request", http.StatusBadRequest, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var reports int32
+            startCalDAVHandler(t, syncReportStatus(tt.status, tt.body, &reports))
+
+            res, _, err := runSyncCalendar(context.Background(), "", "VEVENT", false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if text := resultText(t, res, true); !strings.Contains(text, "Failed to sync") {
+                t.Errorf("error = %q", text)
+            }
+
+            // The failure wasn't taken as a refusal of sync-collection.
+            runSyncCalendar(context.Background(), "", "VEVENT", false)
+            if reports != 2 {
+                t.Errorf("%d sync-collection REPORT(s), want 2", reports)
+            }
+        })
+    }
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeArgHint lists the forms parseTimeArg accepts, for error messages and
+// tool descriptions.
+const timeArgHint = `RFC3339, YYYY-MM-DD, YYYY-MM-DDTHH:MM, "now", "today", "tomorrow 3pm", "next monday", "friday 14:30" or an offset like "+2h" or "-1d"`
+
+// userLocation returns the timezone time arguments without a UTC offset
+// are interpreted in: ICLOUD_MCP_TIMEZONE if set, the server's local
+// timezone otherwise.
+func userLocation() (*time.Location, error) {
+    name := os.Getenv("ICLOUD_MCP_TIMEZONE")
+    if name == "" {
+        return time.Local, nil
+    }
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return nil, fmt.Errorf("invalid ICLOUD_MCP_TIMEZONE %q: %v", name, err)
+    }
+    return loc, nil
+}
+
+// resolveLocation returns loc, or the user's timezone if loc is nil.
+func resolveLocation(loc *time.Location) (*time.Location, error) {
+    if loc != nil {
+        return loc, nil
+    }
+    return userLocation()
+}
+
+// parseTimeArg parses a time argument relative to the current time. Times
+// and dates without a UTC offset are interpreted in loc, or in the user's
+// timezone if loc is nil. dateOnly reports that value named a day without
+// a time of day; t is then midnight of that day.
+func parseTimeArg(value string, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+    loc, err = resolveLocation(loc)
+    if err != nil {
+        return time.Time{}, false, err
+    }
+    return parseTimeAt(value, time.Now(), loc)
+}
+
+var weekdays = map[string]time.Weekday{
+    "sunday": time.Sunday, "sun": time.Sunday,
+    "monday": time.Monday, "mon": time.Monday,
+    "tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+    "wednesday": time.Wednesday, "wed": time.Wednesday,
+    "thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+    "friday": time.Friday, "fri": time.Friday,
+    "saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseTimeAt is parseTimeArg with an explicit current time and location.
+func parseTimeAt(value string, now time.Time, loc *time.Location) (time.Time, bool, error) {
+    s := strings.ToLower(strings.Join(strings.Fields(value), " "))
+    invalid := fmt.Errorf("cannot parse time %q: use %s", value, timeArgHint)
+    if s == "" {
+        return time.Time{}, false, fmt.Errorf("empty time: use %s", timeArgHint)
+    }
+
+    if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+        return t, false, nil
+    }
+    for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+        if t, err := time.ParseInLocation(layout, strings.ToUpper(s), loc); err == nil {
+            return t, false, nil
+        }
+    }
+    if t, err := time.ParseInLocation(time.DateOnly, s, loc); err == nil {
+        return t, true, nil
+    }
+
+    if s == "now" {
+        return now, false, nil
+    }
+    if (s[0] == '+' || s[0] == '-') && len(s) > 1 {
+        d, err := parseAlertOffset(s)
+        if err != nil {
+            return time.Time{}, false, invalid
+        }
+        return now.Add(d), false, nil
+    }
+
+    // A day, optionally followed by a time of day, or just a time of day
+    // meaning today.
+    now = now.In(loc)
+    words := strings.Fields(s)
+    days := 0
+    switch {
+    case words[0] == "today":
+        words = words[1:]
+    case words[0] == "tomorrow":
+        days, words = 1, words[1:]
+    case words[0] == "yesterday":
+        days, words = -1, words[1:]
+    case (words[0] == "next" || words[0] == "this") && len(words) > 1:
+        wd, ok := weekdays[words[1]]
+        if !ok {
+            return time.Time{}, false, invalid
+        }
+        days = int(wd-now.Weekday()+7) % 7
+        if words[0] == "next" && days == 0 {
+            days = 7
+        }
+        words = words[2:]
+    default:
+        if wd, ok := weekdays[words[0]]; ok {
+            days = int(wd-now.Weekday()+7) % 7
+            words = words[1:]
+        } else if _, _, ok := parseTimeOfDay(strings.Join(words, "")); !ok {
+            return time.Time{}, false, invalid
+        }
+    }
+
+    y, m, d := now.Date()
+    day := time.Date(y, m, d+days, 0, 0, 0, 0, loc)
+    if len(words) > 0 && words[0] == "at" {
+        words = words[1:]
+    }
+    if len(words) == 0 {
+        return day, true, nil
+    }
+    hour, min, ok := parseTimeOfDay(strings.Join(words, ""))
+    if !ok {
+        return time.Time{}, false, invalid
+    }
+    return time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, loc), false, nil
+}
+
+// parseTimeOfDay parses "15:30", "3pm", "3:30pm", "noon" or "midnight".
+func parseTimeOfDay(s string) (hour, min int, ok bool) {
+    switch s {
+    case "noon":
+        return 12, 0, true
+    case "midnight":
+        return 0, 0, true
+    }
+
+    suffix := ""
+    if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+        suffix, s = s[len(s)-2:], s[:len(s)-2]
+    }
+    h, m, hasMin := strings.Cut(s, ":")
+    hour, err := strconv.Atoi(h)
+    if err != nil {
+        return 0, 0, false
+    }
+    if hasMin {
+        if len(m) != 2 {
+            return 0, 0, false
+        }
+        if min, err = strconv.Atoi(m); err != nil || min > 59 {
+            return 0, 0, false
+        }
+    } else if suffix == "" {
+        // A bare number isn't a time of day.
+        return 0, 0, false
+    }
+
+    switch suffix {
+    case "":
+        if hour > 23 {
+            return 0, 0, false
+        }
+    default:
+        if hour < 1 || hour > 12 {
+            return 0, 0, false
+        }
+        hour %= 12
+        if suffix == "pm" {
+            hour += 12
+        }
+    }
+    return hour, min, true
+}
+
+// parseTimeRange parses the start_time and end_time arguments of a query.
+// Both are required, except that a start date alone means that whole day.
+// An end date includes the whole day. ok is false if neither is given.
+func parseTimeRange(startValue, endValue string) (start, end time.Time, ok bool, err error) {
+    if startValue == "" && endValue == "" {
+        return time.Time{}, time.Time{}, false, nil
+    }
+    if startValue == "" {
+        return time.Time{}, time.Time{}, false, fmt.Errorf("start_time is required with end_time")
+    }
+
+    start, startDate, err := parseTimeArg(startValue, nil)
+    if err != nil {
+        return time.Time{}, time.Time{}, false, fmt.Errorf("invalid start_time: %v", err)
+    }
+    if endValue == "" {
+        if !startDate {
+            return time.Time{}, time.Time{}, false, fmt.Errorf("end_time is required unless start_time is a date")
+        }
+        return start, start.AddDate(0, 0, 1), true, nil
+    }
+
+    end, endDate, err := parseTimeArg(endValue, nil)
+    if err != nil {
+        return time.Time{}, time.Time{}, false, fmt.Errorf("invalid end_time: %v", err)
+    }
+    if endDate {
+        end = end.AddDate(0, 0, 1)
+    }
+    if !end.After(start) {
+        return time.Time{}, time.Time{}, false, fmt.Errorf("end_time must be after start_time")
+    }
+    return start, end, true, nil
+}
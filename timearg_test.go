@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeAt(t *testing.T) {
+    berlin, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // A Wednesday.
+    now := time.Date(2025, 7, 2, 10, 30, 0, 0, berlin)
+    at := func(month time.Month, day, hour, min int) time.Time {
+        return time.Date(2025, month, day, hour, min, 0, 0, berlin)
+    }
+
+    tests := []struct {
+        value    string
+        want     time.Time
+        dateOnly bool
+    }{
+        // Absolute times and dates.
+        {"2025-07-01T10:00:00Z", time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC), false},
+        {"2025-07-01t10:00:00+02:00", at(7, 1, 10, 0), false},
+        {"2025-07-01T10:00", at(7, 1, 10, 0), false},
+        {"2025-07-01 10:00:30", at(7, 1, 10, 0).Add(30 * time.Second), false},
+        {"2025-07-01", at(7, 1, 0, 0), true},
+
+        // Offsets from now.
+        {"now", now, false},
+        {"+2h", now.Add(2 * time.Hour), false},
+        {"-1d", now.Add(-24 * time.Hour), false},
+        {"+1d2h", now.Add(26 * time.Hour), false},
+        {"+90m", now.Add(90 * time.Minute), false},
+
+        // Days.
+        {"today", at(7, 2, 0, 0), true},
+        {"tomorrow", at(7, 3, 0, 0), true},
+        {"yesterday", at(7, 1, 0, 0), true},
+        {"friday", at(7, 4, 0, 0), true},
+        {"wednesday", at(7, 2, 0, 0), true},
+        {"this wednesday", at(7, 2, 0, 0), true},
+        {"next wednesday", at(7, 9, 0, 0), true},
+        {"next fri", at(7, 4, 0, 0), true},
+        {"mon", at(7, 7, 0, 0), true},
+
+        // Days with a time of day, and times of day alone.
+        {"tomorrow 3pm", at(7, 3, 15, 0), false},
+        {"  Tomorrow   3PM ", at(7, 3, 15, 0), false},
+        {"friday at 14:30", at(7, 4, 14, 30), false},
+        {"monday noon", at(7, 7, 12, 0), false},
+        {"today midnight", at(7, 2, 0, 0), false},
+        {"3pm", at(7, 2, 15, 0), false},
+        {"3:45 pm", at(7, 2, 15, 45), false},
+        {"12am", at(7, 2, 0, 0), false},
+        {"12pm", at(7, 2, 12, 0), false},
+        {"9:05", at(7, 2, 9, 5), false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.value, func(t *testing.T) {
+            got, dateOnly, err := parseTimeAt(tt.value, now, berlin)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !got.Equal(tt.want) || dateOnly != tt.dateOnly {
+                t.Errorf("got %v (date only %v), want %v (date only %v)", got, dateOnly, tt.want, tt.dateOnly)
+            }
+        })
+    }
+}
+
+func TestParseTimeAtDST(t *testing.T) {
+    berlin, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The day before clocks go forward: 9am tomorrow is in summer time.
+    now := time.Date(2025, 3, 29, 12, 0, 0, 0, berlin)
+    got, _, err := parseTimeAt("tomorrow 9am", now, berlin)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := "2025-03-30T09:00:00+02:00"; got.Format(time.RFC3339) != want {
+        t.Errorf("got %s, want %s", got.Format(time.RFC3339), want)
+    }
+}
+
+func TestParseTimeAtErrors(t *testing.T) {
+    now := time.Date(2025, 7, 2, 10, 30, 0, 0, time.UTC)
+    for _, value := range []string{
+        "", "  ", "garbage", "3", "13pm", "0am", "25:00", "10:5", "10:60",
+        "next blursday", "next", "tomorrow never", "+", "+2x", "2025-13-01",
+    } {
+        if got, _, err := parseTimeAt(value, now, time.UTC); err == nil {
+            t.Errorf("parseTimeAt(%q) = %v, want an error", value, got)
+        }
+    }
+}
+
+func TestParseTimeRange(t *testing.T) {
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Europe/Berlin")
+    berlin, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatal(err)
+    }
+    day := func(d int) time.Time { return time.Date(2025, 7, d, 0, 0, 0, 0, berlin) }
+
+    tests := []struct {
+        start, end         string
+        wantStart, wantEnd time.Time
+        wantOK             bool
+        wantErr            string
+    }{
+        {"", "", time.Time{}, time.Time{}, false, ""},
+        {"2025-07-01", "", day(1), day(2), true, ""},
+        {"2025-07-01", "2025-07-03", day(1), day(4), true, ""},
+        {"2025-07-01T10:00", "2025-07-01T11:00", day(1).Add(10 * time.Hour), day(1).Add(11 * time.Hour), true, ""},
+        {"2025-07-01T10:00", "2025-07-01", day(1).Add(10 * time.Hour), day(2), true, ""},
+        {"", "2025-07-01", time.Time{}, time.Time{}, false, "start_time is required"},
+        {"2025-07-01T10:00", "", time.Time{}, time.Time{}, false, "end_time is required"},
+        {"2025-07-01T10:00", "2025-07-01T09:00", time.Time{}, time.Time{}, false, "end_time must be after start_time"},
+        {"2025-07-01T10:00", "2025-07-01T10:00", time.Time{}, time.Time{}, false, "end_time must be after start_time"},
+        {"soon", "", time.Time{}, time.Time{}, false, "invalid start_time"},
+        {"2025-07-01", "later", time.Time{}, time.Time{}, false, "invalid end_time"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.start+"_"+tt.end, func(t *testing.T) {
+            start, end, ok, err := parseTimeRange(tt.start, tt.end)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if ok != tt.wantOK || !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+                t.Errorf("got %v, %v, %v, want %v, %v, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+            }
+        })
+    }
+}
+
+func TestUserLocation(t *testing.T) {
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "")
+    if loc, err := userLocation(); err != nil || loc != time.Local {
+        t.Errorf("unset: %v, %v, want the local timezone", loc, err)
+    }
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "America/New_York")
+    if loc, err := userLocation(); err != nil || loc.String() != "America/New_York" {
+        t.Errorf("set: %v, %v", loc, err)
+    }
+    t.Setenv("ICLOUD_MCP_TIMEZONE", "Mars/Olympus")
+    if _, err := userLocation(); err == nil {
+        t.Error("invalid timezone accepted")
+    }
+    if _, _, err := parseTimeArg("2025-07-01", nil); err == nil {
+        t.Error("parseTimeArg ignored the invalid timezone")
+    }
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const floatingDateTimeFormat = "20060102T150405"
+
+// newTimezone builds a VTIMEZONE for loc describing every UTC offset
+// transition between from and to, plus the observance already in effect at
+// from. Apple Calendar matches TZID against IANA names, but RFC 5545
+// requires a VTIMEZONE for every TZID we reference.
+func newTimezone(loc *time.Location, from, to time.Time) *ical.Component {
+    tz := ical.NewComponent(ical.CompTimezone)
+    tz.Props.SetText(ical.PropTimezoneID, loc.String())
+
+    t := from.In(loc)
+    if start, _ := t.ZoneBounds(); !start.IsZero() {
+        t = start
+    }
+    for {
+        // The offset in effect just before t is the "from" offset of the
+        // observance starting at t.
+        _, offsetFrom := t.Add(-time.Second).Zone()
+        tz.Children = append(tz.Children, newTimezoneObservance(t, offsetFrom))
+
+        _, end := t.ZoneBounds()
+        if end.IsZero() || end.After(to) {
+            break
+        }
+        t = end
+    }
+    return tz
+}
+
+func newTimezoneObservance(t time.Time, offsetFrom int) *ical.Component {
+    name, offsetTo := t.Zone()
+
+    compName := ical.CompTimezoneStandard
+    if t.IsDST() {
+        compName = ical.CompTimezoneDaylight
+    }
+    obs := ical.NewComponent(compName)
+
+    // DTSTART is the local time of the onset, expressed in the offset that
+    // was in effect before it.
+    dtstart := ical.NewProp(ical.PropDateTimeStart)
+    dtstart.Value = t.In(time.FixedZone("", offsetFrom)).Format(floatingDateTimeFormat)
+    obs.Props.Set(dtstart)
+
+    from := ical.NewProp(ical.PropTimezoneOffsetFrom)
+    from.Value = formatUTCOffset(offsetFrom)
+    obs.Props.Set(from)
+
+    to := ical.NewProp(ical.PropTimezoneOffsetTo)
+    to.Value = formatUTCOffset(offsetTo)
+    obs.Props.Set(to)
+
+    obs.Props.SetText(ical.PropTimezoneName, name)
+    return obs
+}
+
+// formatUTCOffset formats an offset in seconds east of UTC as an iCalendar
+// UTC-OFFSET value, e.g. "+0530".
+func formatUTCOffset(offset int) string {
+    sign := '+'
+    if offset < 0 {
+        sign = '-'
+        offset = -offset
+    }
+    s := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+    if sec := offset % 60; sec != 0 {
+        s += fmt.Sprintf("%02d", sec)
+    }
+    return s
+}
@@ -5,6 +5,7 @@ import (
     "os"
     "fmt"
 
+	"github.com/emersion/go-ical"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -31,47 +32,311 @@ func registerTools(server *mcp.Server) {
             "type": "object",
             "properties": map[string]any{
                 "limit": map[string]any{"type": "integer", "description": "Number of emails to fetch (default 10)"},
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox to read, as shown by list_mailboxes, or a special-use attribute such as \\Sent or \\Archive (default INBOX)"},
             },
         },
     }, handleReadEmails)
 
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "list_mailboxes",
+        Description: "List the IMAP mailboxes (folders) of the account with their attributes, including special-use roles such as \\Sent, \\Archive, \\Drafts, \\Junk and \\Trash.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{},
+        },
+    }, handleListMailboxes)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "search_emails",
+        Description: "Search a mailbox with IMAP SEARCH. All given criteria must match. Returns UIDs and envelopes, newest first, a page at a time; pass next_offset as offset for the next page.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox to search, or a special-use attribute such as \\Archive (default INBOX)"},
+                "from": map[string]any{"type": "string", "description": "Text in the From header"},
+                "to": map[string]any{"type": "string", "description": "Text in the To header"},
+                "subject": map[string]any{"type": "string", "description": "Text in the subject"},
+                "body": map[string]any{"type": "string", "description": "Text in the body"},
+                "since": map[string]any{"type": "string", "description": "Received on or after this day: " + timeArgHint},
+                "before": map[string]any{"type": "string", "description": "Received before this day, same formats as since"},
+                "unseen": map[string]any{"type": "boolean", "description": "Only unread messages"},
+                "flagged": map[string]any{"type": "boolean", "description": "Only flagged messages"},
+                "larger_than": map[string]any{"type": "integer", "description": "Only messages larger than this many bytes"},
+                "limit": map[string]any{"type": "integer", "description": "Page size (default 20, at most 100)"},
+                "offset": map[string]any{"type": "integer", "description": "Number of results to skip (default 0)"},
+            },
+        },
+    }, handleSearchEmails)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "get_email",
+        Description: "Fetch a single email by IMAP UID, without marking it as read: all headers, the whole decoded body and the list of attachments.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "uid": map[string]any{"type": "integer", "description": "IMAP UID of the message, as shown by read_emails or search_emails"},
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox containing the message, or a special-use attribute such as \\Sent (default INBOX)"},
+                "uid_validity": map[string]any{"type": "integer", "description": "UIDVALIDITY the UID was listed with; if given, the call fails instead of returning another message when the mailbox's UIDs have been reset"},
+            },
+            "required": []string{"uid"},
+        },
+    }, handleGetEmail)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "list_attachments",
+        Description: "List the attachments of an email from its BODYSTRUCTURE, with part number, filename, MIME type and size, without downloading the message.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "uid": map[string]any{"type": "integer", "description": "IMAP UID of the message"},
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox containing the message (default INBOX)"},
+                "uid_validity": map[string]any{"type": "integer", "description": "UIDVALIDITY the UID was listed with (optional check)"},
+            },
+            "required": []string{"uid"},
+        },
+    }, handleListAttachments)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "get_attachment",
+        Description: "Download one part of an email, such as an attachment listed by list_attachments or get_email. The decoded part is returned as an embedded resource, or saved to ICLOUD_MCP_DOWNLOAD_DIR with save. Parts over ICLOUD_MCP_MAX_ATTACHMENT_SIZE (default 10 MiB) are refused.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "uid": map[string]any{"type": "integer", "description": "IMAP UID of the message"},
+                "part": map[string]any{"type": "string", "description": "Section path of the part, e.g. \"2\" or \"1.2\""},
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox containing the message (default INBOX)"},
+                "uid_validity": map[string]any{"type": "integer", "description": "UIDVALIDITY the UID was listed with (optional check)"},
+                "save": map[string]any{"type": "boolean", "description": "Save the part to the download directory instead of returning it"},
+            },
+            "required": []string{"uid", "part"},
+        },
+    }, handleGetAttachment)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "respond_to_invitation",
+        Description: "Show the calendar invitation (iTIP REQUEST) in an email and optionally accept, decline or tentatively accept it. The reply is emailed to the organizer and your participation status is updated in your calendar.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "uid": map[string]any{"type": "integer", "description": "IMAP UID of the message, as shown by read_emails or search_emails"},
+                "mailbox": map[string]any{"type": "string", "description": "Mailbox containing the message (default INBOX)"},
+                "response": map[string]any{"type": "string", "enum": []string{"accept", "decline", "tentative"}, "description": "Response to send. Omit to only show the invitation."},
+                "comment": map[string]any{"type": "string", "description": "Optional note to the organizer"},
+                "calendar": map[string]any{"type": "string", "description": "Calendar holding the event (name or path); defaults to the default calendar"},
+            },
+            "required": []string{"uid"},
+        },
+    }, handleRespondToInvitation)
+
     // Calendar Tools
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "list_calendars",
+        Description: "List the user's calendars and reminder lists with their path, description, color and whether they hold events (VEVENT), reminders (VTODO) or both.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{},
+        },
+    }, handleListCalendars)
+
     mcp.AddTool(server, &mcp.Tool{
         Name: "create_calendar_event",
-        Description: "Create a calendar event. Requires ICLOUD_EMAIL and ICLOUD_PASSWORD (app-specific).",
+        Description: "Create a calendar event and upload it via CalDAV. Returns the event UID, path and ETag. Requires ICLOUD_EMAIL and ICLOUD_PASSWORD (app-specific); uses ICLOUD_CALDAV_URL or the first discovered calendar.",
         InputSchema: map[string]any{
             "type": "object",
             "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Calendar display name or path (optional, see list_calendars)"},
                 "summary": map[string]any{"type": "string", "description": "Event title/summary"},
-                "start_time": map[string]any{"type": "string", "description": "Start time in RFC3339 format (e.g. 2023-10-27T10:00:00Z)"},
-                "duration_minutes": map[string]any{"type": "integer", "description": "Duration in minutes"},
+                "start_time": map[string]any{"type": "string", "description": "Start time: " + timeArgHint + ". Times without an offset are in timezone if set, otherwise in the user's timezone (ICLOUD_MCP_TIMEZONE). For all-day events, a date."},
+                "end_time": map[string]any{"type": "string", "description": "End time, same format as start_time (alternative to duration_minutes). For all-day events, the last day of the event."},
+                "duration_minutes": map[string]any{"type": "integer", "description": "Duration in minutes (alternative to end_time)"},
+                "all_day": map[string]any{"type": "boolean", "description": "Create an all-day event spanning whole dates"},
+                "timezone": map[string]any{"type": "string", "description": "IANA timezone for the event (e.g. Europe/Berlin); times without an offset are read in it and the event is stored in it. Without it, such times are read in ICLOUD_MCP_TIMEZONE, else the server's local timezone, and the event is stored in UTC."},
+                "location": map[string]any{"type": "string", "description": "Event location"},
+                "description": map[string]any{"type": "string", "description": "Event notes/description"},
+                "url": map[string]any{"type": "string", "description": "URL associated with the event"},
+                "recurrence": map[string]any{
+                    "type": "object",
+                    "description": "Make the event repeat. Give either frequency (with optional interval, by_day, until or count) or a raw rrule.",
+                    "properties": map[string]any{
+                        "frequency": map[string]any{"type": "string", "enum": []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, "description": "How often the event repeats"},
+                        "interval": map[string]any{"type": "integer", "description": "Repeat every N periods (default 1)"},
+                        "by_day": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Weekdays as MO, TU, WE, TH, FR, SA, SU, optionally with a position (e.g. 1MO, -1FR)"},
+                        "until": map[string]any{"type": "string", "description": "Last date or time of the recurrence: " + timeArgHint},
+                        "count": map[string]any{"type": "integer", "description": "Number of occurrences"},
+                        "rrule": map[string]any{"type": "string", "description": "Raw RFC 5545 RRULE value (e.g. FREQ=WEEKLY;BYDAY=MO,WE)"},
+                    },
+                },
+                "attendees": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Attendee email addresses, like bob@example.com or Bob <bob@example.com>. The iCloud account becomes the organizer."},
+                "send_invitations": map[string]any{"type": "boolean", "description": "Email an invitation (iTIP REQUEST) to the attendees"},
+                "alerts": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Alerts, each a relative offset from the start like -15m, -1h or -1d, or an absolute time: " + timeArgHint},
             },
-            "required": []string{"summary", "start_time", "duration_minutes"},
+            "required": []string{"summary", "start_time"},
         },
     }, handleCreateCalendarEvent)
 
     mcp.AddTool(server, &mcp.Tool{
         Name: "list_calendar_events",
-        Description: "List calendar events. Requires ICLOUD_CALDAV_URL pointing to a specific calendar collection.",
+        Description: "List calendar events from ICLOUD_CALDAV_URL or the first discovered calendar. Recurring events are expanded into their occurrences within the range. Served from a local cache that is revalidated by ETag on every call, or after ICLOUD_MCP_CACHE_TTL if set.",
         InputSchema: map[string]any{
             "type": "object",
             "properties": map[string]any{
-                "start_time": map[string]any{"type": "string", "description": "Start time range (RFC3339)"},
-                "end_time": map[string]any{"type": "string", "description": "End time range (RFC3339)"},
+                "calendar": map[string]any{"type": "string", "description": "Calendar display name or path (optional, see list_calendars)"},
+                "start_time": map[string]any{"type": "string", "description": "Start of the range: " + timeArgHint + ". A date alone lists that day."},
+                "end_time": map[string]any{"type": "string", "description": "End of the range, same formats; a date includes the whole day. Required with a start_time that is not a date."},
             },
-            "required": []string{"start_time", "end_time"},
+            "required": []string{"start_time"},
+        },
+        OutputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "events": map[string]any{
+                    "type": "array",
+                    "items": map[string]any{
+                        "type": "object",
+                        "properties": map[string]any{
+                            "uid": map[string]any{"type": "string"},
+                            "path": map[string]any{"type": "string", "description": "Path of the calendar object, usable with update_calendar_event"},
+                            "etag": map[string]any{"type": "string"},
+                            "summary": map[string]any{"type": "string"},
+                            "start": map[string]any{"type": "string", "description": "RFC3339 start in the event's timezone, or YYYY-MM-DD for all-day events"},
+                            "end": map[string]any{"type": "string", "description": "RFC3339 end, or the exclusive end date for all-day events"},
+                            "timezone": map[string]any{"type": "string", "description": "TZID of the event, UTC, or empty for floating and all-day events"},
+                            "all_day": map[string]any{"type": "boolean"},
+                            "location": map[string]any{"type": "string"},
+                            "description": map[string]any{"type": "string"},
+                            "status": map[string]any{"type": "string"},
+                            "recurring": map[string]any{"type": "boolean", "description": "Whether this is an occurrence of a recurring event"},
+                            "alerts": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Alarms, e.g. \"15m before start\""},
+                        },
+                        "required": []string{"uid", "path", "summary", "start", "end", "all_day"},
+                    },
+                },
+            },
+            "required": []string{"events"},
         },
     }, handleListCalendarEvents)
 
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "find_free_time",
+        Description: "Find free time slots of a given length across all calendars, within working hours in a timezone. Recurring events are expanded; transparent (free), cancelled and declined events don't count as busy. Events that can't be read are listed as skipped.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "duration_minutes": map[string]any{"type": "integer", "description": "Minimum length of a free slot in minutes (default 30)"},
+                "start_time": map[string]any{"type": "string", "description": "Start of the search range (default now): " + timeArgHint},
+                "end_time": map[string]any{"type": "string", "description": "End of the search range (default 7 days after start_time), same formats; a date includes the whole day"},
+                "timezone": map[string]any{"type": "string", "description": "IANA timezone for working hours and results (default: ICLOUD_MCP_TIMEZONE, else the server's local timezone)"},
+                "workday_start": map[string]any{"type": "string", "description": "Start of working hours, HH:MM (default 09:00)"},
+                "workday_end": map[string]any{"type": "string", "description": "End of working hours, HH:MM (default 17:00, 24:00 for end of day)"},
+                "include_weekends": map[string]any{"type": "boolean", "description": "Also search Saturdays and Sundays"},
+                "calendars": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Calendars to consider (names or paths); default ICLOUD_CALDAV_URL if set, else all event calendars"},
+                "max_results": map[string]any{"type": "integer", "description": "Maximum number of slots to return (default 20)"},
+            },
+        },
+    }, handleFindFreeTime)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "sync_calendar",
+        Description: "Report the events or reminders created, changed or deleted in a calendar since the previous sync_calendar call. Uses WebDAV sync-collection tokens (RFC 6578), falling back to ctag/ETag comparison. The first call reports every object as created.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Calendar or reminder list display name or path (optional, see list_calendars)"},
+                "type": map[string]any{"type": "string", "enum": []string{"events", "reminders"}, "description": "Whether to sync a calendar or a reminder list (default events)"},
+                "reset": map[string]any{"type": "boolean", "description": "Forget the stored sync state and start over"},
+            },
+        },
+    }, handleSyncCalendar)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "clear_cache",
+        Description: "Delete the local cache of calendar objects used by list_calendar_events. The next listing fetches everything from the server again.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{},
+        },
+    }, handleClearCache)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "update_calendar_event",
+        Description: "Update an existing calendar event identified by UID or path. Only the given fields are changed. Fails with a conflict if the event was modified elsewhere since it was fetched.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Calendar display name or path (optional, see list_calendars)"},
+                "uid": map[string]any{"type": "string", "description": "UID of the event (required unless path is given)"},
+                "path": map[string]any{"type": "string", "description": "Path of the event object (required unless uid is given)"},
+                "summary": map[string]any{"type": "string", "description": "New event title/summary"},
+                "start_time": map[string]any{"type": "string", "description": "New start time: " + timeArgHint + ". Without end_time the duration is kept. All-day events stay all-day and only use the date."},
+                "end_time": map[string]any{"type": "string", "description": "New end time, same formats as start_time; for all-day events the last day"},
+                "location": map[string]any{"type": "string", "description": "New location (empty string removes it)"},
+                "description": map[string]any{"type": "string", "description": "New description (empty string removes it)"},
+                "attendees": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Attendee email addresses, like bob@example.com or Bob <bob@example.com>, replacing the existing list"},
+                "send_invitations": map[string]any{"type": "boolean", "description": "Email an updated invitation (iTIP REQUEST) to the attendees"},
+            },
+        },
+    }, handleUpdateCalendarEvent)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "delete_calendar_event",
+        Description: "Delete a calendar event identified by UID or path. Set dry_run to see what would be deleted without deleting it.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Calendar display name or path (optional, see list_calendars)"},
+                "uid": map[string]any{"type": "string", "description": "UID of the event (required unless path is given)"},
+                "path": map[string]any{"type": "string", "description": "Path of the event object (required unless uid is given)"},
+                "dry_run": map[string]any{"type": "boolean", "description": "Only show what would be deleted"},
+            },
+        },
+    }, handleDeleteCalendarEvent)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "import_ics",
+        Description: "Import an iCalendar (.ics) file or inline iCalendar text. Components are split into one object per UID and uploaded; events go to the calendar and reminders to the reminders list.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "path": map[string]any{"type": "string", "description": "Path of a regular .ics file of at most 10 MiB on the server's machine (required unless content is given)"},
+                "content": map[string]any{"type": "string", "description": "iCalendar text (required unless path is given)"},
+                "calendar": map[string]any{"type": "string", "description": "Calendar or reminder list display name or path (optional, see list_calendars)"},
+                "on_duplicate": map[string]any{"type": "string", "enum": duplicateModes, "description": "What to do when an object with the same UID exists: skip it (default), replace it, or import under a new UID"},
+            },
+        },
+    }, handleImportICS)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "export_calendar",
+        Description: "Export the events or reminders of a calendar as a single VCALENDAR, either all of them or those overlapping a time range. Returns the iCalendar text, or writes it to a file if path is given.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Calendar or reminder list display name or path (optional, see list_calendars)"},
+                "type": map[string]any{"type": "string", "enum": []string{"events", "reminders"}, "description": "Whether to export a calendar or a reminder list (default events)"},
+                "start_time": map[string]any{"type": "string", "description": "Start of the range (optional): " + timeArgHint + ". A date alone exports that day."},
+                "end_time": map[string]any{"type": "string", "description": "End of the range, same formats; a date includes the whole day (optional)"},
+                "path": map[string]any{"type": "string", "description": "File ending in .ics to write to instead of returning it (optional); an existing file is only replaced with overwrite"},
+                "overwrite": map[string]any{"type": "boolean", "description": "Replace the file at path if it exists (default false)"},
+            },
+        },
+    }, handleExportCalendar)
+
     // Reminder Tools
     mcp.AddTool(server, &mcp.Tool{
         Name: "create_reminder",
-        Description: "Create a reminder. Requires ICLOUD_EMAIL and ICLOUD_PASSWORD (app-specific).",
+        Description: "Create a reminder and upload it via CalDAV. Returns the reminder UID, path and ETag. Requires ICLOUD_EMAIL and ICLOUD_PASSWORD (app-specific); uses ICLOUD_REMINDERS_URL or the first discovered reminders list.",
         InputSchema: map[string]any{
             "type": "object",
             "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Reminder list display name or path (optional, see list_calendars)"},
                 "title": map[string]any{"type": "string", "description": "Reminder title"},
-                "due_date": map[string]any{"type": "string", "description": "Due date in RFC3339 format (optional)"},
+                "due_date": map[string]any{"type": "string", "description": "Due date (optional): " + timeArgHint + ". A day without a time makes the reminder due that day."},
+                "start_date": map[string]any{"type": "string", "description": "Start date, same formats as due_date (optional)"},
+                "priority": map[string]any{"type": "string", "description": "high, medium, low or none, or an iCalendar priority 0-9 (optional)"},
+                "notes": map[string]any{"type": "string", "description": "Notes shown with the reminder (optional)"},
+                "parent_uid": map[string]any{"type": "string", "description": "UID of a reminder in the same list to create this reminder as a subtask of (optional)"},
+                "subtasks": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Titles of subtasks to create under the new reminder, e.g. a checklist (optional)"},
+                "alerts": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Alerts, each an absolute time (" + timeArgHint + ") or an offset like -15m relative to the start date, or the due date if there is no start date (optional)"},
             },
             "required": []string{"title"},
         },
@@ -79,13 +344,56 @@ func registerTools(server *mcp.Server) {
 
     mcp.AddTool(server, &mcp.Tool{
         Name: "list_reminders",
-        Description: "List reminders. Requires ICLOUD_REMINDERS_URL (or ICLOUD_CALDAV_URL) pointing to a reminders collection.",
+        Description: "List reminders from ICLOUD_REMINDERS_URL or the first discovered reminders list. Subtasks are nested under their parent reminder.",
         InputSchema: map[string]any{
             "type": "object",
-            "properties": map[string]any{},
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Reminder list display name or path (optional, see list_calendars)"},
+                "filter": map[string]any{"type": "string", "enum": reminderFilters, "description": "Which reminders to list (default all)"},
+            },
         },
     }, handleListReminders)
 
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "complete_reminder",
+        Description: "Mark a reminder identified by UID or path as completed.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Reminder list display name or path (optional, see list_calendars)"},
+                "uid": map[string]any{"type": "string", "description": "UID of the reminder (required unless path is given)"},
+                "path": map[string]any{"type": "string", "description": "Path of the reminder object (required unless uid is given)"},
+            },
+        },
+    }, handleCompleteReminder)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "reopen_reminder",
+        Description: "Mark a completed reminder identified by UID or path as not completed.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Reminder list display name or path (optional, see list_calendars)"},
+                "uid": map[string]any{"type": "string", "description": "UID of the reminder (required unless path is given)"},
+                "path": map[string]any{"type": "string", "description": "Path of the reminder object (required unless uid is given)"},
+            },
+        },
+    }, handleReopenReminder)
+
+    mcp.AddTool(server, &mcp.Tool{
+        Name: "delete_reminder",
+        Description: "Delete a reminder identified by UID or path. Set dry_run to see what would be deleted without deleting it.",
+        InputSchema: map[string]any{
+            "type": "object",
+            "properties": map[string]any{
+                "calendar": map[string]any{"type": "string", "description": "Reminder list display name or path (optional, see list_calendars)"},
+                "uid": map[string]any{"type": "string", "description": "UID of the reminder (required unless path is given)"},
+                "path": map[string]any{"type": "string", "description": "Path of the reminder object (required unless uid is given)"},
+                "dry_run": map[string]any{"type": "boolean", "description": "Only show what would be deleted"},
+            },
+        },
+    }, handleDeleteReminder)
+
     // Notes Tools
     mcp.AddTool(server, &mcp.Tool{
         Name: "read_notes",
@@ -147,32 +455,274 @@ func handleSendEmail(ctx context.Context, req *mcp.CallToolRequest, args struct
 
 func handleReadEmails(ctx context.Context, req *mcp.CallToolRequest, args struct {
     Limit int `json:"limit"`
+    Mailbox string `json:"mailbox"`
 }) (*mcp.CallToolResult, any, error) {
-    return runReadEmails(args.Limit)
+    return runReadEmails(args.Mailbox, args.Limit)
+}
+
+func handleSearchEmails(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Mailbox string `json:"mailbox"`
+    From string `json:"from"`
+    To string `json:"to"`
+    Subject string `json:"subject"`
+    Body string `json:"body"`
+    Since string `json:"since"`
+    Before string `json:"before"`
+    Unseen bool `json:"unseen"`
+    Flagged bool `json:"flagged"`
+    LargerThan int `json:"larger_than"`
+    Limit int `json:"limit"`
+    Offset int `json:"offset"`
+}) (*mcp.CallToolResult, any, error) {
+    return runSearchEmails(searchEmailsRequest{
+        Mailbox:    args.Mailbox,
+        From:       args.From,
+        To:         args.To,
+        Subject:    args.Subject,
+        Body:       args.Body,
+        Since:      args.Since,
+        Before:     args.Before,
+        Unseen:     args.Unseen,
+        Flagged:    args.Flagged,
+        LargerThan: args.LargerThan,
+        Limit:      args.Limit,
+        Offset:     args.Offset,
+    })
+}
+
+func handleGetEmail(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    UID uint32 `json:"uid"`
+    Mailbox string `json:"mailbox"`
+    UIDValidity uint32 `json:"uid_validity"`
+}) (*mcp.CallToolResult, any, error) {
+    return runGetEmail(args.Mailbox, args.UID, args.UIDValidity)
+}
+
+func handleListAttachments(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    UID uint32 `json:"uid"`
+    Mailbox string `json:"mailbox"`
+    UIDValidity uint32 `json:"uid_validity"`
+}) (*mcp.CallToolResult, any, error) {
+    return runListAttachments(args.Mailbox, args.UID, args.UIDValidity)
+}
+
+func handleGetAttachment(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    UID uint32 `json:"uid"`
+    Part string `json:"part"`
+    Mailbox string `json:"mailbox"`
+    UIDValidity uint32 `json:"uid_validity"`
+    Save bool `json:"save"`
+}) (*mcp.CallToolResult, any, error) {
+    return runGetAttachment(args.Mailbox, args.UID, args.UIDValidity, args.Part, args.Save)
+}
+
+func handleListMailboxes(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+    return runListMailboxes()
+}
+
+func handleRespondToInvitation(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    UID uint32 `json:"uid"`
+    Mailbox string `json:"mailbox"`
+    Response string `json:"response"`
+    Comment string `json:"comment"`
+    Calendar string `json:"calendar"`
+}) (*mcp.CallToolResult, any, error) {
+    return runRespondToInvitation(ctx, args.Mailbox, args.UID, args.Response, args.Comment, args.Calendar)
+}
+
+func handleListCalendars(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+    return runListCalendars(ctx)
 }
 
 func handleCreateCalendarEvent(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
     Summary string `json:"summary"`
     StartTime string `json:"start_time"`
+    EndTime string `json:"end_time"`
     DurationMinutes int `json:"duration_minutes"`
+    AllDay bool `json:"all_day"`
+    Timezone string `json:"timezone"`
+    Location string `json:"location"`
+    Description string `json:"description"`
+    URL string `json:"url"`
+    Recurrence *recurrenceRequest `json:"recurrence"`
+    Attendees []string `json:"attendees"`
+    SendInvitations bool `json:"send_invitations"`
+    Alerts []string `json:"alerts"`
 }) (*mcp.CallToolResult, any, error) {
-    return runCreateCalendarEvent(args.Summary, args.StartTime, args.DurationMinutes)
+    return runCreateCalendarEvent(ctx, args.Calendar, newEventRequest{
+        Summary:         args.Summary,
+        StartTime:       args.StartTime,
+        EndTime:         args.EndTime,
+        DurationMinutes: args.DurationMinutes,
+        AllDay:          args.AllDay,
+        Timezone:        args.Timezone,
+        Location:        args.Location,
+        Description:     args.Description,
+        URL:             args.URL,
+        Recurrence:      args.Recurrence,
+        Attendees:       args.Attendees,
+        SendInvitations: args.SendInvitations,
+        Alerts:          args.Alerts,
+    })
 }
 
 func handleListCalendarEvents(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    StartTime string `json:"start_time"`
+    EndTime string `json:"end_time"`
+}) (*mcp.CallToolResult, any, error) {
+    return runListCalendarEvents(ctx, args.Calendar, args.StartTime, args.EndTime)
+}
+
+func handleFindFreeTime(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    DurationMinutes int `json:"duration_minutes"`
+    StartTime string `json:"start_time"`
+    EndTime string `json:"end_time"`
+    Timezone string `json:"timezone"`
+    WorkdayStart string `json:"workday_start"`
+    WorkdayEnd string `json:"workday_end"`
+    IncludeWeekends bool `json:"include_weekends"`
+    Calendars []string `json:"calendars"`
+    MaxResults int `json:"max_results"`
+}) (*mcp.CallToolResult, any, error) {
+    return runFindFreeTime(ctx, findFreeTimeRequest{
+        StartTime:       args.StartTime,
+        EndTime:         args.EndTime,
+        DurationMinutes: args.DurationMinutes,
+        WorkdayStart:    args.WorkdayStart,
+        WorkdayEnd:      args.WorkdayEnd,
+        Timezone:        args.Timezone,
+        IncludeWeekends: args.IncludeWeekends,
+        Calendars:       args.Calendars,
+        MaxResults:      args.MaxResults,
+    })
+}
+
+func handleSyncCalendar(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    Type string `json:"type"`
+    Reset bool `json:"reset"`
+}) (*mcp.CallToolResult, any, error) {
+    compType := ical.CompEvent
+    if args.Type == "reminders" {
+        compType = ical.CompToDo
+    }
+    return runSyncCalendar(ctx, args.Calendar, compType, args.Reset)
+}
+
+func handleClearCache(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+    return runClearCache(ctx)
+}
+
+func handleUpdateCalendarEvent(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    UID string `json:"uid"`
+    Path string `json:"path"`
+    Summary *string `json:"summary"`
+    StartTime *string `json:"start_time"`
+    EndTime *string `json:"end_time"`
+    Location *string `json:"location"`
+    Description *string `json:"description"`
+    Attendees []string `json:"attendees"`
+    SendInvitations bool `json:"send_invitations"`
+}) (*mcp.CallToolResult, any, error) {
+    return runUpdateCalendarEvent(ctx, args.Calendar, args.UID, args.Path, eventUpdate{
+        Summary:     args.Summary,
+        StartTime:   args.StartTime,
+        EndTime:     args.EndTime,
+        Location:    args.Location,
+        Description: args.Description,
+        Attendees:   args.Attendees,
+
+        SendInvitations: args.SendInvitations,
+    })
+}
+
+func handleDeleteCalendarEvent(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    UID string `json:"uid"`
+    Path string `json:"path"`
+    DryRun bool `json:"dry_run"`
+}) (*mcp.CallToolResult, any, error) {
+    return runDeleteCalendarObject(ctx, ical.CompEvent, args.Calendar, args.UID, args.Path, args.DryRun)
+}
+
+func handleImportICS(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Path string `json:"path"`
+    Content string `json:"content"`
+    Calendar string `json:"calendar"`
+    OnDuplicate string `json:"on_duplicate"`
+}) (*mcp.CallToolResult, any, error) {
+    return runImportICS(ctx, args.Calendar, args.Path, args.Content, args.OnDuplicate)
+}
+
+func handleExportCalendar(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    Type string `json:"type"`
     StartTime string `json:"start_time"`
     EndTime string `json:"end_time"`
+    Path string `json:"path"`
+    Overwrite bool `json:"overwrite"`
 }) (*mcp.CallToolResult, any, error) {
-    return runListCalendarEvents(args.StartTime, args.EndTime)
+    compType := ical.CompEvent
+    if args.Type == "reminders" {
+        compType = ical.CompToDo
+    }
+    return runExportCalendar(ctx, args.Calendar, compType, args.StartTime, args.EndTime, args.Path, args.Overwrite)
 }
 
 func handleCreateReminder(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
     Title string `json:"title"`
     DueDate string `json:"due_date"`
+    StartDate string `json:"start_date"`
+    Priority string `json:"priority"`
+    Notes string `json:"notes"`
+    ParentUID string `json:"parent_uid"`
+    Subtasks []string `json:"subtasks"`
+    Alerts []string `json:"alerts"`
+}) (*mcp.CallToolResult, any, error) {
+    return runCreateReminder(ctx, args.Calendar, newReminderRequest{
+        Title:     args.Title,
+        DueDate:   args.DueDate,
+        StartDate: args.StartDate,
+        Priority:  args.Priority,
+        Notes:     args.Notes,
+        ParentUID: args.ParentUID,
+        Subtasks:  args.Subtasks,
+        Alerts:    args.Alerts,
+    })
+}
+
+func handleListReminders(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    Filter string `json:"filter"`
 }) (*mcp.CallToolResult, any, error) {
-    return runCreateReminder(args.Title, args.DueDate)
+    return runListReminders(ctx, args.Calendar, args.Filter)
 }
 
-func handleListReminders(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
-    return runListReminders()
+func handleCompleteReminder(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    UID string `json:"uid"`
+    Path string `json:"path"`
+}) (*mcp.CallToolResult, any, error) {
+    return runSetReminderCompleted(ctx, args.Calendar, args.UID, args.Path, true)
+}
+
+func handleReopenReminder(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    UID string `json:"uid"`
+    Path string `json:"path"`
+}) (*mcp.CallToolResult, any, error) {
+    return runSetReminderCompleted(ctx, args.Calendar, args.UID, args.Path, false)
+}
+
+func handleDeleteReminder(ctx context.Context, req *mcp.CallToolRequest, args struct {
+    Calendar string `json:"calendar"`
+    UID string `json:"uid"`
+    Path string `json:"path"`
+    DryRun bool `json:"dry_run"`
+}) (*mcp.CallToolResult, any, error) {
+    return runDeleteCalendarObject(ctx, ical.CompToDo, args.Calendar, args.UID, args.Path, args.DryRun)
 }